@@ -0,0 +1,350 @@
+// Package audit records the calls to the API that change the state of the
+// node, as JSON lines in files of the repo.
+//
+// Entries are appended to DirName/FileName. When the file grows over the
+// configured size it is renamed with the time of the rotation, such as
+// audit-20210102T150405.000000000.log, and a new file is started.
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	logging "github.com/ipfs/go-log"
+)
+
+var log = logging.Logger("audit")
+
+// DirName is the directory of the repo holding the audit log.
+const DirName = "audit"
+
+// Selector is the configuration key of the Config of the audit log.
+const Selector = "API.Audit"
+
+// FileName is the name of the file entries are appended to.
+const FileName = "audit.log"
+
+const (
+	rotatedPrefix = "audit-"
+	rotatedSuffix = ".log"
+	rotatedLayout = "20060102T150405.000000000"
+)
+
+const (
+	defaultMaxFileSize = 10 << 20
+	defaultMaxFiles    = 10
+)
+
+// DefaultCommands are the commands audited when Config.Commands is empty:
+// the commands changing pins, keys, the config, IPNS names and MFS, and the
+// export of keys.
+var DefaultCommands = []string{
+	"add",
+	"config",
+	"files/chcid",
+	"files/cp",
+	"files/mkdir",
+	"files/mv",
+	"files/rm",
+	"files/write",
+	"key/export",
+	"key/gen",
+	"key/import",
+	"key/rename",
+	"key/rm",
+	"key/rotate",
+	"name/publish",
+	"pin/add",
+	"pin/rm",
+	"pin/update",
+	"pin/remote/add",
+	"pin/remote/rm",
+	"pin/remote/service",
+	"repo/gc",
+	"shutdown",
+}
+
+// Config is the configuration of the audit log.
+type Config struct {
+	// Enabled turns the audit log on.
+	Enabled bool
+
+	// Commands lists the paths of the audited commands. A path also matches
+	// its subcommands, and "*" matches every command. Defaults to
+	// DefaultCommands.
+	Commands []string
+
+	// MaxFileSize is the size, in bytes, over which the log file is rotated.
+	// Defaults to 10MiB.
+	MaxFileSize int64
+
+	// MaxFiles is the number of rotated files kept. Defaults to 10.
+	MaxFiles int
+
+	// MaxAge is the duration rotated files are kept for, such as "720h".
+	// Empty keeps them until there are more than MaxFiles.
+	MaxAge string
+}
+
+// Audits returns true if calls to the command cmdPath are recorded.
+func (c Config) Audits(cmdPath string) bool {
+	commands := c.Commands
+	if len(commands) == 0 {
+		commands = DefaultCommands
+	}
+	return MatchCommand(commands, cmdPath)
+}
+
+// MatchCommand returns true if cmdPath is one of the command paths, or a
+// subcommand of one of them. The path "*" matches every command.
+func MatchCommand(paths []string, cmdPath string) bool {
+	for _, p := range paths {
+		p = strings.Trim(p, "/")
+		if p == "*" || cmdPath == p || strings.HasPrefix(cmdPath, p+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// Entry is the record of a call to the API.
+type Entry struct {
+	Time time.Time
+	// Remote is the address of the client.
+	Remote string
+	// Token identifies the token of the call, when the API requires one.
+	Token string `json:",omitempty"`
+	// Command is the path of the command, such as "pin/add".
+	Command   string
+	Arguments []string            `json:",omitempty"`
+	Options   map[string][]string `json:",omitempty"`
+	// Status is the HTTP status of the response.
+	Status int
+	// Error is the error the call failed with, if any.
+	Error string `json:",omitempty"`
+}
+
+// Log appends entries to the audit log of a directory.
+type Log struct {
+	cfg         Config
+	dir         string
+	maxFileSize int64
+	maxFiles    int
+	maxAge      time.Duration
+	now         func() time.Time
+
+	lk   sync.Mutex
+	f    *os.File
+	size int64
+}
+
+// Open opens the audit log of dir, creating the directory if needed.
+func Open(dir string, cfg Config) (*Log, error) {
+	l := &Log{
+		cfg:         cfg,
+		dir:         dir,
+		maxFileSize: cfg.MaxFileSize,
+		maxFiles:    cfg.MaxFiles,
+		now:         time.Now,
+	}
+	if l.maxFileSize <= 0 {
+		l.maxFileSize = defaultMaxFileSize
+	}
+	if l.maxFiles <= 0 {
+		l.maxFiles = defaultMaxFiles
+	}
+	if cfg.MaxAge != "" {
+		d, err := time.ParseDuration(cfg.MaxAge)
+		if err != nil {
+			return nil, fmt.Errorf("invalid audit log MaxAge: %s", err)
+		}
+		l.maxAge = d
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	if err := l.prune(); err != nil {
+		l.f.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *Log) open() error {
+	f, err := os.OpenFile(filepath.Join(l.dir, FileName), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	l.f = f
+	l.size = fi.Size()
+	return nil
+}
+
+// Audits returns true if calls to the command cmdPath are recorded, see
+// Config.Audits.
+func (l *Log) Audits(cmdPath string) bool {
+	return l.cfg.Audits(cmdPath)
+}
+
+// Write appends an entry, rotating the file first when the entry would take
+// it over the maximum size.
+func (l *Log) Write(e Entry) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+
+	l.lk.Lock()
+	defer l.lk.Unlock()
+
+	if l.f == nil {
+		return os.ErrClosed
+	}
+	if l.size > 0 && l.size+int64(len(b)) > l.maxFileSize {
+		if err := l.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := l.f.Write(b)
+	l.size += int64(n)
+	return err
+}
+
+func (l *Log) rotate() error {
+	if err := l.f.Close(); err != nil {
+		return err
+	}
+	l.f = nil
+
+	name := rotatedPrefix + l.now().UTC().Format(rotatedLayout) + rotatedSuffix
+	if err := os.Rename(filepath.Join(l.dir, FileName), filepath.Join(l.dir, name)); err != nil {
+		return err
+	}
+	if err := l.open(); err != nil {
+		return err
+	}
+	if err := l.prune(); err != nil {
+		// entries can still be written
+		log.Errorf("pruning the audit log: %s", err)
+	}
+	return nil
+}
+
+// prune removes the rotated files over MaxFiles, oldest first, and the ones
+// older than MaxAge.
+func (l *Log) prune() error {
+	rotated, err := rotatedFiles(l.dir)
+	if err != nil {
+		return err
+	}
+	for i, name := range rotated {
+		remove := len(rotated)-i > l.maxFiles
+		if !remove && l.maxAge > 0 {
+			fi, err := os.Stat(name)
+			if err != nil {
+				return err
+			}
+			remove = l.now().Sub(fi.ModTime()) > l.maxAge
+		}
+		if remove {
+			if err := os.Remove(name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Close closes the log file.
+func (l *Log) Close() error {
+	l.lk.Lock()
+	defer l.lk.Unlock()
+	if l.f == nil {
+		return nil
+	}
+	err := l.f.Close()
+	l.f = nil
+	return err
+}
+
+// rotatedFiles returns the paths of the rotated files of dir, oldest first.
+func rotatedFiles(dir string) ([]string, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, fi := range infos {
+		name := fi.Name()
+		if fi.IsDir() || !strings.HasPrefix(name, rotatedPrefix) || !strings.HasSuffix(name, rotatedSuffix) {
+			continue
+		}
+		names = append(names, filepath.Join(dir, name))
+	}
+	// the layout of the rotation time sorts chronologically
+	sort.Strings(names)
+	return names, nil
+}
+
+// Read calls fn with the entries of the audit log of dir, oldest first. A
+// missing directory has no entries.
+func Read(dir string, fn func(Entry) error) error {
+	names, err := rotatedFiles(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	names = append(names, filepath.Join(dir, FileName))
+
+	for _, name := range names {
+		if err := readFile(name, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readFile(name string, fn func(Entry) error) error {
+	f, err := os.Open(name)
+	if os.IsNotExist(err) {
+		// rotated or pruned since listed
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	s.Buffer(nil, 1<<20)
+	for n := 1; s.Scan(); n++ {
+		var e Entry
+		if err := json.Unmarshal(s.Bytes(), &e); err != nil {
+			return fmt.Errorf("%s: line %d: %s", name, n, err)
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return s.Err()
+}
@@ -0,0 +1,128 @@
+package audit
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func readAll(t *testing.T, dir string) []Entry {
+	var entries []Entry
+	if err := Read(dir, func(e Entry) error {
+		entries = append(entries, e)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return entries
+}
+
+func TestRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	now := time.Unix(1000, 0)
+	l, err := Open(dir, Config{MaxFileSize: 200, MaxFiles: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.now = func() time.Time { return now }
+	defer l.Close()
+
+	for i := 0; i < 10; i++ {
+		now = now.Add(time.Second)
+		if err := l.Write(Entry{Time: now, Command: "pin/add", Arguments: []string{"bafkqaaa"}, Status: 200}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rotated, err := rotatedFiles(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rotated) != 2 {
+		t.Fatalf("expected 2 rotated files, got %d", len(rotated))
+	}
+	fi, err := os.Stat(filepath.Join(dir, FileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Size() > 200 {
+		t.Errorf("expected the log file to be rotated, got %d bytes", fi.Size())
+	}
+
+	entries := readAll(t, dir)
+	if len(entries) == 0 || len(entries) >= 10 {
+		t.Fatalf("expected the oldest entries to be pruned, got %d entries", len(entries))
+	}
+	for i := 1; i < len(entries); i++ {
+		if !entries[i].Time.After(entries[i-1].Time) {
+			t.Fatal("expected entries oldest first")
+		}
+	}
+	if last := entries[len(entries)-1]; !last.Time.Equal(now) {
+		t.Errorf("expected the last entry at %s, got %s", now, last.Time)
+	}
+}
+
+func TestMaxAge(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	old := filepath.Join(dir, rotatedPrefix+"20200101T000000.000000000"+rotatedSuffix)
+	if err := ioutil.WriteFile(old, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Now().Add(-48 * time.Hour)
+	if err := os.Chtimes(old, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := Open(dir, Config{MaxAge: "24h"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	if _, err := os.Stat(old); !os.IsNotExist(err) {
+		t.Error("expected the file older than MaxAge to be removed")
+	}
+}
+
+func TestAudits(t *testing.T) {
+	var cfg Config
+	for cmd, audited := range map[string]bool{
+		"pin/add":       true,
+		"pin/ls":        false,
+		"key/gen":       true,
+		"name/publish":  true,
+		"name/resolve":  false,
+		"config":        true,
+		"config/show":   true,
+		"configuration": false,
+		"cat":           false,
+	} {
+		if cfg.Audits(cmd) != audited {
+			t.Errorf("expected Audits(%q) to be %t", cmd, audited)
+		}
+	}
+
+	cfg.Commands = []string{"*"}
+	if !cfg.Audits("cat") {
+		t.Error("expected * to audit every command")
+	}
+}
+
+func TestReadMissing(t *testing.T) {
+	if entries := readAll(t, filepath.Join(os.TempDir(), "no-such-audit-dir")); len(entries) != 0 {
+		t.Errorf("expected no entries, got %d", len(entries))
+	}
+}
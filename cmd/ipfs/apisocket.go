@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"strconv"
+	"time"
+
+	"github.com/ipfs/go-ipfs/repo"
+
+	ma "github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+)
+
+// apiSocketSelector is the configuration key of the permissions of the Unix
+// domain sockets of the API.
+const apiSocketSelector = "API.UnixSocket"
+
+const defaultAPISocketMode = "0600"
+
+// apiSocketConfig sets the permissions of the Unix domain sockets the API
+// listens on. Only processes with write permission on a socket can connect.
+type apiSocketConfig struct {
+	// Mode is the file mode of the sockets, in octal. Defaults to 0600.
+	Mode string
+	// Owner is the name or ID of the user owning the sockets.
+	Owner string
+	// Group is the name or ID of the group owning the sockets.
+	Group string
+}
+
+// isUnixAddr returns true if addr is the address of a Unix domain socket.
+func isUnixAddr(addr ma.Multiaddr) bool {
+	_, err := addr.ValueForProtocol(ma.P_UNIX)
+	return err == nil
+}
+
+// listenAPISocket listens on the Unix domain socket of addr and sets its
+// permissions. A socket file left by a daemon that did not shut down cleanly
+// is removed first.
+func listenAPISocket(addr ma.Multiaddr, r repo.Repo) (manet.Listener, error) {
+	cfg := apiSocketConfig{Mode: defaultAPISocketMode}
+	if _, err := repo.ReadConfigKey(r, apiSocketSelector, &cfg); err != nil {
+		return nil, err
+	}
+	if cfg.Mode == "" {
+		cfg.Mode = defaultAPISocketMode
+	}
+	mode, err := strconv.ParseUint(cfg.Mode, 8, 32)
+	if err != nil {
+		return nil, fmt.Errorf("%s: invalid mode %q: %s", apiSocketSelector, cfg.Mode, err)
+	}
+	uid, gid, err := lookupOwner(cfg.Owner, cfg.Group)
+	if err != nil {
+		return nil, err
+	}
+
+	path, err := addr.ValueForProtocol(ma.P_UNIX)
+	if err != nil {
+		return nil, err
+	}
+	if err := removeStaleSocket(path); err != nil {
+		return nil, err
+	}
+
+	lis, err := manet.Listen(addr)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, os.FileMode(mode)); err != nil {
+		lis.Close()
+		return nil, err
+	}
+	if uid != -1 || gid != -1 {
+		if err := os.Chown(path, uid, gid); err != nil {
+			lis.Close()
+			return nil, err
+		}
+	}
+	return lis, nil
+}
+
+// removeStaleSocket removes the socket file at path if no process accepts
+// connections on it.
+func removeStaleSocket(path string) error {
+	fi, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if fi.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and is not a socket", path)
+	}
+
+	conn, err := net.DialTimeout("unix", path, time.Second)
+	if err == nil {
+		conn.Close()
+		return fmt.Errorf("%s is in use, is another daemon running?", path)
+	}
+	log.Infof("removing stale API socket %s", path)
+	return os.Remove(path)
+}
+
+// lookupOwner returns the IDs of the user and group, given by name or ID, or
+// -1 when not set.
+func lookupOwner(owner, group string) (int, int, error) {
+	uid, gid := -1, -1
+	if owner != "" {
+		u, err := user.Lookup(owner)
+		if err != nil {
+			u, err = user.LookupId(owner)
+		}
+		if err != nil {
+			return 0, 0, fmt.Errorf("%s: unknown owner %q", apiSocketSelector, owner)
+		}
+		if uid, err = strconv.Atoi(u.Uid); err != nil {
+			return 0, 0, fmt.Errorf("%s: owner %q has no numeric ID", apiSocketSelector, owner)
+		}
+	}
+	if group != "" {
+		g, err := user.LookupGroup(group)
+		if err != nil {
+			g, err = user.LookupGroupId(group)
+		}
+		if err != nil {
+			return 0, 0, fmt.Errorf("%s: unknown group %q", apiSocketSelector, group)
+		}
+		if gid, err = strconv.Atoi(g.Gid); err != nil {
+			return 0, 0, fmt.Errorf("%s: group %q has no numeric ID", apiSocketSelector, group)
+		}
+	}
+	return uid, gid, nil
+}
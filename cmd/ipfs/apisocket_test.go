@@ -0,0 +1,68 @@
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/ipfs/go-ipfs/repo"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+func TestListenAPISocket(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes of sockets are not supported on windows")
+	}
+
+	dir, err := ioutil.TempDir("", "apisocket")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "api.sock")
+
+	// a socket left behind by a daemon that did not shut down cleanly
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	addr, err := ma.NewMultiaddr("/unix" + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isUnixAddr(addr) {
+		t.Fatalf("expected %s to be a unix address", addr)
+	}
+
+	lis, err := listenAPISocket(addr, &repo.Mock{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := fi.Mode().Perm(); mode != 0600 {
+		t.Errorf("expected mode 0600, got %o", mode)
+	}
+
+	// the socket is in use now
+	if _, err := listenAPISocket(addr, &repo.Mock{}); err == nil {
+		t.Error("expected listening on a socket in use to fail")
+	}
+
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+}
@@ -42,6 +42,7 @@ import (
 const (
 	adjustFDLimitKwd          = "manage-fdlimit"
 	enableGCKwd               = "enable-gc"
+	incrementalGCKwd          = "incremental-gc"
 	initOptionKwd             = "init"
 	initConfigOptionKwd       = "init-config"
 	initProfileOptionKwd      = "init-profile"
@@ -171,6 +172,7 @@ Headers.
 		cmds.BoolOption(unrestrictedApiAccessKwd, "Allow API access to unlisted hashes"),
 		cmds.BoolOption(unencryptTransportKwd, "Disable transport encryption (for debugging protocols)"),
 		cmds.BoolOption(enableGCKwd, "Enable automatic periodic repo garbage collection"),
+		cmds.BoolOption(incrementalGCKwd, "Use the incremental collector for automatic repo garbage collection"),
 		cmds.BoolOption(adjustFDLimitKwd, "Check and raise file descriptor limits if needed").WithDefault(true),
 		cmds.BoolOption(migrateKwd, "If true, assume yes at the migrate prompt. If false, assume no."),
 		cmds.BoolOption(enablePubSubKwd, "Instantiate the ipfs daemon with the experimental pubsub feature enabled."),
@@ -444,6 +446,12 @@ func daemonFunc(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment
 	// start MFS pinning thread
 	startPinMFS(daemonConfigPollInterval, cctx, &ipfsPinMFSNode{node})
 
+	// start removing expired pins
+	startPinExpiry(cctx.Context(), pinExpiryInterval, node)
+
+	// reload the config and the denylists on SIGHUP
+	reloadOnSignal(node)
+
 	// The daemon is *finally* ready.
 	fmt.Printf("Daemon is ready\n")
 	notifyReady()
@@ -475,6 +483,11 @@ func serveHTTPApi(req *cmds.Request, cctx *oldcmds.Context) (<-chan error, error
 		return nil, fmt.Errorf("serveHTTPApi: GetConfig() failed: %s", err)
 	}
 
+	node, err := cctx.ConstructNode()
+	if err != nil {
+		return nil, fmt.Errorf("serveHTTPApi: ConstructNode() failed: %s", err)
+	}
+
 	listeners, err := sockets.TakeListeners("io.ipfs.api")
 	if err != nil {
 		return nil, fmt.Errorf("serveHTTPApi: socket activation failed: %s", err)
@@ -502,7 +515,12 @@ func serveHTTPApi(req *cmds.Request, cctx *oldcmds.Context) (<-chan error, error
 			continue
 		}
 
-		apiLis, err := manet.Listen(apiMaddr)
+		var apiLis manet.Listener
+		if isUnixAddr(apiMaddr) {
+			apiLis, err = listenAPISocket(apiMaddr, node.Repo)
+		} else {
+			apiLis, err = manet.Listen(apiMaddr)
+		}
 		if err != nil {
 			return nil, fmt.Errorf("serveHTTPApi: manet.Listen(%s) failed: %s", apiMaddr, err)
 		}
@@ -543,6 +561,9 @@ func serveHTTPApi(req *cmds.Request, cctx *oldcmds.Context) (<-chan error, error
 		defaultMux("/debug/pprof/"),
 		corehttp.MutexFractionOption("/debug/pprof-mutex/"),
 		corehttp.MetricsScrapingOption("/debug/metrics/prometheus"),
+		corehttp.HealthOption("/debug/health"),
+		corehttp.ReadinessOption("/debug/ready"),
+		corehttp.LivenessOption("/debug/live"),
 		corehttp.LogOption(),
 	}
 
@@ -550,12 +571,16 @@ func serveHTTPApi(req *cmds.Request, cctx *oldcmds.Context) (<-chan error, error
 		opts = append(opts, corehttp.RedirectOption("", cfg.Gateway.RootRedirect))
 	}
 
-	node, err := cctx.ConstructNode()
-	if err != nil {
-		return nil, fmt.Errorf("serveHTTPApi: ConstructNode() failed: %s", err)
+	// Clients on this host use the socket when there is one: unlike TCP
+	// ports, its permissions restrict who can connect.
+	apiFileAddr := listeners[0].Multiaddr()
+	for _, lis := range listeners {
+		if isUnixAddr(lis.Multiaddr()) {
+			apiFileAddr = lis.Multiaddr()
+			break
+		}
 	}
-
-	if err := node.Repo.SetAPIAddr(listeners[0].Multiaddr()); err != nil {
+	if err := node.Repo.SetAPIAddr(apiFileAddr); err != nil {
 		return nil, fmt.Errorf("serveHTTPApi: SetAPIAddr() failed: %s", err)
 	}
 
@@ -663,7 +688,12 @@ func serveHTTPGateway(req *cmds.Request, cctx *oldcmds.Context) (<-chan error, e
 	cmdctx.Gateway = true
 
 	var opts = []corehttp.ServeOption{
+		// probes are neither rate limited nor routed by hostname
+		corehttp.HealthOption("/debug/health"),
+		corehttp.ReadinessOption("/debug/ready"),
+		corehttp.LivenessOption("/debug/live"),
 		corehttp.MetricsCollectionOption("gateway"),
+		corehttp.RateLimitOption(),
 		corehttp.HostnameOption(),
 		corehttp.GatewayOption(writable, "/ipfs", "/ipns"),
 		corehttp.VersionOption(),
@@ -743,9 +773,14 @@ func maybeRunGC(req *cmds.Request, node *core.IpfsNode) (<-chan error, error) {
 		return nil, nil
 	}
 
+	periodicGC := corerepo.PeriodicGC
+	if incremental, _ := req.Options[incrementalGCKwd].(bool); incremental {
+		periodicGC = corerepo.PeriodicIncrementalGC
+	}
+
 	errc := make(chan error)
 	go func() {
-		errc <- corerepo.PeriodicGC(req.Context, node)
+		errc <- periodicGC(req.Context, node)
 		close(errc)
 	}()
 	return errc, nil
@@ -25,6 +25,7 @@ import (
 	"github.com/ipfs/go-ipfs-cmds/cli"
 	cmdhttp "github.com/ipfs/go-ipfs-cmds/http"
 	config "github.com/ipfs/go-ipfs-config"
+	serialize "github.com/ipfs/go-ipfs-config/serialize"
 	u "github.com/ipfs/go-ipfs-util"
 	logging "github.com/ipfs/go-log"
 	loggables "github.com/libp2p/go-libp2p-loggables"
@@ -41,6 +42,7 @@ var dnsResolver = madns.DefaultResolver
 
 const (
 	EnvEnableProfiling = "IPFS_PROF"
+	EnvAPIToken        = "IPFS_API_TOKEN"
 	cpuProfile         = "ipfs.cpuprof"
 	heapProfile        = "ipfs.memprof"
 )
@@ -274,25 +276,76 @@ func makeExecutor(req *cmds.Request, env interface{}) (cmds.Executor, error) {
 		opts = append(opts, cmdhttp.ClientWithFallback(exe))
 	}
 
+	var transport http.RoundTripper
 	switch network {
 	case "tcp", "tcp4", "tcp6":
 	case "unix":
 		path := host
 		host = "unix"
-		opts = append(opts, cmdhttp.ClientWithHTTPClient(&http.Client{
-			Transport: &http.Transport{
-				DialContext: func(_ context.Context, _, _ string) (net.Conn, error) {
-					return net.Dial("unix", path)
-				},
+		transport = &http.Transport{
+			DialContext: func(_ context.Context, _, _ string) (net.Conn, error) {
+				return net.Dial("unix", path)
 			},
-		}))
+		}
 	default:
 		return nil, fmt.Errorf("unsupported API address: %s", apiAddr)
 	}
 
+	token, err := apiToken(cctx.ConfigRoot)
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		if transport == nil {
+			transport = http.DefaultTransport
+		}
+		transport = &tokenTransport{token: token, base: transport}
+	}
+	if transport != nil {
+		opts = append(opts, cmdhttp.ClientWithHTTPClient(&http.Client{Transport: transport}))
+	}
+
 	return cmdhttp.NewClient(host, opts...), nil
 }
 
+// apiToken returns the token authenticating calls to the API: the
+// IPFS_API_TOKEN environment variable, or else API.ClientToken in the config.
+func apiToken(repoPath string) (string, error) {
+	if token := os.Getenv(EnvAPIToken); token != "" {
+		return token, nil
+	}
+	if !fsrepo.IsInitialized(repoPath) {
+		return "", nil
+	}
+
+	filename, err := config.Filename(repoPath)
+	if err != nil {
+		return "", err
+	}
+	// API.ClientToken is not part of config.Config, read the file as is.
+	var cfg struct {
+		API struct {
+			ClientToken string
+		}
+	}
+	if err := serialize.ReadConfigFile(filename, &cfg); err != nil {
+		return "", err
+	}
+	return cfg.API.ClientToken, nil
+}
+
+// tokenTransport sets the bearer token of the requests to the API.
+type tokenTransport struct {
+	token string
+	base  http.RoundTripper
+}
+
+func (t *tokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+t.token)
+	return t.base.RoundTrip(req)
+}
+
 func getRepoPath(req *cmds.Request) (string, error) {
 	repoOpt, found := req.Options["config"].(string)
 	if found && repoOpt != "" {
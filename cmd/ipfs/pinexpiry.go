@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	logging "github.com/ipfs/go-log"
+
+	"github.com/ipfs/go-ipfs/core"
+	"github.com/ipfs/go-ipfs/pinmeta"
+)
+
+// expirylog is the logger for the removal of expired pins
+var expirylog = logging.Logger("pinning/expiry")
+
+const pinExpiryInterval = time.Minute
+
+// startPinExpiry periodically removes the pins that have expired until ctx
+// is done.
+func startPinExpiry(ctx context.Context, interval time.Duration, node *core.IpfsNode) {
+	pinner, ok := node.Pinning.(*pinmeta.Pinner)
+	if !ok {
+		expirylog.Warn("pinner does not support expiries, expired pins will not be removed")
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			removeExpiredPins(ctx, node, pinner)
+
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+func removeExpiredPins(ctx context.Context, node *core.IpfsNode, pinner *pinmeta.Pinner) {
+	defer node.Blockstore.PinLock().Unlock()
+
+	removed, err := pinner.RemoveExpired(ctx)
+	for _, c := range removed {
+		expirylog.Infof("removed expired pin %s", c)
+	}
+	if err != nil {
+		expirylog.Errorf("removing expired pins: %s", err)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-merkledag"
+
+	"github.com/ipfs/go-ipfs/core"
+	"github.com/ipfs/go-ipfs/pinmeta"
+)
+
+func TestPinExpiry(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	node, err := core.NewNode(ctx, &core.BuildCfg{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer node.Close()
+
+	expiring := merkledag.NodeWithData([]byte("expiring"))
+	permanent := merkledag.NodeWithData([]byte("permanent"))
+	for nd, expires := range map[*merkledag.ProtoNode]time.Time{
+		expiring:  time.Now().Add(100 * time.Millisecond),
+		permanent: {},
+	} {
+		if err := node.DAG.Add(ctx, nd); err != nil {
+			t.Fatal(err)
+		}
+		if err := node.Pinning.Pin(ctx, nd, true); err != nil {
+			t.Fatal(err)
+		}
+		if err := node.PinMeta.Put(nd.Cid(), pinmeta.Info{Expires: expires}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := node.Pinning.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	startPinExpiry(ctx, 10*time.Millisecond, node)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		_, pinned, err := node.Pinning.IsPinned(ctx, expiring.Cid())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !pinned {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expired pin not removed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if _, pinned, err := node.Pinning.IsPinned(ctx, permanent.Cid()); err != nil || !pinned {
+		t.Fatalf("permanent pin removed: %v", err)
+	}
+	if _, ok, err := node.PinMeta.Get(expiring.Cid()); err != nil || ok {
+		t.Fatalf("information of the expired pin not removed: %v", err)
+	}
+}
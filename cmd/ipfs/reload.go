@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	utilmain "github.com/ipfs/go-ipfs/cmd/ipfs/util"
+	"github.com/ipfs/go-ipfs/core"
+)
+
+// reloadOnSignal reloads the config and the denylists of the node on SIGHUP,
+// instead of shutting down, until the node shuts down.
+func reloadOnSignal(node *core.IpfsNode) {
+	restore := utilmain.HandleHangup(func() {
+		reloadNode(node)
+	})
+	go func() {
+		<-node.Process.Closing()
+		restore()
+	}()
+}
+
+func reloadNode(node *core.IpfsNode) {
+	res, err := node.ReloadConfig()
+	if err != nil {
+		log.Errorf("reloading the config: %s", err)
+	} else {
+		fmt.Println("Config reloaded")
+		if len(res.Applied) > 0 {
+			fmt.Printf("Applied: %s\n", strings.Join(res.Applied, ", "))
+		}
+		if len(res.NeedRestart) > 0 {
+			fmt.Printf("Restart needed for: %s\n", strings.Join(res.NeedRestart, ", "))
+		}
+	}
+
+	if _, err := node.Denylist.Reload(); err != nil {
+		log.Errorf("reloading the denylists: %s", err)
+	}
+}
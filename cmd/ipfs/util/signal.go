@@ -55,12 +55,38 @@ func (ih *IntrHandler) Handle(handler func(count int, ih *IntrHandler), sigs ...
 	}()
 }
 
+// hangup is the handler of SIGHUP set with HandleHangup, if any.
+var hangup struct {
+	sync.Mutex
+	handler func()
+}
+
+// HandleHangup makes the interrupt handler call f on SIGHUP, instead of
+// handling it as an interrupt, until restore is called.
+func HandleHangup(f func()) (restore func()) {
+	hangup.Lock()
+	hangup.handler = f
+	hangup.Unlock()
+	return func() {
+		hangup.Lock()
+		hangup.handler = nil
+		hangup.Unlock()
+	}
+}
+
 func SetupInterruptHandler(ctx context.Context) (io.Closer, context.Context) {
 	intrh := NewIntrHandler()
 	ctx, cancelFunc := context.WithCancel(ctx)
 
-	handlerFunc := func(count int, ih *IntrHandler) {
-		switch count {
+	var lk sync.Mutex
+	count := 0
+	handlerFunc := func(_ int, ih *IntrHandler) {
+		lk.Lock()
+		count++
+		n := count
+		lk.Unlock()
+
+		switch n {
 		case 1:
 			fmt.Println() // Prevent un-terminated ^C character in terminal
 
@@ -76,7 +102,19 @@ func SetupInterruptHandler(ctx context.Context) (io.Closer, context.Context) {
 		}
 	}
 
-	intrh.Handle(handlerFunc, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM)
+	intrh.Handle(handlerFunc, syscall.SIGINT, syscall.SIGTERM)
+	// SIGHUP is handled apart, so that interrupts are still handled while
+	// its handler runs
+	intrh.Handle(func(count int, ih *IntrHandler) {
+		hangup.Lock()
+		f := hangup.handler
+		hangup.Unlock()
+		if f != nil {
+			f()
+			return
+		}
+		handlerFunc(count, ih)
+	}, syscall.SIGHUP)
 
 	return intrh, ctx
 }
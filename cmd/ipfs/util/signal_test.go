@@ -0,0 +1,43 @@
+// +build !windows,!wasm
+
+package util
+
+import (
+	"context"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestHangup(t *testing.T) {
+	intrh, ctx := SetupInterruptHandler(context.Background())
+	defer intrh.Close()
+
+	reloaded := make(chan struct{}, 1)
+	restore := HandleHangup(func() {
+		reloaded <- struct{}{}
+	})
+
+	if err := syscall.Kill(syscall.Getpid(), syscall.SIGHUP); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-reloaded:
+	case <-time.After(5 * time.Second):
+		t.Fatal("SIGHUP not handled")
+	}
+	if ctx.Err() != nil {
+		t.Fatal("SIGHUP handled as an interrupt while a handler is set")
+	}
+
+	// SIGHUP is an interrupt again once restored
+	restore()
+	if err := syscall.Kill(syscall.Getpid(), syscall.SIGHUP); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("SIGHUP not handled as an interrupt")
+	}
+}
@@ -16,3 +16,7 @@ func SetupInterruptHandler(ctx context.Context) (io.Closer, context.Context) {
 	ctx, cancel := context.WithCancel(ctx)
 	return ctxCloser(cancel), ctx
 }
+
+func HandleHangup(f func()) (restore func()) {
+	return func() {}
+}
@@ -82,6 +82,11 @@ func NewNode(ctx context.Context, cfg *BuildCfg) (*IpfsNode, error) {
 		return nil, err
 	}
 
+	if err := n.initConfigReload(); err != nil {
+		n.stop()
+		return nil, err
+	}
+
 	// TODO: How soon will bootstrap move to libp2p?
 	if !cfg.Online {
 		return n, nil
@@ -0,0 +1,121 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ipfs/go-ipfs/audit"
+	"github.com/ipfs/go-ipfs/core/commands/cmdenv"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+)
+
+const (
+	auditCommandOptionName = "command"
+	auditTokenOptionName   = "token"
+	auditSinceOptionName   = "since"
+	auditLimitOptionName   = "limit"
+	auditFailedOptionName  = "failed"
+)
+
+var diagAuditCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "List the API calls recorded in the audit log.",
+		ShortDescription: `
+Lists the calls to the API recorded in the audit log of the repo, oldest
+first. The audit log is enabled with API.Audit in the config: it records the
+calls to the commands changing pins, keys, the config and IPNS names, who made
+them and their outcome.
+`,
+		LongDescription: `
+Lists the calls to the API recorded in the audit log of the repo, oldest
+first. The audit log is enabled with API.Audit in the config: it records the
+calls to the commands changing pins, keys, the config and IPNS names, who made
+them and their outcome.
+
+Entries can be filtered by command path, token and age:
+
+  # Pins added or removed in the last day
+  ipfs diag audit --command=pin --since=24h
+
+  # The last 10 failed calls
+  ipfs diag audit --failed --limit=10
+`,
+	},
+	Options: []cmds.Option{
+		cmds.StringOption(auditCommandOptionName, "c", "Only list calls to this command and its subcommands."),
+		cmds.StringOption(auditTokenOptionName, "t", "Only list calls made with this token."),
+		cmds.StringOption(auditSinceOptionName, "s", "Only list calls made within this duration, e.g. '24h'."),
+		cmds.IntOption(auditLimitOptionName, "n", "Only list the last n calls."),
+		cmds.BoolOption(auditFailedOptionName, "Only list failed calls."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		cfgRoot, err := cmdenv.GetConfigRoot(env)
+		if err != nil {
+			return err
+		}
+
+		command, _ := req.Options[auditCommandOptionName].(string)
+		token, _ := req.Options[auditTokenOptionName].(string)
+		failed, _ := req.Options[auditFailedOptionName].(bool)
+		limit, _ := req.Options[auditLimitOptionName].(int)
+		if limit < 0 {
+			return fmt.Errorf("invalid limit %d", limit)
+		}
+		var since time.Time
+		if s, ok := req.Options[auditSinceOptionName].(string); ok {
+			d, err := time.ParseDuration(s)
+			if err != nil {
+				return fmt.Errorf("invalid duration %q: %s", s, err)
+			}
+			since = time.Now().Add(-d)
+		}
+
+		var entries []audit.Entry
+		err = audit.Read(filepath.Join(cfgRoot, audit.DirName), func(e audit.Entry) error {
+			switch {
+			case command != "" && !audit.MatchCommand([]string{command}, e.Command):
+			case token != "" && e.Token != token:
+			case !since.IsZero() && e.Time.Before(since):
+			case failed && e.Error == "" && e.Status < 400:
+			default:
+				entries = append(entries, e)
+				if limit > 0 && len(entries) > limit {
+					entries = entries[1:]
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for i := range entries {
+			if err := res.Emit(&entries[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	Type: audit.Entry{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, e *audit.Entry) error {
+			token := e.Token
+			if token == "" {
+				token = "-"
+			}
+			fmt.Fprintf(w, "%s %s %s %d %s", e.Time.Format(time.RFC3339), e.Remote, token, e.Status, e.Command)
+			if len(e.Arguments) > 0 {
+				fmt.Fprintf(w, " %s", strings.Join(e.Arguments, " "))
+			}
+			if e.Error != "" {
+				fmt.Fprintf(w, " (%s)", e.Error)
+			}
+			fmt.Fprintln(w)
+			return nil
+		}),
+	},
+}
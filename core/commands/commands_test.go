@@ -90,6 +90,7 @@ func TestCommands(t *testing.T) {
 		"/commands",
 		"/config",
 		"/config/edit",
+		"/config/reload",
 		"/config/replace",
 		"/config/show",
 		"/config/profile",
@@ -101,6 +102,9 @@ func TestCommands(t *testing.T) {
 		"/dag/import",
 		"/dag/resolve",
 		"/dag/stat",
+		"/denylist",
+		"/denylist/hash",
+		"/denylist/reload",
 		"/dht",
 		"/dht/findpeer",
 		"/dht/findprovs",
@@ -109,6 +113,7 @@ func TestCommands(t *testing.T) {
 		"/dht/put",
 		"/dht/query",
 		"/diag",
+		"/diag/audit",
 		"/diag/cmds",
 		"/diag/cmds/clear",
 		"/diag/cmds/set-time",
@@ -168,10 +173,15 @@ func TestCommands(t *testing.T) {
 		"/object/put",
 		"/object/stat",
 		"/p2p",
+		"/p2p/allow",
+		"/p2p/allow/add",
+		"/p2p/allow/ls",
+		"/p2p/allow/rm",
 		"/p2p/close",
 		"/p2p/forward",
 		"/p2p/listen",
 		"/p2p/ls",
+		"/p2p/proxy",
 		"/p2p/stream",
 		"/p2p/stream/close",
 		"/p2p/stream/ls",
@@ -182,6 +192,7 @@ func TestCommands(t *testing.T) {
 		"/pin/remote/add",
 		"/pin/remote/ls",
 		"/pin/remote/rm",
+		"/pin/remote/sync",
 		"/pin/remote/service",
 		"/pin/remote/service/add",
 		"/pin/remote/service/ls",
@@ -219,6 +230,10 @@ func TestCommands(t *testing.T) {
 		"/swarm/filters",
 		"/swarm/filters/add",
 		"/swarm/filters/rm",
+		"/swarm/peering",
+		"/swarm/peering/add",
+		"/swarm/peering/ls",
+		"/swarm/peering/rm",
 		"/swarm/peers",
 		"/tar",
 		"/tar/add",
@@ -10,6 +10,7 @@ import (
 	"os/exec"
 	"strings"
 
+	"github.com/ipfs/go-ipfs/core"
 	"github.com/ipfs/go-ipfs/core/commands/cmdenv"
 	"github.com/ipfs/go-ipfs/repo"
 	"github.com/ipfs/go-ipfs/repo/fsrepo"
@@ -30,6 +31,15 @@ type ConfigField struct {
 	Value interface{}
 }
 
+// secretConfigSelectors are the config keys holding the tokens of the API and
+// the gateway. Like the private key, they can't be shown or changed with
+// 'ipfs config', or a token allowing it would give access to every other.
+var secretConfigSelectors = [][]string{
+	{"API", "Tokens"},
+	{"API", "ClientToken"},
+	{"Gateway", "WriteTokens"},
+}
+
 const (
 	configBoolOptionName   = "bool"
 	configJSONOptionName   = "json"
@@ -63,6 +73,7 @@ Set the value of the 'Datastore.Path' key:
 		"edit":    configEditCmd,
 		"replace": configReplaceCmd,
 		"profile": configProfileCmd,
+		"reload":  configReloadCmd,
 	},
 	Arguments: []cmds.Argument{
 		cmds.StringArg("key", true, false, "The key of the config entry (e.g. \"Addresses.API\")."),
@@ -91,6 +102,10 @@ Set the value of the 'Datastore.Path' key:
 			return errors.New("cannot show or change pinning services credentials")
 		}
 
+		if isSecretConfigKey(key) {
+			return errors.New("cannot show or change API and gateway tokens, edit the config file instead")
+		}
+
 		cfgRoot, err := cmdenv.GetConfigRoot(env)
 		if err != nil {
 			return err
@@ -176,7 +191,7 @@ var configShowCmd = &cmds.Command{
 	Helptext: cmds.HelpText{
 		Tagline: "Output config file contents.",
 		ShortDescription: `
-NOTE: For security reasons, this command will omit your private key and remote services. If you would like to make a full backup of your config (private key included), you must copy the config file from your repo.
+NOTE: For security reasons, this command will omit your private key, remote services, and API and gateway tokens. If you would like to make a full backup of your config (private key included), you must copy the config file from your repo.
 `,
 	},
 	Type: make(map[string]interface{}),
@@ -212,6 +227,11 @@ NOTE: For security reasons, this command will omit your private key and remote s
 			return err
 		}
 
+		cfg, err = scrubSecrets(cfg)
+		if err != nil {
+			return err
+		}
+
 		return cmds.EmitOnce(res, &cfg)
 	},
 	Encoders: cmds.EncoderMap{
@@ -227,6 +247,28 @@ NOTE: For security reasons, this command will omit your private key and remote s
 	},
 }
 
+// isSecretConfigKey returns whether the key is one of secretConfigSelectors,
+// is under one, or holds one.
+func isSecretConfigKey(key string) bool {
+	for _, selector := range secretConfigSelectors {
+		if matchesGlobPrefix(key, selector) {
+			return true
+		}
+	}
+	return false
+}
+
+// scrubSecrets scrubs the tokens of secretConfigSelectors.
+func scrubSecrets(m map[string]interface{}) (map[string]interface{}, error) {
+	for _, selector := range secretConfigSelectors {
+		var err error
+		if m, err = scrubOptionalValue(m, selector); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
 // Scrubs value and returns error if missing
 func scrubValue(m map[string]interface{}, key []string) (map[string]interface{}, error) {
 	return scrubMapInternal(m, key, false)
@@ -332,6 +374,55 @@ can't be undone.
 	},
 }
 
+var configReloadCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Apply the changes of the config file to the running daemon.",
+		ShortDescription: `
+Reads the config file again and applies the changed keys to the running
+daemon, without dropping its connections. The daemon does the same on SIGHUP.
+
+These keys are applied at once:
+
+  Bootstrap
+  Gateway.HTTPHeaders
+  Peering.Peers
+  Pinning.RemoteServices
+
+Changes to other keys, such as Swarm.ConnMgr, are listed: they take effect
+when the daemon restarts.
+`,
+	},
+	NoLocal: true,
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+
+		out, err := n.ReloadConfig()
+		if err != nil {
+			return err
+		}
+		return cmds.EmitOnce(res, out)
+	},
+	Type: core.ConfigReload{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *core.ConfigReload) error {
+			if len(out.Applied) == 0 && len(out.NeedRestart) == 0 {
+				fmt.Fprintln(w, "config unchanged")
+				return nil
+			}
+			for _, key := range out.Applied {
+				fmt.Fprintf(w, "applied %s\n", key)
+			}
+			for _, key := range out.NeedRestart {
+				fmt.Fprintf(w, "restart needed for %s\n", key)
+			}
+			return nil
+		}),
+	},
+}
+
 var configProfileCmd = &cmds.Command{
 	Helptext: cmds.HelpText{
 		Tagline: "Apply profiles to config.",
@@ -415,7 +506,7 @@ func buildProfileHelp() string {
 	return out
 }
 
-// scrubPrivKey scrubs private key for security reasons.
+// scrubPrivKey scrubs private key and tokens for security reasons.
 func scrubPrivKey(cfg *config.Config) (map[string]interface{}, error) {
 	cfgMap, err := config.ToMap(cfg)
 	if err != nil {
@@ -427,7 +518,7 @@ func scrubPrivKey(cfg *config.Config) (map[string]interface{}, error) {
 		return nil, err
 	}
 
-	return cfgMap, nil
+	return scrubSecrets(cfgMap)
 }
 
 // transformConfig returns old config and new config instead of difference between they,
@@ -15,3 +15,49 @@ func TestScrubMapInternalDelete(t *testing.T) {
 
 	}
 }
+
+func TestSecretConfigKeys(t *testing.T) {
+	for key, secret := range map[string]bool{
+		"API":                  true,
+		"api.tokens":           true,
+		"API.Tokens.0.Token":   true,
+		"API.ClientToken":      true,
+		"Gateway":              true,
+		"Gateway.WriteTokens":  true,
+		"API.HTTPHeaders":      false,
+		"Gateway.HTTPHeaders":  false,
+		"Gateway.NoFetch":      false,
+		"Addresses.API":        false,
+		"Datastore.StorageMax": false,
+	} {
+		if isSecretConfigKey(key) != secret {
+			t.Errorf("expected %s to be secret: %t", key, secret)
+		}
+	}
+}
+
+func TestScrubSecrets(t *testing.T) {
+	cfg := map[string]interface{}{
+		"API": map[string]interface{}{
+			"HTTPHeaders": map[string]interface{}{},
+			"Tokens":      []interface{}{map[string]interface{}{"Token": "secret"}},
+			"ClientToken": "secret",
+		},
+		"Gateway": map[string]interface{}{
+			"Writable":    true,
+			"WriteTokens": []interface{}{map[string]interface{}{"Token": "secret"}},
+		},
+	}
+	scrubbed, err := scrubSecrets(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	api := scrubbed["API"].(map[string]interface{})
+	gw := scrubbed["Gateway"].(map[string]interface{})
+	if len(api) != 1 || api["HTTPHeaders"] == nil {
+		t.Errorf("expected only API.HTTPHeaders to be kept, got %v", api)
+	}
+	if len(gw) != 1 || gw["Writable"] != true {
+		t.Errorf("expected only Gateway.Writable to be kept, got %v", gw)
+	}
+}
@@ -0,0 +1,116 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	cid "github.com/ipfs/go-cid"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	"github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	"github.com/ipfs/go-ipfs/denylist"
+)
+
+var DenylistCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Manage the content the node refuses to serve.",
+		ShortDescription: `
+Denylists are the '*.deny' files in the 'denylists' directory of the repo.
+Content they list is not served by the gateway, 'ipfs cat', 'ipfs get' and
+bitswap: the gateway answers with 410 Gone.
+
+Each line of a denylist is one of:
+
+  /ipfs/<cid>             the CID, and every path under it
+  /ipfs/<cid>/<subpath>   the subpath of the CID, and every path under it
+  //<multihash>           a double-hashed entry, see 'ipfs denylist hash'
+
+Lines starting with # are comments.
+`,
+	},
+	Subcommands: map[string]*cmds.Command{
+		"reload": denylistReloadCmd,
+		"hash":   denylistHashCmd,
+	},
+}
+
+type DenylistReloadOutput struct {
+	Entries int
+}
+
+var denylistReloadCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Read the denylists again.",
+		ShortDescription: `
+Reads the denylist files of the repo again, without restarting the daemon.
+The previous entries are kept if a file is invalid.
+`,
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+
+		count, err := n.Denylist.Reload()
+		if err != nil {
+			return err
+		}
+		return cmds.EmitOnce(res, &DenylistReloadOutput{Entries: count})
+	},
+	Type: DenylistReloadOutput{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *DenylistReloadOutput) error {
+			fmt.Fprintf(w, "loaded %d denylist entries\n", out.Entries)
+			return nil
+		}),
+	},
+}
+
+type DenylistHashOutput struct {
+	Entry string
+}
+
+var denylistHashCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Compute the double-hashed denylist entry of a path.",
+		ShortDescription: `
+Prints the double-hashed entry blocking /ipfs/<cid>, or /ipfs/<cid>/<subpath>.
+Unlike the path, the entry does not reveal the content it blocks:
+
+  $ ipfs denylist hash /ipfs/bafkqaaa
+  //QmXHZ4vcKzJ2LnPM9QiDfMYDnpHM8EhZSW81LdZvYqdAEh
+
+It is the sha2-256 multihash, in base58btc, of the CIDv1 in base32 followed
+by "/" and the subpath.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("ipfs-path", true, false, "Path to compute the entry of."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		parts := strings.SplitN(strings.TrimPrefix(req.Arguments[0], "/ipfs/"), "/", 2)
+		c, err := cid.Decode(parts[0])
+		if err != nil {
+			return fmt.Errorf("invalid path %q: %s", req.Arguments[0], err)
+		}
+		var subpath string
+		if len(parts) == 2 {
+			subpath = parts[1]
+		}
+
+		h, err := denylist.DoubleHash(c, subpath)
+		if err != nil {
+			return err
+		}
+		return cmds.EmitOnce(res, &DenylistHashOutput{Entry: "//" + h.B58String()})
+	},
+	Type: DenylistHashOutput{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *DenylistHashOutput) error {
+			fmt.Fprintln(w, out.Entry)
+			return nil
+		}),
+	},
+	Extra: CreateCmdExtras(SetDoesNotUseRepo(true)),
+}
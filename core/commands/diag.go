@@ -10,7 +10,8 @@ var DiagCmd = &cmds.Command{
 	},
 
 	Subcommands: map[string]*cmds.Command{
-		"sys":  sysDiagCmd,
-		"cmds": ActiveReqsCmd,
+		"sys":   sysDiagCmd,
+		"cmds":  ActiveReqsCmd,
+		"audit": diagAuditCmd,
 	},
 }
@@ -262,7 +262,14 @@ func (i *identityWriteCloser) Close() error {
 	return nil
 }
 
-func fileArchive(f files.Node, name string, archive bool, compression int) (io.Reader, error) {
+// TarArchive returns the TAR archive of f output by 'ipfs get --archive',
+// with name as the root entry. The archive is written while it is read;
+// closing the reader stops the writing.
+func TarArchive(f files.Node, name string) (io.ReadCloser, error) {
+	return fileArchive(f, name, true, gzip.NoCompression)
+}
+
+func fileArchive(f files.Node, name string, archive bool, compression int) (io.ReadCloser, error) {
 	cleaned := gopath.Clean(name)
 	_, filename := gopath.Split(cleaned)
 
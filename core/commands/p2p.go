@@ -5,15 +5,19 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"text/tabwriter"
 	"time"
 
 	core "github.com/ipfs/go-ipfs/core"
 	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
 	p2p "github.com/ipfs/go-ipfs/p2p"
+	repo "github.com/ipfs/go-ipfs/repo"
 
+	humanize "github.com/dustin/go-humanize"
 	cmds "github.com/ipfs/go-ipfs-cmds"
 	peer "github.com/libp2p/go-libp2p-core/peer"
 	pstore "github.com/libp2p/go-libp2p-core/peerstore"
@@ -30,6 +34,13 @@ type P2PListenerInfoOutput struct {
 	Protocol      string
 	ListenAddress string
 	TargetAddress string
+	AllowedPeers  []string `json:",omitempty"`
+	AllowlistFile string   `json:",omitempty"`
+	Streams       int
+	MaxStreams    int   `json:",omitempty"`
+	Bandwidth     int64 `json:",omitempty"`
+	BytesIn       int64
+	BytesOut      int64
 }
 
 // P2PStreamInfoOutput is output type of streams command
@@ -38,6 +49,8 @@ type P2PStreamInfoOutput struct {
 	Protocol      string
 	OriginAddress string
 	TargetAddress string
+	BytesIn       int64
+	BytesOut      int64
 }
 
 // P2PLsOutput is output type of ls command
@@ -53,6 +66,12 @@ type P2PStreamsOutput struct {
 const (
 	allowCustomProtocolOptionName = "allow-custom-protocol"
 	reportPeerIDOptionName        = "report-peer-id"
+	allowPeerOptionName           = "allow-peer"
+	allowlistFileOptionName       = "allowlist-file"
+	p2pPersistOptionName          = "persist"
+	p2pMaxStreamsOptionName       = "max-streams"
+	p2pBandwidthOptionName        = "bandwidth"
+	p2pAllowRemoteOptionName      = "allow-remote"
 )
 
 var resolveTimeout = 10 * time.Second
@@ -74,6 +93,8 @@ are refined`,
 		"listen":  p2pListenCmd,
 		"close":   p2pCloseCmd,
 		"ls":      p2pLsCmd,
+		"allow":   p2pAllowCmd,
+		"proxy":   p2pProxyCmd,
 	},
 }
 
@@ -90,6 +111,10 @@ Example:
   ipfs p2p forward ` + P2PProtoPrefix + `myproto /ip4/127.0.0.1/tcp/4567 /p2p/QmPeer
     - Forward connections to 127.0.0.1:4567 to '` + P2PProtoPrefix + `myproto' service on /p2p/QmPeer
 
+A UDP <listen-address> forwards datagrams: the datagrams from each source
+address are sent over their own libp2p stream, closed after ` + p2p.UDPIdleTimeout.String() + ` without
+traffic. The service on the remote peer must target a UDP address.
+
 `,
 	},
 	Arguments: []cmds.Argument{
@@ -99,6 +124,9 @@ Example:
 	},
 	Options: []cmds.Option{
 		cmds.BoolOption(allowCustomProtocolOptionName, "Don't require /x/ prefix"),
+		cmds.BoolOption(p2pPersistOptionName, "Also add the forward to the config, to restore it when the daemon starts."),
+		cmds.IntOption(p2pMaxStreamsOptionName, "Maximum number of concurrent connections. Default: no limit."),
+		cmds.StringOption(p2pBandwidthOptionName, "Maximum bytes per second in each direction, shared by the connections, such as 1MB. Default: no limit."),
 	},
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
 		n, err := p2pGetNode(env)
@@ -128,7 +156,29 @@ Example:
 			return errors.New("protocol name must be within '" + P2PProtoPrefix + "' namespace")
 		}
 
-		return forwardLocal(n.Context(), n.P2P, n.Peerstore, proto, listen, targets)
+		lc := p2pLimitsConfig(req)
+		limits, err := lc.Limits()
+		if err != nil {
+			return err
+		}
+
+		listener, err := forwardLocal(n.Context(), n.P2P, n.Peerstore, proto, listen, targets, limits)
+		if err != nil {
+			return err
+		}
+
+		if persist, _ := req.Options[p2pPersistOptionName].(bool); persist {
+			target := peer.AddrInfo{ID: targets.ID}
+			p2pAddr, err := peer.AddrInfoToP2pAddrs(&target)
+			if err != nil {
+				return err
+			}
+			lc.Protocol = string(proto)
+			lc.ListenAddress = listener.ListenAddress().String()
+			lc.TargetAddress = p2pAddr[0].String()
+			return persistP2PListener(n, listener, lc)
+		}
+		return nil
 	},
 }
 
@@ -190,6 +240,14 @@ Example:
   ipfs p2p listen ` + P2PProtoPrefix + `myproto /ip4/127.0.0.1/tcp/1234
     - Forward connections to 'myproto' libp2p service to 127.0.0.1:1234
 
+A UDP <target-address> receives the datagrams of a UDP 'ipfs p2p forward'.
+
+By default, any peer can connect to the service. --allow-peer and
+--allowlist-file restrict it to the given peers: streams from other peers are
+reset before connecting to <target-address>. The allowlist file lists one peer
+ID per line, with '#' comments, and is read again when it changes. Use
+'ipfs p2p allow' to change the allowed peers of a running service.
+
 `,
 	},
 	Arguments: []cmds.Argument{
@@ -198,7 +256,12 @@ Example:
 	},
 	Options: []cmds.Option{
 		cmds.BoolOption(allowCustomProtocolOptionName, "Don't require /x/ prefix"),
-		cmds.BoolOption(reportPeerIDOptionName, "r", "Send remote base58 peerid to target when a new connection is established"),
+		cmds.BoolOption(reportPeerIDOptionName, "r", "Send remote base58 peerid to target when a new connection is established. Not supported for UDP targets."),
+		cmds.StringsOption(allowPeerOptionName, "Only accept connections from the peer. Can be given multiple times."),
+		cmds.StringOption(allowlistFileOptionName, "Only accept connections from the peers listed in the file (absolute path)."),
+		cmds.BoolOption(p2pPersistOptionName, "Also add the service to the config, to restore it when the daemon starts."),
+		cmds.IntOption(p2pMaxStreamsOptionName, "Maximum number of concurrent connections. Default: no limit."),
+		cmds.StringOption(p2pBandwidthOptionName, "Maximum bytes per second in each direction, shared by the connections, such as 1MB. Default: no limit."),
 	},
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
 		n, err := p2pGetNode(env)
@@ -228,7 +291,97 @@ Example:
 			return errors.New("protocol name must be within '" + P2PProtoPrefix + "' namespace")
 		}
 
-		_, err = n.P2P.ForwardRemote(n.Context(), proto, target, reportPeerID)
+		allowOpt, _ := req.Options[allowPeerOptionName].([]string)
+		allowFile, _ := req.Options[allowlistFileOptionName].(string)
+
+		allowed, err := parsePeerIDs(allowOpt)
+		if err != nil {
+			return err
+		}
+		if allowFile != "" && !filepath.IsAbs(allowFile) {
+			return errors.New("allowlist file path must be absolute")
+		}
+		allow, err := p2p.NewAllowlist(allowed, allowFile)
+		if err != nil {
+			return err
+		}
+		lc := p2pLimitsConfig(req)
+		limits, err := lc.Limits()
+		if err != nil {
+			return err
+		}
+
+		listener, err := n.P2P.ForwardRemote(n.Context(), proto, target, reportPeerID, allow, limits)
+		if err != nil {
+			return err
+		}
+
+		if persist, _ := req.Options[p2pPersistOptionName].(bool); persist {
+			lc.Protocol = string(proto)
+			lc.TargetAddress = target.String()
+			lc.ReportPeerID = reportPeerID
+			lc.AllowPeers = allowOpt
+			lc.AllowlistFile = allowFile
+			return persistP2PListener(n, listener, lc)
+		}
+		return nil
+	},
+}
+
+var p2pProxyCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Proxy connections to the libp2p services of any peer.",
+		ShortDescription: `
+Accept SOCKS5 and HTTP CONNECT proxy connections on <listen-address>, and
+forward them to the libp2p service of the host they request. The host
+<peer-id>.<name>.` + p2p.ProxyDomain + ` is the '` + P2PProtoPrefix + `<name>' service of the peer, created
+with 'ipfs p2p listen'. The port of the host is ignored.
+
+Peer IDs are case sensitive, use their base36 CID, which fits in a DNS label,
+with clients that change the case of host names.
+
+Example:
+  ipfs p2p proxy /ip4/127.0.0.1/tcp/1080
+    - Accept proxy connections on 127.0.0.1:1080
+  curl --socks5-hostname 127.0.0.1:1080 http://QmPeer.myproto.` + p2p.ProxyDomain + `/
+    - Fetch / from the '` + P2PProtoPrefix + `myproto' HTTP service of QmPeer
+
+The proxy doesn't authenticate its clients: anyone connecting to it reaches
+the services of any peer through this node. <listen-address> must be a
+loopback address, unless --` + p2pAllowRemoteOptionName + ` is given.
+
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("listen-address", true, false, "Listening endpoint."),
+	},
+	Options: []cmds.Option{
+		cmds.BoolOption(p2pAllowRemoteOptionName, "Accept proxy connections on a non-loopback address, from any host that can reach it."),
+		cmds.IntOption(p2pMaxStreamsOptionName, "Maximum number of concurrent connections. Default: no limit."),
+		cmds.StringOption(p2pBandwidthOptionName, "Maximum bytes per second in each direction, shared by the connections, such as 1MB. Default: no limit."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := p2pGetNode(env)
+		if err != nil {
+			return err
+		}
+
+		listen, err := ma.NewMultiaddr(req.Arguments[0])
+		if err != nil {
+			return err
+		}
+
+		lc := p2pLimitsConfig(req)
+		limits, err := lc.Limits()
+		if err != nil {
+			return err
+		}
+
+		allowRemote, _ := req.Options[p2pAllowRemoteOptionName].(bool)
+		_, err = n.P2P.ForwardProxy(n.Context(), listen, allowRemote, limits)
+		if err == p2p.ErrProxyNotLoopback {
+			return fmt.Errorf("%s, use --%s to accept connections from other hosts", err, p2pAllowRemoteOptionName)
+		}
 		return err
 	},
 }
@@ -268,11 +421,115 @@ func checkPort(target ma.Multiaddr) error {
 }
 
 // forwardLocal forwards local connections to a libp2p service
-func forwardLocal(ctx context.Context, p *p2p.P2P, ps pstore.Peerstore, proto protocol.ID, bindAddr ma.Multiaddr, addr *peer.AddrInfo) error {
+func forwardLocal(ctx context.Context, p *p2p.P2P, ps pstore.Peerstore, proto protocol.ID, bindAddr ma.Multiaddr, addr *peer.AddrInfo, limits p2p.Limits) (p2p.Listener, error) {
 	ps.AddAddrs(addr.ID, addr.Addrs, pstore.TempAddrTTL)
 	// TODO: return some info
-	_, err := p.ForwardLocal(ctx, addr.ID, proto, bindAddr)
-	return err
+	return p.ForwardLocal(ctx, addr.ID, proto, bindAddr, limits)
+}
+
+// p2pLimitsConfig returns the config of the limits given as options.
+func p2pLimitsConfig(req *cmds.Request) p2p.ListenerConfig {
+	maxStreams, _ := req.Options[p2pMaxStreamsOptionName].(int)
+	bandwidth, _ := req.Options[p2pBandwidthOptionName].(string)
+	return p2p.ListenerConfig{
+		MaxStreams: maxStreams,
+		Bandwidth:  bandwidth,
+	}
+}
+
+// p2pListenerInfo returns the output of ls for the listener.
+func p2pListenerInfo(listener p2p.Listener) P2PListenerInfoOutput {
+	usage := listener.Usage()
+	limits := usage.Limits()
+	return P2PListenerInfoOutput{
+		Protocol:      string(listener.Protocol()),
+		ListenAddress: listener.ListenAddress().String(),
+		TargetAddress: listener.TargetAddress().String(),
+		Streams:       usage.Streams(),
+		MaxStreams:    limits.MaxStreams,
+		Bandwidth:     limits.Bandwidth,
+		BytesIn:       usage.BytesIn(),
+		BytesOut:      usage.BytesOut(),
+	}
+}
+
+// p2pConfigLk serializes the changes to the listeners in the config.
+var p2pConfigLk sync.Mutex
+
+// persistP2PListener adds the listener to the config, replacing the entry
+// for the same listener if any.
+func persistP2PListener(n *core.IpfsNode, l p2p.Listener, lc p2p.ListenerConfig) error {
+	p2pConfigLk.Lock()
+	defer p2pConfigLk.Unlock()
+
+	var listeners []p2p.ListenerConfig
+	if _, err := repo.ReadConfigKey(n.Repo, p2p.ListenersSelector, &listeners); err != nil {
+		return err
+	}
+
+	updated := make([]p2p.ListenerConfig, 0, len(listeners)+1)
+	for _, c := range listeners {
+		if !c.Declares(l) {
+			updated = append(updated, c)
+		}
+	}
+	updated = append(updated, lc)
+	return n.Repo.SetConfigKey(p2p.ListenersSelector, updated)
+}
+
+// unpersistP2PListeners removes the listeners from the config.
+func unpersistP2PListeners(n *core.IpfsNode, ls []p2p.Listener) error {
+	p2pConfigLk.Lock()
+	defer p2pConfigLk.Unlock()
+
+	var listeners []p2p.ListenerConfig
+	found, err := repo.ReadConfigKey(n.Repo, p2p.ListenersSelector, &listeners)
+	if err != nil || !found {
+		return err
+	}
+
+	updated := make([]p2p.ListenerConfig, 0, len(listeners))
+	for _, c := range listeners {
+		declared := false
+		for _, l := range ls {
+			if c.Declares(l) {
+				declared = true
+				break
+			}
+		}
+		if !declared {
+			updated = append(updated, c)
+		}
+	}
+	if len(updated) == len(listeners) {
+		return nil
+	}
+	return n.Repo.SetConfigKey(p2p.ListenersSelector, updated)
+}
+
+// persistP2PAllowlist updates the allowed peers of the listener in the
+// config, if it was added with --persist.
+func persistP2PAllowlist(n *core.IpfsNode, l p2p.Listener) error {
+	p2pConfigLk.Lock()
+	defer p2pConfigLk.Unlock()
+
+	var listeners []p2p.ListenerConfig
+	found, err := repo.ReadConfigKey(n.Repo, p2p.ListenersSelector, &listeners)
+	if err != nil || !found {
+		return err
+	}
+
+	persisted := false
+	for i := range listeners {
+		if listeners[i].Declares(l) {
+			listeners[i].SetAllowlist(l.Allowlist())
+			persisted = true
+		}
+	}
+	if !persisted {
+		return nil
+	}
+	return n.Repo.SetConfigKey(p2p.ListenersSelector, listeners)
 }
 
 const (
@@ -284,7 +541,7 @@ var p2pLsCmd = &cmds.Command{
 		Tagline: "List active p2p listeners.",
 	},
 	Options: []cmds.Option{
-		cmds.BoolOption(p2pHeadersOptionName, "v", "Print table headers (Protocol, Listen, Target)."),
+		cmds.BoolOption(p2pHeadersOptionName, "v", "Print table headers (Protocol, Listen, Target), the streams and the bytes received and sent."),
 	},
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
 		n, err := p2pGetNode(env)
@@ -296,21 +553,21 @@ var p2pLsCmd = &cmds.Command{
 
 		n.P2P.ListenersLocal.Lock()
 		for _, listener := range n.P2P.ListenersLocal.Listeners {
-			output.Listeners = append(output.Listeners, P2PListenerInfoOutput{
-				Protocol:      string(listener.Protocol()),
-				ListenAddress: listener.ListenAddress().String(),
-				TargetAddress: listener.TargetAddress().String(),
-			})
+			output.Listeners = append(output.Listeners, p2pListenerInfo(listener))
 		}
 		n.P2P.ListenersLocal.Unlock()
 
 		n.P2P.ListenersP2P.Lock()
 		for _, listener := range n.P2P.ListenersP2P.Listeners {
-			output.Listeners = append(output.Listeners, P2PListenerInfoOutput{
-				Protocol:      string(listener.Protocol()),
-				ListenAddress: listener.ListenAddress().String(),
-				TargetAddress: listener.TargetAddress().String(),
-			})
+			info := p2pListenerInfo(listener)
+			if allow := listener.Allowlist(); allow != nil && allow.Enabled() {
+				info.AllowedPeers = peerIDStrings(allow.Peers())
+				info.AllowlistFile = allow.File()
+				if info.AllowedPeers == nil {
+					info.AllowedPeers = []string{}
+				}
+			}
+			output.Listeners = append(output.Listeners, info)
 		}
 		n.P2P.ListenersP2P.Unlock()
 
@@ -323,10 +580,24 @@ var p2pLsCmd = &cmds.Command{
 			tw := tabwriter.NewWriter(w, 1, 2, 1, ' ', 0)
 			for _, listener := range out.Listeners {
 				if headers {
-					fmt.Fprintln(tw, "Protocol\tListen Address\tTarget Address")
+					fmt.Fprintln(tw, "Protocol\tListen Address\tTarget Address\tStreams\tIn\tOut")
 				}
 
-				fmt.Fprintf(tw, "%s\t%s\t%s\n", listener.Protocol, listener.ListenAddress, listener.TargetAddress)
+				fmt.Fprintf(tw, "%s\t%s\t%s", listener.Protocol, listener.ListenAddress, listener.TargetAddress)
+				if headers {
+					streams := strconv.Itoa(listener.Streams)
+					if listener.MaxStreams > 0 {
+						streams += "/" + strconv.Itoa(listener.MaxStreams)
+					}
+					fmt.Fprintf(tw, "\t%s\t%s\t%s", streams, humanize.Bytes(uint64(listener.BytesIn)), humanize.Bytes(uint64(listener.BytesOut)))
+					if listener.Bandwidth > 0 {
+						fmt.Fprintf(tw, "\tbandwidth:%s/s", humanize.Bytes(uint64(listener.Bandwidth)))
+					}
+				}
+				if listener.AllowedPeers != nil {
+					fmt.Fprintf(tw, "\tallow:%s", strings.Join(listener.AllowedPeers, ","))
+				}
+				fmt.Fprintln(tw)
 			}
 			tw.Flush()
 
@@ -345,6 +616,10 @@ const (
 var p2pCloseCmd = &cmds.Command{
 	Helptext: cmds.HelpText{
 		Tagline: "Stop listening for new connections to forward.",
+		ShortDescription: `
+Stop listening for new connections to forward. The closed listeners are also
+removed from the config, if they were added with --persist.
+`,
 	},
 	Options: []cmds.Option{
 		cmds.BoolOption(p2pAllOptionName, "a", "Close all listeners."),
@@ -407,8 +682,21 @@ var p2pCloseCmd = &cmds.Command{
 			return true
 		}
 
-		done := n.P2P.ListenersLocal.Close(match)
-		done += n.P2P.ListenersP2P.Close(match)
+		var closed []p2p.Listener
+		closeMatch := func(listener p2p.Listener) bool {
+			if !match(listener) {
+				return false
+			}
+			closed = append(closed, listener)
+			return true
+		}
+
+		done := n.P2P.ListenersLocal.Close(closeMatch)
+		done += n.P2P.ListenersP2P.Close(closeMatch)
+
+		if err := unpersistP2PListeners(n, closed); err != nil {
+			return err
+		}
 
 		return cmds.EmitOnce(res, done)
 	},
@@ -421,6 +709,168 @@ var p2pCloseCmd = &cmds.Command{
 	},
 }
 
+///////
+// Allowlist
+//
+
+// P2PAllowOutput is output type of allow commands
+type P2PAllowOutput struct {
+	Protocol string
+	// Restricted is false when any peer is allowed.
+	Restricted    bool
+	AllowedPeers  []string
+	AllowlistFile string `json:",omitempty"`
+}
+
+// p2pAllowCmd is the 'ipfs p2p allow' command
+var p2pAllowCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Manage the peers allowed to connect to libp2p services.",
+		ShortDescription: `
+Change the peers allowed to connect to a service created with 'ipfs p2p listen'.
+Adding a peer to a service that allows any peer restricts it to the added
+peers. Peers listed in the allowlist file of the service are changed by
+editing the file. The changes are saved in the config for services added with
+--persist.
+`,
+	},
+
+	Subcommands: map[string]*cmds.Command{
+		"ls":  p2pAllowLsCmd,
+		"add": p2pAllowAddCmd,
+		"rm":  p2pAllowRmCmd,
+	},
+}
+
+var p2pAllowLsCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "List the peers allowed to connect to a libp2p service.",
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("protocol", true, false, "Protocol name of the service."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		return p2pAllowEdit(req, res, env, nil)
+	},
+	Type: P2PAllowOutput{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(p2pAllowEncoder),
+	},
+}
+
+var p2pAllowAddCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Allow peers to connect to a libp2p service.",
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("protocol", true, false, "Protocol name of the service."),
+		cmds.StringArg("peer", true, true, "ID of the peer to allow."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		return p2pAllowEdit(req, res, env, (*p2p.Allowlist).Add)
+	},
+	Type: P2PAllowOutput{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(p2pAllowEncoder),
+	},
+}
+
+var p2pAllowRmCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Disallow peers to connect to a libp2p service.",
+		ShortDescription: `
+Disallow peers to connect to a libp2p service. The service keeps rejecting
+the peers that aren't allowed when the last allowed peer is removed. Open
+streams are not closed.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("protocol", true, false, "Protocol name of the service."),
+		cmds.StringArg("peer", true, true, "ID of the peer to disallow."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		return p2pAllowEdit(req, res, env, (*p2p.Allowlist).Remove)
+	},
+	Type: P2PAllowOutput{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(p2pAllowEncoder),
+	},
+}
+
+// p2pAllowEdit applies edit to the allowlist of the listener of the protocol
+// given as first argument with the peers given as other arguments, and emits
+// the allowlist.
+func p2pAllowEdit(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment, edit func(*p2p.Allowlist, ...peer.ID)) error {
+	n, err := p2pGetNode(env)
+	if err != nil {
+		return err
+	}
+
+	proto := req.Arguments[0]
+	peers, err := parsePeerIDs(req.Arguments[1:])
+	if err != nil {
+		return err
+	}
+
+	n.P2P.ListenersP2P.RLock()
+	listener, ok := n.P2P.ListenersP2P.Listeners[proto]
+	n.P2P.ListenersP2P.RUnlock()
+	if !ok {
+		return fmt.Errorf("no listener for protocol %s", proto)
+	}
+
+	allow := listener.Allowlist()
+	if edit != nil {
+		edit(allow, peers...)
+		if err := persistP2PAllowlist(n, listener); err != nil {
+			return err
+		}
+	}
+
+	output := &P2PAllowOutput{
+		Protocol:      proto,
+		Restricted:    allow.Enabled(),
+		AllowedPeers:  peerIDStrings(allow.Peers()),
+		AllowlistFile: allow.File(),
+	}
+	return cmds.EmitOnce(res, output)
+}
+
+func p2pAllowEncoder(req *cmds.Request, w io.Writer, out *P2PAllowOutput) error {
+	if !out.Restricted {
+		fmt.Fprintln(w, "any peer is allowed")
+		return nil
+	}
+	for _, p := range out.AllowedPeers {
+		fmt.Fprintln(w, p)
+	}
+	return nil
+}
+
+// parsePeerIDs decodes the peer IDs.
+func parsePeerIDs(ids []string) ([]peer.ID, error) {
+	peers := make([]peer.ID, len(ids))
+	for i, id := range ids {
+		p, err := peer.Decode(id)
+		if err != nil {
+			return nil, fmt.Errorf("invalid peer ID %q: %s", id, err)
+		}
+		peers[i] = p
+	}
+	return peers, nil
+}
+
+func peerIDStrings(peers []peer.ID) []string {
+	if len(peers) == 0 {
+		return nil
+	}
+	ids := make([]string, len(peers))
+	for i, p := range peers {
+		ids[i] = p.Pretty()
+	}
+	return ids
+}
+
 ///////
 // Stream
 //
@@ -443,7 +893,7 @@ var p2pStreamLsCmd = &cmds.Command{
 		Tagline: "List active p2p streams.",
 	},
 	Options: []cmds.Option{
-		cmds.BoolOption(p2pHeadersOptionName, "v", "Print table headers (ID, Protocol, Local, Remote)."),
+		cmds.BoolOption(p2pHeadersOptionName, "v", "Print table headers (ID, Protocol, Local, Remote) and the bytes received and sent."),
 	},
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
 		n, err := p2pGetNode(env)
@@ -462,6 +912,9 @@ var p2pStreamLsCmd = &cmds.Command{
 
 				OriginAddress: s.OriginAddr.String(),
 				TargetAddress: s.TargetAddr.String(),
+
+				BytesIn:  s.BytesIn(),
+				BytesOut: s.BytesOut(),
 			})
 		}
 		n.P2P.Streams.Unlock()
@@ -475,7 +928,10 @@ var p2pStreamLsCmd = &cmds.Command{
 			tw := tabwriter.NewWriter(w, 1, 2, 1, ' ', 0)
 			for _, stream := range out.Streams {
 				if headers {
-					fmt.Fprintln(tw, "ID\tProtocol\tOrigin\tTarget")
+					fmt.Fprintln(tw, "ID\tProtocol\tOrigin\tTarget\tIn\tOut")
+					fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", stream.HandlerID, stream.Protocol, stream.OriginAddress, stream.TargetAddress,
+						humanize.Bytes(uint64(stream.BytesIn)), humanize.Bytes(uint64(stream.BytesOut)))
+					continue
 				}
 
 				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", stream.HandlerID, stream.Protocol, stream.OriginAddress, stream.TargetAddress)
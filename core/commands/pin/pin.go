@@ -3,9 +3,11 @@ package pin
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"strings"
 	"time"
 
 	bserv "github.com/ipfs/go-blockservice"
@@ -22,6 +24,8 @@ import (
 	core "github.com/ipfs/go-ipfs/core"
 	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
 	e "github.com/ipfs/go-ipfs/core/commands/e"
+	coreapi "github.com/ipfs/go-ipfs/core/coreapi"
+	pinmeta "github.com/ipfs/go-ipfs/pinmeta"
 )
 
 var PinCmd = &cmds.Command{
@@ -51,12 +55,33 @@ type AddPinOutput struct {
 const (
 	pinRecursiveOptionName = "recursive"
 	pinProgressOptionName  = "progress"
+	pinExpiresInOptionName = "expires-in"
+	pinMetaOptionName      = "meta"
 )
 
 var addPinCmd = &cmds.Command{
 	Helptext: cmds.HelpText{
 		Tagline:          "Pin objects to local storage.",
 		ShortDescription: "Stores an IPFS object(s) from a given path locally to disk.",
+		LongDescription: `
+Stores an IPFS object(s) from a given path locally to disk.
+
+Pins can be given a name with --name, and arbitrary key-value pairs with
+--meta, to tell later why they were added. Both can be used to filter
+'ipfs pin ls'.
+
+With --expires-in, the pins expire after the given duration (e.g. "72h").
+The daemon removes expired pins, and garbage collection treats them as
+unpinned even before they are removed.
+
+Pinning an object again replaces the name or metadata given on the command
+line, and leaves the others unchanged. The expiry is always replaced: without
+--expires-in, the pin no longer expires.
+
+Example:
+	$ ipfs pin add --name=nightly --meta=branch=main --expires-in=72h <cid>
+	pinned <cid> recursively
+`,
 	},
 
 	Arguments: []cmds.Argument{
@@ -65,6 +90,9 @@ var addPinCmd = &cmds.Command{
 	Options: []cmds.Option{
 		cmds.BoolOption(pinRecursiveOptionName, "r", "Recursively pin the object linked to by the specified object(s).").WithDefault(true),
 		cmds.BoolOption(pinProgressOptionName, "Show progress"),
+		cmds.StringOption(pinNameOptionName, "A name for the pins."),
+		cmds.StringsOption(pinMetaOptionName, "Metadata for the pins, as key=value. Can be given multiple times."),
+		cmds.StringOption(pinExpiresInOptionName, "Remove the pins after the given duration, e.g. \"72h\"."),
 	},
 	Type: AddPinOutput{},
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
@@ -77,6 +105,11 @@ var addPinCmd = &cmds.Command{
 		recursive, _ := req.Options[pinRecursiveOptionName].(bool)
 		showProgress, _ := req.Options[pinProgressOptionName].(bool)
 
+		setInfo, err := pinInfoSetter(req)
+		if err != nil {
+			return err
+		}
+
 		if err := req.ParseBodyArgs(); err != nil {
 			return err
 		}
@@ -87,7 +120,7 @@ var addPinCmd = &cmds.Command{
 		}
 
 		if !showProgress {
-			added, err := pinAddMany(req.Context, api, enc, req.Arguments, recursive)
+			added, err := pinAddMany(req.Context, api, enc, req.Arguments, recursive, setInfo)
 			if err != nil {
 				return err
 			}
@@ -105,7 +138,7 @@ var addPinCmd = &cmds.Command{
 
 		ch := make(chan pinResult, 1)
 		go func() {
-			added, err := pinAddMany(ctx, api, enc, req.Arguments, recursive)
+			added, err := pinAddMany(ctx, api, enc, req.Arguments, recursive, setInfo)
 			ch <- pinResult{pins: added, err: err}
 		}()
 
@@ -181,7 +214,78 @@ var addPinCmd = &cmds.Command{
 	},
 }
 
-func pinAddMany(ctx context.Context, api coreiface.CoreAPI, enc cidenc.Encoder, paths []string, recursive bool) ([]string, error) {
+// pinInfoSetter returns a function updating the information of a pin from
+// the pin add options, or nil if none were given.
+func pinInfoSetter(req *cmds.Request) (func(*pinmeta.Info), error) {
+	name, setName := req.Options[pinNameOptionName].(string)
+
+	metaOpt, setMeta := req.Options[pinMetaOptionName].([]string)
+	meta, err := parsePinMeta(metaOpt)
+	if err != nil {
+		return nil, err
+	}
+
+	var expires time.Time
+	expiresIn, setExpires := req.Options[pinExpiresInOptionName].(string)
+	if setExpires {
+		d, err := time.ParseDuration(expiresIn)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --%s: %s", pinExpiresInOptionName, err)
+		}
+		if d <= 0 {
+			return nil, fmt.Errorf("--%s must be positive", pinExpiresInOptionName)
+		}
+		expires = time.Now().Add(d)
+	}
+
+	if !setName && !setMeta && !setExpires {
+		return nil, nil
+	}
+	return func(info *pinmeta.Info) {
+		if setName {
+			info.Name = name
+		}
+		if setMeta {
+			info.Meta = meta
+		}
+		// Expiries are not kept when pinning again.
+		info.Expires = expires
+	}, nil
+}
+
+// parsePinMeta parses key=value pairs.
+func parsePinMeta(kvs []string) (map[string]string, error) {
+	if len(kvs) == 0 {
+		return nil, nil
+	}
+	meta := make(map[string]string, len(kvs))
+	for _, kv := range kvs {
+		i := strings.IndexByte(kv, '=')
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid --%s %q, must be key=value", pinMetaOptionName, kv)
+		}
+		meta[kv[:i]] = kv[i+1:]
+	}
+	return meta, nil
+}
+
+func pinAddMany(ctx context.Context, api coreiface.CoreAPI, enc cidenc.Encoder, paths []string, recursive bool, setInfo func(*pinmeta.Info)) ([]string, error) {
+	add := api.Pin().Add
+	if setInfo != nil {
+		pinAPI, err := localPinAPI(api)
+		if err != nil {
+			return nil, err
+		}
+		add = func(ctx context.Context, p path.Path, opts ...options.PinAddOption) error {
+			info, _, err := pinAPI.Info(ctx, p)
+			if err != nil {
+				return err
+			}
+			setInfo(&info)
+			return pinAPI.AddWithInfo(ctx, p, info, opts...)
+		}
+	}
+
 	added := make([]string, len(paths))
 	for i, b := range paths {
 		rp, err := api.ResolvePath(ctx, path.New(b))
@@ -189,7 +293,7 @@ func pinAddMany(ctx context.Context, api coreiface.CoreAPI, enc cidenc.Encoder,
 			return nil, err
 		}
 
-		if err := api.Pin().Add(ctx, rp, options.Pin.Recursive(recursive)); err != nil {
+		if err := add(ctx, rp, options.Pin.Recursive(recursive)); err != nil {
 			return nil, err
 		}
 		added[i] = enc.Encode(rp.Cid())
@@ -198,6 +302,27 @@ func pinAddMany(ctx context.Context, api coreiface.CoreAPI, enc cidenc.Encoder,
 	return added, nil
 }
 
+// localPinAPI returns the PinAPI of the local node, which records information
+// such as names and expiries alongside pins.
+func localPinAPI(api coreiface.CoreAPI) (*coreapi.PinAPI, error) {
+	pinAPI, ok := api.Pin().(*coreapi.PinAPI)
+	if !ok {
+		return nil, errors.New("pin information is only supported by the local node")
+	}
+	return pinAPI, nil
+}
+
+// pinInfo returns the information recorded alongside the pin of the given
+// path. It is empty if the API does not record pin information.
+func pinInfo(ctx context.Context, api coreiface.CoreAPI, p path.Path) (pinmeta.Info, error) {
+	pinAPI, err := localPinAPI(api)
+	if err != nil {
+		return pinmeta.Info{}, nil
+	}
+	info, _, err := pinAPI.Info(ctx, p)
+	return info, err
+}
+
 var rmPinCmd = &cmds.Command{
 	Helptext: cmds.HelpText{
 		Tagline: "Remove pinned objects from local storage.",
@@ -296,6 +421,14 @@ Valid values are:
     * "indirect": pinned indirectly by an ancestor (like a refcount)
     * "all"
 
+Recursive and direct pins are listed with the name given to them and their
+expiry, if any. Their metadata is included in the JSON output. Expired pins
+are listed until the daemon removes them.
+
+Use --name=<name> to only list the pins with the given name, and
+--meta=<key>=<value> to only list the pins with the given metadata. Both
+exclude indirect pins.
+
 With arguments, the command fails if any of the arguments is not a pinned
 object. And if --type=<type> is additionally used, the command will also fail
 if any of the arguments is not of the specified type.
@@ -314,6 +447,11 @@ Example:
 	QmZULkCELmmk5XNfCgTnCyFgAVxBRBXyDHGGMVoLFLiXEN direct
 	$ ipfs pin ls QmZULkCELmmk5XNfCgTnCyFgAVxBRBXyDHGGMVoLFLiXEN
 	QmZULkCELmmk5XNfCgTnCyFgAVxBRBXyDHGGMVoLFLiXEN direct
+	# name the pin, and list it by name
+	$ ipfs pin add -r=false --name=hello QmZULkCELmmk5XNfCgTnCyFgAVxBRBXyDHGGMVoLFLiXEN
+	pinned QmZULkCELmmk5XNfCgTnCyFgAVxBRBXyDHGGMVoLFLiXEN directly
+	$ ipfs pin ls --name=hello
+	QmZULkCELmmk5XNfCgTnCyFgAVxBRBXyDHGGMVoLFLiXEN direct name=hello
 `,
 	},
 
@@ -324,6 +462,8 @@ Example:
 		cmds.StringOption(pinTypeOptionName, "t", "The type of pinned keys to list. Can be \"direct\", \"indirect\", \"recursive\", or \"all\".").WithDefault("all"),
 		cmds.BoolOption(pinQuietOptionName, "q", "Write just hashes of objects."),
 		cmds.BoolOption(pinStreamOptionName, "s", "Enable streaming of pins as they are discovered."),
+		cmds.StringOption(pinNameOptionName, "Only list the pins with the given name."),
+		cmds.StringsOption(pinMetaOptionName, "Only list the pins with the given metadata, as key=value. Can be given multiple times."),
 	},
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
 		api, err := cmdenv.GetApi(env, req)
@@ -341,21 +481,39 @@ Example:
 			return err
 		}
 
+		var filter pinFilter
+		filter.name, _ = req.Options[pinNameOptionName].(string)
+		metaOpt, _ := req.Options[pinMetaOptionName].([]string)
+		if filter.meta, err = parsePinMeta(metaOpt); err != nil {
+			return err
+		}
+		if filter.isSet() && typeStr == "indirect" {
+			return fmt.Errorf("--%s and --%s cannot list indirect pins", pinNameOptionName, pinMetaOptionName)
+		}
+
 		// For backward compatibility, we accumulate the pins in the same output type as before.
 		emit := res.Emit
 		lgcList := map[string]PinLsType{}
 		if !stream {
 			emit = func(v interface{}) error {
 				obj := v.(*PinLsOutputWrapper)
-				lgcList[obj.PinLsObject.Cid] = PinLsType{Type: obj.PinLsObject.Type}
+				lgcList[obj.PinLsObject.Cid] = PinLsType{
+					Type:    obj.PinLsObject.Type,
+					Name:    obj.PinLsObject.Name,
+					Meta:    obj.PinLsObject.Meta,
+					Expires: obj.PinLsObject.Expires,
+				}
 				return nil
 			}
 		}
 
-		if len(req.Arguments) > 0 {
-			err = pinLsKeys(req, typeStr, api, emit)
-		} else {
-			err = pinLsAll(req, typeStr, api, emit)
+		switch {
+		case len(req.Arguments) > 0:
+			err = pinLsKeys(req, typeStr, filter, api, emit)
+		case filter.name != "":
+			err = pinLsNamed(req, typeStr, filter, api, emit)
+		default:
+			err = pinLsAll(req, typeStr, filter, api, emit)
 		}
 		if err != nil {
 			return err
@@ -390,7 +548,7 @@ Example:
 				if quiet {
 					fmt.Fprintf(w, "%s\n", out.PinLsObject.Cid)
 				} else {
-					fmt.Fprintf(w, "%s %s\n", out.PinLsObject.Cid, out.PinLsObject.Type)
+					fmt.Fprintf(w, "%s %s%s\n", out.PinLsObject.Cid, out.PinLsObject.Type, formatPinInfo(out.PinLsObject.Name, out.PinLsObject.Expires))
 				}
 				return nil
 			}
@@ -399,7 +557,7 @@ Example:
 				if quiet {
 					fmt.Fprintf(w, "%s\n", k)
 				} else {
-					fmt.Fprintf(w, "%s %s\n", k, v.Type)
+					fmt.Fprintf(w, "%s %s%s\n", k, v.Type, formatPinInfo(v.Name, v.Expires))
 				}
 			}
 
@@ -423,16 +581,60 @@ type PinLsList struct {
 
 // PinLsType contains the type of a pin
 type PinLsType struct {
-	Type string
+	Type    string
+	Name    string            `json:",omitempty"`
+	Meta    map[string]string `json:",omitempty"`
+	Expires *time.Time        `json:",omitempty"`
 }
 
 // PinLsObject contains the description of a pin
 type PinLsObject struct {
-	Cid  string `json:",omitempty"`
-	Type string `json:",omitempty"`
+	Cid     string            `json:",omitempty"`
+	Type    string            `json:",omitempty"`
+	Name    string            `json:",omitempty"`
+	Meta    map[string]string `json:",omitempty"`
+	Expires *time.Time        `json:",omitempty"`
 }
 
-func pinLsKeys(req *cmds.Request, typeStr string, api coreiface.CoreAPI, emit func(value interface{}) error) error {
+func newPinLsObject(enc cidenc.Encoder, c cid.Cid, pinType string, info pinmeta.Info) *PinLsOutputWrapper {
+	obj := PinLsObject{
+		Type: pinType,
+		Cid:  enc.Encode(c),
+		Name: info.Name,
+		Meta: info.Meta,
+	}
+	if !info.Expires.IsZero() {
+		obj.Expires = &info.Expires
+	}
+	return &PinLsOutputWrapper{PinLsObject: obj}
+}
+
+func formatPinInfo(name string, expires *time.Time) string {
+	var s string
+	if name != "" {
+		s += " name=" + cmdenv.EscNonPrint(name)
+	}
+	if expires != nil {
+		s += " expires " + expires.Format(time.RFC3339)
+	}
+	return s
+}
+
+// pinFilter selects pins by the information recorded alongside them.
+type pinFilter struct {
+	name string
+	meta map[string]string
+}
+
+func (f pinFilter) isSet() bool {
+	return f.name != "" || len(f.meta) > 0
+}
+
+func (f pinFilter) matches(info pinmeta.Info) bool {
+	return info.Matches(f.name, f.meta)
+}
+
+func pinLsKeys(req *cmds.Request, typeStr string, filter pinFilter, api coreiface.CoreAPI, emit func(value interface{}) error) error {
 	enc, err := cmdenv.GetCidEncoder(req)
 	if err != nil {
 		return err
@@ -464,18 +666,23 @@ func pinLsKeys(req *cmds.Request, typeStr string, api coreiface.CoreAPI, emit fu
 			return fmt.Errorf("path '%s' is not pinned", p)
 		}
 
+		var info pinmeta.Info
 		switch pinType {
-		case "direct", "indirect", "recursive", "internal":
+		case "direct", "recursive":
+			info, err = pinInfo(req.Context, api, rp)
+			if err != nil {
+				return err
+			}
+		case "indirect", "internal":
 		default:
 			pinType = "indirect through " + pinType
 		}
 
-		err = emit(&PinLsOutputWrapper{
-			PinLsObject: PinLsObject{
-				Type: pinType,
-				Cid:  enc.Encode(rp.Cid()),
-			},
-		})
+		if filter.isSet() && !filter.matches(info) {
+			continue
+		}
+
+		err = emit(newPinLsObject(enc, rp.Cid(), pinType, info))
 		if err != nil {
 			return err
 		}
@@ -484,7 +691,7 @@ func pinLsKeys(req *cmds.Request, typeStr string, api coreiface.CoreAPI, emit fu
 	return nil
 }
 
-func pinLsAll(req *cmds.Request, typeStr string, api coreiface.CoreAPI, emit func(value interface{}) error) error {
+func pinLsAll(req *cmds.Request, typeStr string, filter pinFilter, api coreiface.CoreAPI, emit func(value interface{}) error) error {
 	enc, err := cmdenv.GetCidEncoder(req)
 	if err != nil {
 		return err
@@ -502,6 +709,15 @@ func pinLsAll(req *cmds.Request, typeStr string, api coreiface.CoreAPI, emit fun
 		panic("unhandled pin type")
 	}
 
+	// Load the information of every pin at once rather than pin by pin.
+	var infos map[cid.Cid]pinmeta.Info
+	if pinAPI, err := localPinAPI(api); err == nil {
+		infos, err = pinAPI.AllInfo(req.Context)
+		if err != nil {
+			return err
+		}
+	}
+
 	pins, err := api.Pin().Ls(req.Context, opt)
 	if err != nil {
 		return err
@@ -511,15 +727,67 @@ func pinLsAll(req *cmds.Request, typeStr string, api coreiface.CoreAPI, emit fun
 		if err := p.Err(); err != nil {
 			return err
 		}
-		err = emit(&PinLsOutputWrapper{
-			PinLsObject: PinLsObject{
-				Type: p.Type(),
-				Cid:  enc.Encode(p.Path().Cid()),
-			},
-		})
+		var info pinmeta.Info
+		if p.Type() != "indirect" {
+			info = infos[p.Path().Cid()]
+		} else if filter.isSet() {
+			continue
+		}
+		if filter.isSet() && !filter.matches(info) {
+			continue
+		}
+		err = emit(newPinLsObject(enc, p.Path().Cid(), p.Type(), info))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// pinLsNamed lists the pins named filter.name, looking them up by name
+// rather than going through every pin.
+func pinLsNamed(req *cmds.Request, typeStr string, filter pinFilter, api coreiface.CoreAPI, emit func(value interface{}) error) error {
+	enc, err := cmdenv.GetCidEncoder(req)
+	if err != nil {
+		return err
+	}
+
+	pinAPI, err := localPinAPI(api)
+	if err != nil {
+		return err
+	}
+
+	opt, err := options.Pin.IsPinned.Type(typeStr)
+	if err != nil {
+		panic("unhandled pin type")
+	}
+
+	named, err := pinAPI.Named(req.Context, filter.name)
+	if err != nil {
+		return err
+	}
+
+	for _, rp := range named {
+		pinType, pinned, err := pinAPI.IsPinned(req.Context, rp, opt)
+		if err != nil {
+			return err
+		}
+		if !pinned || (pinType != "direct" && pinType != "recursive") {
+			continue
+		}
+
+		info, _, err := pinAPI.Info(req.Context, rp)
 		if err != nil {
 			return err
 		}
+		if !filter.matches(info) {
+			continue
+		}
+
+		if err := emit(newPinLsObject(enc, rp.Cid(), pinType, info)); err != nil {
+			return err
+		}
 	}
 
 	return nil
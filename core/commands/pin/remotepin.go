@@ -17,6 +17,7 @@ import (
 	cid "github.com/ipfs/go-cid"
 	cmds "github.com/ipfs/go-ipfs-cmds"
 	config "github.com/ipfs/go-ipfs-config"
+	"github.com/ipfs/go-ipfs/core"
 	"github.com/ipfs/go-ipfs/core/commands/cmdenv"
 	fsrepo "github.com/ipfs/go-ipfs/repo/fsrepo"
 	logging "github.com/ipfs/go-log"
@@ -37,6 +38,7 @@ var remotePinCmd = &cmds.Command{
 		"add":     addRemotePinCmd,
 		"ls":      listRemotePinCmd,
 		"rm":      rmRemotePinCmd,
+		"sync":    syncRemotePinCmd,
 		"service": remotePinServiceCmd,
 	},
 }
@@ -167,19 +169,15 @@ NOTE: a comma-separated notation is supported in CLI for convenience:
 		}
 
 		// Prepare Pin.origins
-		// Add own multiaddrs to the 'origins' array, so Pinning Service can
-		// use that as a hint and connect back to us (if possible)
 		node, err := cmdenv.GetNode(env)
 		if err != nil {
 			return err
 		}
-		if node.PeerHost != nil {
-			addrs, err := peer.AddrInfoToP2pAddrs(host.InfoFromHost(node.PeerHost))
-			if err != nil {
-				return err
-			}
-			opts = append(opts, pinclient.PinOpts.WithOrigins(addrs...))
+		origins, err := originsOption(node)
+		if err != nil {
+			return err
 		}
+		opts = append(opts, origins...)
 
 		// Execute remote pin request
 		// TODO: fix panic when pinning service is down
@@ -691,6 +689,19 @@ func (l PinServicesList) Less(i, j int) bool {
 	return s[i].Service < s[j].Service
 }
 
+// originsOption adds own multiaddrs to the 'origins' array, so Pinning
+// Service can use that as a hint and connect back to us (if possible)
+func originsOption(node *core.IpfsNode) ([]pinclient.AddOption, error) {
+	if node.PeerHost == nil {
+		return nil, nil
+	}
+	addrs, err := peer.AddrInfoToP2pAddrs(host.InfoFromHost(node.PeerHost))
+	if err != nil {
+		return nil, err
+	}
+	return []pinclient.AddOption{pinclient.PinOpts.WithOrigins(addrs...)}, nil
+}
+
 func getRemotePinServiceFromRequest(req *cmds.Request, env cmds.Environment) (*pinclient.Client, error) {
 	service, serviceFound := req.Options[pinServiceNameOptionName]
 	if !serviceFound {
@@ -1,7 +1,20 @@
 package pin
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+	pinclient "github.com/ipfs/go-pinning-service-http-client"
+	mh "github.com/multiformats/go-multihash"
 )
 
 func TestNormalizeEndpoint(t *testing.T) {
@@ -65,3 +78,229 @@ func TestNormalizeEndpoint(t *testing.T) {
 	}
 
 }
+
+// mockPinService is a minimal in-memory pinning service API server.
+type mockPinService struct {
+	lk   sync.Mutex
+	pins map[string]*mockPin // by request id
+	next int
+}
+
+type mockPin struct {
+	RequestID string
+	Status    string
+	Created   time.Time
+	Cid       string
+	Name      string
+}
+
+func newMockPinService() *mockPinService {
+	return &mockPinService{pins: make(map[string]*mockPin)}
+}
+
+func (m *mockPinService) add(c cid.Cid, name string, status pinclient.Status) *mockPin {
+	m.next++
+	p := &mockPin{
+		RequestID: fmt.Sprintf("req-%d", m.next),
+		Status:    string(status),
+		// pins are listed newest first, keep creation times distinct
+		Created: time.Date(2021, 1, 1, 0, 0, m.next, 0, time.UTC),
+		Cid:     c.String(),
+		Name:    name,
+	}
+	m.pins[p.RequestID] = p
+	return p
+}
+
+func (p *mockPin) status() map[string]interface{} {
+	return map[string]interface{}{
+		"requestid": p.RequestID,
+		"status":    p.Status,
+		"created":   p.Created.Format(time.RFC3339),
+		"pin":       map[string]interface{}{"cid": p.Cid, "name": p.Name},
+		"delegates": []string{},
+		"info":      map[string]string{},
+	}
+}
+
+func (m *mockPinService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	id := strings.TrimPrefix(r.URL.Path, "/pins")
+	id = strings.TrimPrefix(id, "/")
+
+	var body struct {
+		Cid  string `json:"cid"`
+		Name string `json:"name"`
+	}
+	switch {
+	case r.Method == http.MethodGet && id == "":
+		statuses := map[string]bool{}
+		for _, v := range r.URL.Query()["status"] {
+			for _, s := range strings.Split(v, ",") {
+				statuses[s] = true
+			}
+		}
+		results := []map[string]interface{}{}
+		var listed []*mockPin
+		for _, p := range m.pins {
+			if len(statuses) == 0 || statuses[p.Status] {
+				listed = append(listed, p)
+			}
+		}
+		sort.Slice(listed, func(i, j int) bool { return listed[i].Created.After(listed[j].Created) })
+		for _, p := range listed {
+			results = append(results, p.status())
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"count": len(results), "results": results})
+	case r.Method == http.MethodPost:
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		c, err := cid.Decode(body.Cid)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if id != "" {
+			if _, ok := m.pins[id]; !ok {
+				http.NotFound(w, r)
+				return
+			}
+			delete(m.pins, id)
+		}
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(m.add(c, body.Name, pinclient.StatusPinned).status())
+	case r.Method == http.MethodDelete && id != "":
+		if _, ok := m.pins[id]; !ok {
+			http.NotFound(w, r)
+			return
+		}
+		delete(m.pins, id)
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		http.Error(w, "unsupported", http.StatusBadRequest)
+	}
+}
+
+func testCid(t *testing.T, data string) cid.Cid {
+	h, err := mh.Sum([]byte(data), mh.SHA2_256, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cid.NewCidV1(cid.Raw, h)
+}
+
+func TestSyncToRemote(t *testing.T) {
+	ctx := context.Background()
+
+	a, b, c, d, e := testCid(t, "a"), testCid(t, "b"), testCid(t, "c"), testCid(t, "d"), testCid(t, "e")
+
+	mock := newMockPinService()
+	mock.add(a, "a", pinclient.StatusPinned)
+	mock.add(b, "old", pinclient.StatusPinned)
+	mock.add(d, "d", pinclient.StatusFailed)
+	mock.add(e, "e", pinclient.StatusPinned)
+	// duplicates are removed with the pin
+	mock.add(e, "e", pinclient.StatusFailed)
+	mock.add(e, "e", pinclient.StatusPinned)
+	srv := httptest.NewServer(mock)
+	defer srv.Close()
+	client := pinclient.NewClient(srv.URL, "secret")
+
+	local := map[cid.Cid]syncedPin{
+		a: {Name: "a"},
+		b: {Name: "new"},
+		c: {Name: "c"},
+		d: {Name: "d"},
+	}
+
+	remote, err := remotePinSet(ctx, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(remote) != 4 {
+		t.Fatalf("expected 4 remote pins, got %d", len(remote))
+	}
+	if r := remote[e]; r.Status != pinclient.StatusPinned || len(r.Duplicates) != 2 {
+		t.Fatalf("expected a pinned remote pin with 2 duplicates, got %+v", r)
+	}
+
+	// without --delete, remote only pins are kept
+	for _, act := range planPinSync(local, remote, syncToRemote, false) {
+		if act.Action == syncActionRm {
+			t.Fatalf("unexpected removal of %s", act.Cid)
+		}
+	}
+
+	actions := planPinSync(local, remote, syncToRemote, true)
+	expected := map[cid.Cid]string{
+		b: syncActionRepin,
+		c: syncActionAdd,
+		d: syncActionRepin,
+		e: syncActionRm,
+	}
+	if len(actions) != len(expected) {
+		t.Fatalf("expected %d actions, got %v", len(expected), actions)
+	}
+	for _, act := range actions {
+		if act.Target != syncToRemote || expected[act.Cid] != act.Action {
+			t.Errorf("unexpected action %s %s %s", act.Action, act.Target, act.Cid)
+		}
+		if err := applyRemoteSync(ctx, client, act); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	remote, err = remotePinSet(ctx, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(remote) != len(local) || len(mock.pins) != len(local) {
+		t.Fatalf("expected %d remote pins after sync, got %d", len(local), len(mock.pins))
+	}
+	for k, l := range local {
+		r, ok := remote[k]
+		if !ok || r.Name != l.Name || r.Status != pinclient.StatusPinned {
+			t.Errorf("remote pin %s not in sync: %+v", k, r)
+		}
+	}
+	if actions := planPinSync(local, remote, syncToRemote, true); len(actions) != 0 {
+		t.Errorf("expected no actions once in sync, got %v", actions)
+	}
+}
+
+func TestPlanSyncToLocal(t *testing.T) {
+	a, b, c, d := testCid(t, "a"), testCid(t, "b"), testCid(t, "c"), testCid(t, "d")
+
+	local := map[cid.Cid]syncedPin{
+		a: {Name: "a"},
+		b: {Name: "old"},
+		d: {Name: "d"},
+	}
+	remote := map[cid.Cid]syncedPin{
+		a: {Name: "a", Status: pinclient.StatusPinned},
+		b: {Name: "new", Status: pinclient.StatusPinned},
+		c: {Name: "c", Status: pinclient.StatusQueued},
+		d: {Name: "d", Status: pinclient.StatusFailed},
+	}
+
+	actions := planPinSync(local, remote, syncToLocal, true)
+	expected := map[cid.Cid]pinSyncAction{
+		b: {Action: syncActionRepin, Name: "new"},
+		c: {Action: syncActionAdd, Name: "c"},
+		d: {Action: syncActionRm, Name: "d"},
+	}
+	if len(actions) != len(expected) {
+		t.Fatalf("expected %d actions, got %v", len(expected), actions)
+	}
+	for _, act := range actions {
+		exp := expected[act.Cid]
+		if act.Target != syncToLocal || act.Action != exp.Action || act.Name != exp.Name {
+			t.Errorf("unexpected action %s %s %s %q", act.Action, act.Target, act.Cid, act.Name)
+		}
+	}
+}
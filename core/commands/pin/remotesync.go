@@ -0,0 +1,318 @@
+package pin
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+
+	cid "github.com/ipfs/go-cid"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	pinclient "github.com/ipfs/go-pinning-service-http-client"
+	options "github.com/ipfs/interface-go-ipfs-core/options"
+	path "github.com/ipfs/interface-go-ipfs-core/path"
+
+	"github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	"github.com/ipfs/go-ipfs/core/coreapi"
+	"github.com/ipfs/go-ipfs/pinmeta"
+)
+
+const pinSyncToOptionName = "to"
+const pinSyncDryRunOptionName = "dry-run"
+const pinSyncDeleteOptionName = "delete"
+
+const (
+	syncToRemote = "remote"
+	syncToLocal  = "local"
+)
+
+const (
+	syncActionAdd   = "add"
+	syncActionRm    = "rm"
+	syncActionRepin = "repin"
+)
+
+type SyncRemotePinOutput struct {
+	Action string
+	Target string
+	Cid    string
+	Name   string
+	DryRun bool `json:",omitempty"`
+}
+
+// syncedPin is a pin on either side of a sync.
+type syncedPin struct {
+	Name       string
+	Status     pinclient.Status // remote pins only
+	RequestID  string           // remote pins only
+	Duplicates []string         // remote pins only, other pins of the CID
+}
+
+// pinSyncAction is one change made by a sync.
+type pinSyncAction struct {
+	Action     string
+	Target     string
+	Cid        cid.Cid
+	Name       string
+	RequestID  string   // remote pin removed or replaced
+	Duplicates []string // other remote pins removed
+}
+
+var syncRemotePinCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline:          "Reconcile local pins with a remote pinning service.",
+		ShortDescription: "Makes the remote pins match the local recursive pins, or the other way around.",
+		LongDescription: `
+Compares the local recursive pins with the pins on a remote pinning service,
+by CID and name, and changes one side to match the other.
+
+With --to=remote (the default), local pins missing on the remote service are
+added to it, and remote pins with another name or that failed are repinned.
+With --to=local, remote pins missing locally are pinned locally, and local
+pins with another name are renamed. Remote pins that failed are ignored.
+
+Pins only present on the side being changed are kept, unless --delete is
+passed. Use --dry-run to list the changes without making them:
+
+  $ ipfs pin remote sync --service=mysrv --dry-run
+  would add remote bafkqaaa nightly
+  $ ipfs pin remote sync --service=mysrv --to=local --delete
+
+Local pin names are the ones given with 'ipfs pin add --name'.
+`,
+	},
+
+	Arguments: []cmds.Argument{},
+	Options: []cmds.Option{
+		pinServiceNameOption,
+		cmds.StringOption(pinSyncToOptionName, "Side to change: \"remote\" or \"local\".").WithDefault(syncToRemote),
+		cmds.BoolOption(pinSyncDryRunOptionName, "Only list the changes that would be made.").WithDefault(false),
+		cmds.BoolOption(pinSyncDeleteOptionName, "Remove the pins missing on the other side.").WithDefault(false),
+	},
+	Type: SyncRemotePinOutput{},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		ctx, cancel := context.WithCancel(req.Context)
+		defer cancel()
+
+		to, _ := req.Options[pinSyncToOptionName].(string)
+		if to != syncToRemote && to != syncToLocal {
+			return fmt.Errorf("invalid --%s %q, must be %q or %q", pinSyncToOptionName, to, syncToRemote, syncToLocal)
+		}
+		dryRun, _ := req.Options[pinSyncDryRunOptionName].(bool)
+		del, _ := req.Options[pinSyncDeleteOptionName].(bool)
+
+		c, err := getRemotePinServiceFromRequest(req, env)
+		if err != nil {
+			return err
+		}
+
+		api, err := cmdenv.GetApi(env, req)
+		if err != nil {
+			return err
+		}
+		pinAPI, err := localPinAPI(api)
+		if err != nil {
+			return err
+		}
+
+		infos, err := pinAPI.AllInfo(ctx)
+		if err != nil {
+			return err
+		}
+		local, err := localRecursivePins(ctx, pinAPI, infos)
+		if err != nil {
+			return err
+		}
+		remote, err := remotePinSet(ctx, c)
+		if err != nil {
+			return fmt.Errorf("error while listing remote pins: %v", err)
+		}
+
+		var origins []pinclient.AddOption
+		if to == syncToRemote && !dryRun {
+			node, err := cmdenv.GetNode(env)
+			if err != nil {
+				return err
+			}
+			if origins, err = originsOption(node); err != nil {
+				return err
+			}
+		}
+
+		enc, err := cmdenv.GetCidEncoder(req)
+		if err != nil {
+			return err
+		}
+
+		for _, a := range planPinSync(local, remote, to, del) {
+			if !dryRun {
+				if a.Target == syncToRemote {
+					err = applyRemoteSync(ctx, c, a, origins...)
+				} else {
+					err = applyLocalSync(ctx, pinAPI, infos, a)
+				}
+				if err != nil {
+					return err
+				}
+			}
+			err = res.Emit(&SyncRemotePinOutput{
+				Action: a.Action,
+				Target: a.Target,
+				Cid:    enc.Encode(a.Cid),
+				Name:   a.Name,
+				DryRun: dryRun,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *SyncRemotePinOutput) error {
+			action := out.Action
+			if out.DryRun {
+				action = "would " + action
+			}
+			fmt.Fprintf(w, "%s %s %s %s\n", action, out.Target, out.Cid, cmdenv.EscNonPrint(out.Name))
+			return nil
+		}),
+	},
+}
+
+// localRecursivePins returns the local recursive pins with their names, taken
+// from the information of every pin.
+func localRecursivePins(ctx context.Context, pinAPI *coreapi.PinAPI, infos map[cid.Cid]pinmeta.Info) (map[cid.Cid]syncedPin, error) {
+	pins, err := pinAPI.Ls(ctx, options.Pin.Ls.Recursive())
+	if err != nil {
+		return nil, err
+	}
+
+	local := make(map[cid.Cid]syncedPin)
+	for p := range pins {
+		if err := p.Err(); err != nil {
+			return nil, err
+		}
+		local[p.Path().Cid()] = syncedPin{Name: infos[p.Path().Cid()].Name}
+	}
+	return local, nil
+}
+
+// remotePinSet returns every pin on the remote service, whatever its status.
+// When a CID is pinned several times, a pin that is not failed is preferred,
+// and the others are kept as its duplicates.
+func remotePinSet(ctx context.Context, c *pinclient.Client) (map[cid.Cid]syncedPin, error) {
+	psCh, errCh := c.Ls(ctx, pinclient.PinOpts.FilterStatus(
+		pinclient.StatusQueued, pinclient.StatusPinning, pinclient.StatusPinned, pinclient.StatusFailed,
+	))
+
+	remote := make(map[cid.Cid]syncedPin)
+	for ps := range psCh {
+		k := ps.GetPin().GetCid()
+		prev, ok := remote[k]
+		if ok && prev.Status != pinclient.StatusFailed {
+			prev.Duplicates = append(prev.Duplicates, ps.GetRequestId())
+			remote[k] = prev
+			continue
+		}
+		r := syncedPin{
+			Name:      ps.GetPin().GetName(),
+			Status:    ps.GetStatus(),
+			RequestID: ps.GetRequestId(),
+		}
+		if ok {
+			r.Duplicates = append(prev.Duplicates, prev.RequestID)
+		}
+		remote[k] = r
+	}
+	if err := <-errCh; err != nil {
+		return nil, err
+	}
+	return remote, nil
+}
+
+// planPinSync returns the changes making the target side match the other,
+// sorted by CID.
+func planPinSync(local, remote map[cid.Cid]syncedPin, to string, del bool) []pinSyncAction {
+	var actions []pinSyncAction
+
+	if to == syncToRemote {
+		for k, l := range local {
+			r, ok := remote[k]
+			switch {
+			case !ok:
+				actions = append(actions, pinSyncAction{Action: syncActionAdd, Target: syncToRemote, Cid: k, Name: l.Name})
+			case r.Status == pinclient.StatusFailed || r.Name != l.Name:
+				actions = append(actions, pinSyncAction{Action: syncActionRepin, Target: syncToRemote, Cid: k, Name: l.Name, RequestID: r.RequestID})
+			}
+		}
+		if del {
+			for k, r := range remote {
+				if _, ok := local[k]; !ok {
+					actions = append(actions, pinSyncAction{Action: syncActionRm, Target: syncToRemote, Cid: k, Name: r.Name, RequestID: r.RequestID, Duplicates: r.Duplicates})
+				}
+			}
+		}
+	} else {
+		for k, r := range remote {
+			if r.Status == pinclient.StatusFailed {
+				continue
+			}
+			l, ok := local[k]
+			switch {
+			case !ok:
+				actions = append(actions, pinSyncAction{Action: syncActionAdd, Target: syncToLocal, Cid: k, Name: r.Name})
+			case r.Name != l.Name:
+				actions = append(actions, pinSyncAction{Action: syncActionRepin, Target: syncToLocal, Cid: k, Name: r.Name})
+			}
+		}
+		if del {
+			for k, l := range local {
+				if r, ok := remote[k]; !ok || r.Status == pinclient.StatusFailed {
+					actions = append(actions, pinSyncAction{Action: syncActionRm, Target: syncToLocal, Cid: k, Name: l.Name})
+				}
+			}
+		}
+	}
+
+	sort.Slice(actions, func(i, j int) bool {
+		return actions[i].Cid.KeyString() < actions[j].Cid.KeyString()
+	})
+	return actions
+}
+
+func applyRemoteSync(ctx context.Context, c *pinclient.Client, a pinSyncAction, opts ...pinclient.AddOption) error {
+	if a.Name != "" {
+		opts = append(opts, pinclient.PinOpts.WithName(a.Name))
+	}
+	switch a.Action {
+	case syncActionAdd:
+		if _, err := c.Add(ctx, a.Cid, opts...); err != nil {
+			return fmt.Errorf("adding remote pin for %s failed: %v", a.Cid, err)
+		}
+	case syncActionRepin:
+		if _, err := c.Replace(ctx, a.RequestID, a.Cid, opts...); err != nil {
+			return fmt.Errorf("replacing pin identified by requestid=%q failed: %v", a.RequestID, err)
+		}
+	case syncActionRm:
+		for _, id := range append([]string{a.RequestID}, a.Duplicates...) {
+			if err := c.DeleteByID(ctx, id); err != nil {
+				return fmt.Errorf("removing pin identified by requestid=%q failed: %v", id, err)
+			}
+		}
+	}
+	return nil
+}
+
+func applyLocalSync(ctx context.Context, pinAPI *coreapi.PinAPI, infos map[cid.Cid]pinmeta.Info, a pinSyncAction) error {
+	p := path.IpldPath(a.Cid)
+	switch a.Action {
+	case syncActionAdd, syncActionRepin:
+		info := infos[a.Cid]
+		info.Name = a.Name
+		return pinAPI.AddWithInfo(ctx, p, info, options.Pin.Recursive(true))
+	case syncActionRm:
+		return pinAPI.Rm(ctx, p, options.Pin.RmRecursive(true))
+	}
+	return nil
+}
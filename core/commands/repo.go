@@ -14,6 +14,7 @@ import (
 	humanize "github.com/dustin/go-humanize"
 	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
 	corerepo "github.com/ipfs/go-ipfs/core/corerepo"
+	gc "github.com/ipfs/go-ipfs/gc"
 	fsrepo "github.com/ipfs/go-ipfs/repo/fsrepo"
 
 	cid "github.com/ipfs/go-cid"
@@ -46,11 +47,29 @@ var RepoCmd = &cmds.Command{
 type GcResult struct {
 	Key   cid.Cid
 	Error string `json:",omitempty"`
+
+	// Size is the size of Key in bytes, only set with --dry-run.
+	Size uint64 `json:",omitempty"`
+	// Root reports the blocks kept by a GC root, only set with --dry-run
+	// and --explain.
+	Root *gc.Reachability `json:",omitempty"`
+	// Total sums up what a --dry-run would remove. It is the last result.
+	Total *GcTotal `json:",omitempty"`
+}
+
+// GcTotal sums up the blocks that "repo gc --dry-run" would remove.
+type GcTotal struct {
+	Blocks uint64
+	Size   uint64
 }
 
 const (
 	repoStreamErrorsOptionName = "stream-errors"
 	repoQuietOptionName        = "quiet"
+	repoIncrementalOptionName  = "incremental"
+	repoBatchSizeOptionName    = "batch-size"
+	repoDryRunOptionName       = "dry-run"
+	repoExplainOptionName      = "explain"
 )
 
 var repoGcCmd = &cmds.Command{
@@ -60,11 +79,37 @@ var repoGcCmd = &cmds.Command{
 'ipfs repo gc' is a plumbing command that will sweep the local
 set of stored objects and remove ones that are not pinned in
 order to reclaim hard disk space.
+`,
+		LongDescription: `
+'ipfs repo gc' is a plumbing command that will sweep the local
+set of stored objects and remove ones that are not pinned in
+order to reclaim hard disk space.
+
+By default the collector holds the GC lock for the whole run, blocking
+'ipfs add' and 'ipfs pin add' until it is done. With --incremental, the
+marked set is computed in the background and blocks are removed in small
+batches (see --batch-size), only holding the lock for one batch at a time.
+Blocks added, pinned or read while an incremental collection is running
+are kept until the next run.
+
+With --dry-run, nothing is removed. Instead, the number of blocks and bytes
+kept by every pin, the MFS root and every other GC root is reported, followed
+by every block that would be removed and the total space it would free.
+Blocks kept by several roots are only counted for the first one, in the order
+recursive pins, MFS root, direct pins, internal pins.
+
+With --explain <cid>, nothing is removed either. The GC roots that keep the
+given block are reported along with their totals. If no root keeps it, the
+block is reported as one that would be removed.
 `,
 	},
 	Options: []cmds.Option{
 		cmds.BoolOption(repoStreamErrorsOptionName, "Stream errors."),
 		cmds.BoolOption(repoQuietOptionName, "q", "Write minimal output."),
+		cmds.BoolOption(repoIncrementalOptionName, "Collect incrementally without blocking adds and pins for the whole run."),
+		cmds.IntOption(repoBatchSizeOptionName, "Maximum number of blocks removed per lock acquisition with --incremental.").WithDefault(gc.DefaultBatchSize),
+		cmds.BoolOption(repoDryRunOptionName, "Report what would be removed without removing anything."),
+		cmds.StringOption(repoExplainOptionName, "Report which GC roots keep the given CID."),
 	},
 	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
 		n, err := cmdenv.GetNode(env)
@@ -73,8 +118,50 @@ order to reclaim hard disk space.
 		}
 
 		streamErrors, _ := req.Options[repoStreamErrorsOptionName].(bool)
+		incremental, _ := req.Options[repoIncrementalOptionName].(bool)
+		batchSize, _ := req.Options[repoBatchSizeOptionName].(int)
+		dryRun, _ := req.Options[repoDryRunOptionName].(bool)
+		explain, _ := req.Options[repoExplainOptionName].(string)
+
+		if dryRun || explain != "" {
+			if incremental {
+				return fmt.Errorf("--%s cannot be used with --%s or --%s", repoIncrementalOptionName, repoDryRunOptionName, repoExplainOptionName)
+			}
+			if dryRun && explain != "" {
+				return fmt.Errorf("--%s and --%s are mutually exclusive", repoDryRunOptionName, repoExplainOptionName)
+			}
+
+			roots, err := corerepo.BestEffortRoots(n.FilesRoot)
+			if err != nil {
+				return err
+			}
 
-		gcOutChan := corerepo.GarbageCollectAsync(n, req.Context)
+			if dryRun {
+				return emitGcPreview(re, gc.DryRun(req.Context, n.Blockstore, n.Pinning, roots))
+			}
+
+			target, err := cid.Decode(explain)
+			if err != nil {
+				return err
+			}
+			has, err := n.Blockstore.Has(target)
+			if err != nil {
+				return err
+			}
+			if !has {
+				return fmt.Errorf("%s is not in the local repo", target)
+			}
+			return emitGcExplanation(re, target, gc.Explain(req.Context, n.Blockstore, n.Pinning, roots, target))
+		}
+
+		var gcOutChan <-chan gc.Result
+		if incremental {
+			gcOutChan = corerepo.IncrementalGarbageCollectAsync(n, req.Context, gc.IncrementalOptions{
+				BatchSize: batchSize,
+			})
+		} else {
+			gcOutChan = corerepo.GarbageCollectAsync(n, req.Context)
+		}
 
 		if streamErrors {
 			errs := false
@@ -111,13 +198,35 @@ order to reclaim hard disk space.
 	Encoders: cmds.EncoderMap{
 		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, gcr *GcResult) error {
 			quiet, _ := req.Options[repoQuietOptionName].(bool)
+			dryRun, _ := req.Options[repoDryRunOptionName].(bool)
+			explain, _ := req.Options[repoExplainOptionName].(string)
 
 			if gcr.Error != "" {
 				_, err := fmt.Fprintf(w, "Error: %s\n", gcr.Error)
 				return err
 			}
 
+			if gcr.Root != nil {
+				if quiet {
+					_, err := fmt.Fprintf(w, "%s\n", gcr.Root.Root)
+					return err
+				}
+				_, err := fmt.Fprintf(w, "kept by %s root %s: %d blocks, %d bytes\n", gcr.Root.Kind, gcr.Root.Root, gcr.Root.Blocks, gcr.Root.Size)
+				return err
+			}
+
+			if gcr.Total != nil {
+				if quiet {
+					return nil
+				}
+				_, err := fmt.Fprintf(w, "would free %d bytes in %d blocks\n", gcr.Total.Size, gcr.Total.Blocks)
+				return err
+			}
+
 			prefix := "removed "
+			if dryRun || explain != "" {
+				prefix = "would remove "
+			}
 			if quiet {
 				prefix = ""
 			}
@@ -128,6 +237,62 @@ order to reclaim hard disk space.
 	},
 }
 
+// emitGcPreview streams the results of a GC dry run, followed by their
+// total.
+func emitGcPreview(re cmds.ResponseEmitter, out <-chan gc.Result) error {
+	var total GcTotal
+	errs := false
+	for res := range out {
+		var gcr GcResult
+		switch {
+		case res.Error != nil:
+			gcr.Error = res.Error.Error()
+			errs = true
+		case res.Root != nil:
+			gcr.Root = res.Root
+		default:
+			gcr.Key = res.KeyRemoved
+			gcr.Size = res.Size
+			total.Blocks++
+			total.Size += res.Size
+		}
+		if err := re.Emit(&gcr); err != nil {
+			return err
+		}
+	}
+	if errs {
+		return errors.New("encountered errors during gc dry run")
+	}
+	return re.Emit(&GcResult{Total: &total})
+}
+
+// emitGcExplanation streams the GC roots keeping target, or target itself
+// if it would be removed.
+func emitGcExplanation(re cmds.ResponseEmitter, target cid.Cid, out <-chan gc.Result) error {
+	kept := false
+	errs := false
+	for res := range out {
+		var gcr GcResult
+		if res.Error != nil {
+			gcr.Error = res.Error.Error()
+			errs = true
+		} else {
+			gcr.Root = res.Root
+			kept = true
+		}
+		if err := re.Emit(&gcr); err != nil {
+			return err
+		}
+	}
+	if errs {
+		return errors.New("encountered errors during gc explanation")
+	}
+	if !kept {
+		return re.Emit(&GcResult{Key: target})
+	}
+	return nil
+}
+
 const (
 	repoSizeOnlyOptionName = "size-only"
 	repoHumanOptionName    = "human"
@@ -145,6 +310,10 @@ StorageMax      string Maximum datastore size (from configuration)
 NumObjects      int Number of objects in the local repo.
 RepoPath        string The path to the repo being currently used.
 Version         string The repo version.
+GCPolicy        string What is removed once the StorageGCWatermark is
+                       crossed (from configuration): "full" removes every
+                       unpinned block, "lru" only the least recently used.
+TrackedBlocks   int Number of blocks with a known access time (lru only).
 `,
 	},
 	Options: []cmds.Option{
@@ -203,6 +372,10 @@ Version         string The repo version.
 			if !sizeOnly {
 				fmt.Fprintf(wtr, "RepoPath:\t%s\n", stat.RepoPath)
 				fmt.Fprintf(wtr, "Version:\t%s\n", stat.Version)
+				fmt.Fprintf(wtr, "GCPolicy:\t%s\n", stat.GCPolicy)
+				if stat.GCPolicy == gc.PolicyLRU {
+					fmt.Fprintf(wtr, "TrackedBlocks:\t%d\n", stat.TrackedBlocks)
+				}
 			}
 
 			return nil
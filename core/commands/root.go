@@ -129,6 +129,7 @@ var rootSubcommands = map[string]*cmds.Command{
 	"bootstrap": BootstrapCmd,
 	"config":    ConfigCmd,
 	"dag":       dag.DagCmd,
+	"denylist":  DenylistCmd,
 	"dht":       DhtCmd,
 	"diag":      DiagCmd,
 	"dns":       DNSCmd,
@@ -12,6 +12,7 @@ import (
 
 	commands "github.com/ipfs/go-ipfs/commands"
 	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	peering "github.com/ipfs/go-ipfs/peering"
 	repo "github.com/ipfs/go-ipfs/repo"
 	fsrepo "github.com/ipfs/go-ipfs/repo/fsrepo"
 
@@ -50,6 +51,7 @@ ipfs peers in the internet.
 		"connect":    swarmConnectCmd,
 		"disconnect": swarmDisconnectCmd,
 		"filters":    swarmFiltersCmd,
+		"peering":    swarmPeeringCmd,
 		"peers":      swarmPeersCmd,
 	},
 }
@@ -770,3 +772,263 @@ func filtersRemove(r repo.Repo, cfg *config.Config, toRemoveFilters []string) ([
 
 	return removed, nil
 }
+
+const swarmPeeringPersistOptionName = "persist"
+
+var swarmPeeringCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Modify the peering subsystem.",
+		ShortDescription: `
+'ipfs swarm peering' manages the peers the node stays connected to. The peers
+are protected from the connection manager, and reconnected to with a back-off
+when the connection dies.
+
+Peers default to those specified under the "Peering.Peers" config key. Use
+--persist to save the changes to the config.
+`,
+	},
+	Subcommands: map[string]*cmds.Command{
+		"add": swarmPeeringAddCmd,
+		"ls":  swarmPeeringLsCmd,
+		"rm":  swarmPeeringRmCmd,
+	},
+}
+
+var swarmPeeringAddCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Add peers to the peering subsystem.",
+		ShortDescription: `
+'ipfs swarm peering add' adds peers to the peering subsystem. The addresses
+of a peer that is already peered are replaced. The address format is an IPFS
+multiaddr:
+
+ipfs swarm peering add /ip4/104.131.131.82/tcp/4001/p2p/QmaCpDMGvV2BGHeYERUEnRQAwe3N8SzbUtfsmvsqQLuvuJ
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("address", true, true, "Address of the peer to peer with.").EnableStdin(),
+	},
+	Options: []cmds.Option{
+		cmds.BoolOption(swarmPeeringPersistOptionName, "Also add the peers to the config."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+
+		if n.Peering == nil {
+			return ErrNotOnline
+		}
+
+		pis, err := parseAddresses(req.Context, req.Arguments)
+		if err != nil {
+			return err
+		}
+
+		if persist, _ := req.Options[swarmPeeringPersistOptionName].(bool); persist {
+			err := updatePeeringConfig(env, func(peers []peer.AddrInfo) []peer.AddrInfo {
+				return peeringAdd(peers, pis)
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		output := make([]string, len(pis))
+		for i, pi := range pis {
+			n.Peering.AddPeer(pi)
+			output[i] = "add " + pi.ID.Pretty() + " success"
+		}
+		return cmds.EmitOnce(res, &stringList{output})
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(stringListEncoder),
+	},
+	Type: stringList{},
+}
+
+var swarmPeeringRmCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Remove peers from the peering subsystem.",
+		ShortDescription: `
+'ipfs swarm peering rm' removes peers from the peering subsystem. The
+connections to the peers are no longer protected, but are not closed.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("peer", true, true, "ID of the peer to remove.").EnableStdin(),
+	},
+	Options: []cmds.Option{
+		cmds.BoolOption(swarmPeeringPersistOptionName, "Also remove the peers from the config."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+
+		if n.Peering == nil {
+			return ErrNotOnline
+		}
+
+		ids := make([]peer.ID, len(req.Arguments))
+		for i, arg := range req.Arguments {
+			ids[i], err = peer.Decode(arg)
+			if err != nil {
+				return fmt.Errorf("invalid peer ID %q: %s", arg, err)
+			}
+		}
+
+		if persist, _ := req.Options[swarmPeeringPersistOptionName].(bool); persist {
+			err := updatePeeringConfig(env, func(peers []peer.AddrInfo) []peer.AddrInfo {
+				return peeringRemove(peers, ids)
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		output := make([]string, len(ids))
+		for i, id := range ids {
+			n.Peering.RemovePeer(id)
+			output[i] = "remove " + id.Pretty() + " success"
+		}
+		return cmds.EmitOnce(res, &stringList{output})
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(stringListEncoder),
+	},
+	Type: stringList{},
+}
+
+type peeringPeer struct {
+	ID        string
+	Addrs     []string
+	State     peering.PeerState
+	NextRetry *time.Time `json:",omitempty"`
+}
+
+type peeringPeers struct {
+	Peers []peeringPeer
+}
+
+var swarmPeeringLsCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "List the peers of the peering subsystem.",
+		ShortDescription: `
+'ipfs swarm peering ls' lists the peers of the peering subsystem, with the
+state of the connection to each of them: connected, or backing off until the
+next reconnection attempt.
+`,
+	},
+	Options: []cmds.Option{
+		cmds.BoolOption(swarmVerboseOptionName, "v", "Also list the addresses of the peers."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+
+		if n.Peering == nil {
+			return ErrNotOnline
+		}
+
+		infos := n.Peering.ListPeers()
+		out := peeringPeers{Peers: make([]peeringPeer, len(infos))}
+		for i, info := range infos {
+			p := peeringPeer{
+				ID:    info.ID.Pretty(),
+				Addrs: make([]string, len(info.Addrs)),
+				State: info.State,
+			}
+			for j, addr := range info.Addrs {
+				p.Addrs[j] = addr.String()
+			}
+			if info.State == peering.PeerBackoff {
+				nextRetry := info.NextRetry
+				p.NextRetry = &nextRetry
+			}
+			out.Peers[i] = p
+		}
+		return cmds.EmitOnce(res, &out)
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *peeringPeers) error {
+			verbose, _ := req.Options[swarmVerboseOptionName].(bool)
+			for _, p := range out.Peers {
+				state := string(p.State)
+				if p.NextRetry != nil {
+					state += fmt.Sprintf(" (retry in %s)", time.Until(*p.NextRetry).Round(time.Second))
+				}
+				fmt.Fprintf(w, "%s %s\n", p.ID, state)
+				if verbose {
+					for _, addr := range p.Addrs {
+						fmt.Fprintf(w, "\t%s\n", addr)
+					}
+				}
+			}
+			return nil
+		}),
+	},
+	Type: peeringPeers{},
+}
+
+// updatePeeringConfig replaces the peers in the config with the result of
+// update.
+func updatePeeringConfig(env cmds.Environment, update func([]peer.AddrInfo) []peer.AddrInfo) error {
+	r, err := fsrepo.Open(env.(*commands.Context).ConfigRoot)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	cfg, err := r.Config()
+	if err != nil {
+		return err
+	}
+	cfg, err = cfg.Clone()
+	if err != nil {
+		return err
+	}
+
+	cfg.Peering.Peers = update(cfg.Peering.Peers)
+	return r.SetConfig(cfg)
+}
+
+// peeringAdd adds the peers to the configured peers, replacing the addresses
+// of the peers already configured.
+func peeringAdd(peers []peer.AddrInfo, added []peer.AddrInfo) []peer.AddrInfo {
+	for _, pi := range added {
+		found := false
+		for i := range peers {
+			if peers[i].ID == pi.ID {
+				peers[i].Addrs = pi.Addrs
+				found = true
+				break
+			}
+		}
+		if !found {
+			peers = append(peers, pi)
+		}
+	}
+	return peers
+}
+
+// peeringRemove removes the peers from the configured peers.
+func peeringRemove(peers []peer.AddrInfo, removed []peer.ID) []peer.AddrInfo {
+	keep := make([]peer.AddrInfo, 0, len(peers))
+	for _, pi := range peers {
+		found := false
+		for _, id := range removed {
+			if pi.ID == id {
+				found = true
+				break
+			}
+		}
+		if !found {
+			keep = append(keep, pi)
+		}
+	}
+	return keep
+}
@@ -41,12 +41,16 @@ import (
 	p2pbhost "github.com/libp2p/go-libp2p/p2p/host/basic"
 	ma "github.com/multiformats/go-multiaddr"
 
+	"github.com/ipfs/go-ipfs/audit"
 	"github.com/ipfs/go-ipfs/core/bootstrap"
 	"github.com/ipfs/go-ipfs/core/node"
 	"github.com/ipfs/go-ipfs/core/node/libp2p"
+	"github.com/ipfs/go-ipfs/denylist"
 	"github.com/ipfs/go-ipfs/fuse/mount"
+	"github.com/ipfs/go-ipfs/gc"
 	"github.com/ipfs/go-ipfs/p2p"
 	"github.com/ipfs/go-ipfs/peering"
+	"github.com/ipfs/go-ipfs/pinmeta"
 	"github.com/ipfs/go-ipfs/repo"
 	"github.com/ipfs/go-namesys"
 	ipnsrp "github.com/ipfs/go-namesys/republisher"
@@ -64,6 +68,9 @@ type IpfsNode struct {
 
 	// Local node
 	Pinning         pin.Pinner             // the pinning manager
+	PinMeta         *pinmeta.Store         // information recorded alongside pins
+	Denylist        *denylist.Denylist     // content refused to be served
+	AuditLog        *audit.Log             `optional:"true"` // audit log of the API, if enabled
 	Mounts          Mounts                 `optional:"true"` // current mount state, if any.
 	PrivateKey      ic.PrivKey             `optional:"true"` // the local node's private Key
 	PNetFingerprint libp2p.PNetFingerprint `optional:"true"` // fingerprint of private network
@@ -74,6 +81,7 @@ type IpfsNode struct {
 	Filestore       *filestore.Filestore      `optional:"true"` // the filestore blockstore
 	BaseBlocks      node.BaseBlocks           // the raw blockstore, no filestore wrapping
 	GCLocker        bstore.GCLocker           // the locker used to protect the blockstore during gc
+	WriteBarrier    *gc.WriteBarrier          // records blocks touched during incremental gc
 	Blocks          bserv.BlockService        // the block service, get/add blocks.
 	DAG             ipld.DAGService           // the merkle dag service, get/add objects.
 	Resolver        *resolver.Resolver        // the path resolution system
@@ -81,16 +89,18 @@ type IpfsNode struct {
 	Discovery       discovery.Service         `optional:"true"`
 	FilesRoot       *mfs.Root
 	RecordValidator record.Validator
+	AccessTracker   *gc.AccessTracker `optional:"true"` // block access times, with the lru GC policy
 
 	// Online
 	PeerHost      p2phost.Host            `optional:"true"` // the network host (server+client)
-	Peering       peering.PeeringService  `optional:"true"`
+	Peering       *peering.PeeringService `optional:"true"`
 	Filters       *ma.Filters             `optional:"true"`
 	Bootstrapper  io.Closer               `optional:"true"` // the periodic bootstrapper
 	Routing       routing.Routing         `optional:"true"` // the routing system. recommend ipfs-dht
 	Exchange      exchange.Interface      // the block exchange + strategy (bitswap)
 	Namesys       namesys.NameSystem      // the name system, resolves paths to hashes
 	Provider      provider.System         // the value provider system
+	Reprovide     *node.ReprovideTracker  `optional:"true"` // progress of the reprovider
 	IpnsRepub     *ipnsrp.Republisher     `optional:"true"`
 	GraphExchange graphsync.GraphExchange `optional:"true"`
 
@@ -102,6 +112,8 @@ type IpfsNode struct {
 	Process goprocess.Process
 	ctx     context.Context
 
+	reloader configReloader
+
 	stop func() error
 
 	// Flags
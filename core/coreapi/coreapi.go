@@ -39,6 +39,8 @@ import (
 
 	"github.com/ipfs/go-ipfs/core"
 	"github.com/ipfs/go-ipfs/core/node"
+	"github.com/ipfs/go-ipfs/denylist"
+	"github.com/ipfs/go-ipfs/pinmeta"
 	"github.com/ipfs/go-ipfs/repo"
 	"github.com/ipfs/go-namesys"
 )
@@ -53,6 +55,8 @@ type CoreAPI struct {
 	blockstore blockstore.GCBlockstore
 	baseBlocks blockstore.Blockstore
 	pinning    pin.Pinner
+	pinMeta    *pinmeta.Store
+	denylist   *denylist.Denylist
 
 	blocks bserv.BlockService
 	dag    ipld.DAGService
@@ -164,6 +168,8 @@ func (api *CoreAPI) WithOptions(opts ...options.ApiOption) (coreiface.CoreAPI, e
 		blockstore: n.Blockstore,
 		baseBlocks: n.BaseBlocks,
 		pinning:    n.Pinning,
+		pinMeta:    n.PinMeta,
+		denylist:   n.Denylist,
 
 		blocks: n.Blocks,
 		dag:    n.DAG,
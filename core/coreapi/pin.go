@@ -3,6 +3,7 @@ package coreapi
 import (
 	"context"
 	"fmt"
+	"time"
 
 	bserv "github.com/ipfs/go-blockservice"
 	"github.com/ipfs/go-cid"
@@ -12,11 +13,25 @@ import (
 	coreiface "github.com/ipfs/interface-go-ipfs-core"
 	caopts "github.com/ipfs/interface-go-ipfs-core/options"
 	"github.com/ipfs/interface-go-ipfs-core/path"
+
+	"github.com/ipfs/go-ipfs/pinmeta"
 )
 
 type PinAPI CoreAPI
 
 func (api *PinAPI) Add(ctx context.Context, p path.Path, opts ...caopts.PinAddOption) error {
+	return api.add(ctx, p, nil, opts...)
+}
+
+// AddWithInfo pins the given path like Add and records info alongside the
+// pin, replacing any information recorded by a previous call. Add leaves the
+// recorded name and metadata untouched but removes the expiry, so pinning
+// again makes a pin permanent.
+func (api *PinAPI) AddWithInfo(ctx context.Context, p path.Path, info pinmeta.Info, opts ...caopts.PinAddOption) error {
+	return api.add(ctx, p, &info, opts...)
+}
+
+func (api *PinAPI) add(ctx context.Context, p path.Path, info *pinmeta.Info, opts ...caopts.PinAddOption) error {
 	dagNode, err := api.core().ResolveNode(ctx, p)
 	if err != nil {
 		return fmt.Errorf("pin: %s", err)
@@ -34,6 +49,15 @@ func (api *PinAPI) Add(ctx context.Context, p path.Path, opts ...caopts.PinAddOp
 		return fmt.Errorf("pin: %s", err)
 	}
 
+	if info != nil {
+		err = api.pinMeta.Put(dagNode.Cid(), *info)
+	} else {
+		err = api.clearExpiry(dagNode.Cid())
+	}
+	if err != nil {
+		return fmt.Errorf("pin: %s", err)
+	}
+
 	if err := api.provider.Provide(dagNode.Cid()); err != nil {
 		return err
 	}
@@ -75,6 +99,44 @@ func (api *PinAPI) IsPinned(ctx context.Context, p path.Path, opts ...caopts.Pin
 	return api.pinning.IsPinnedWithType(ctx, resolved.Cid(), mode)
 }
 
+// Info returns the information recorded alongside the pin of the given path,
+// and false if there is none.
+func (api *PinAPI) Info(ctx context.Context, p path.Path) (pinmeta.Info, bool, error) {
+	rp, err := api.core().ResolvePath(ctx, p)
+	if err != nil {
+		return pinmeta.Info{}, false, err
+	}
+	return api.pinMeta.Get(rp.Cid())
+}
+
+// clearExpiry removes the expiry recorded for the pin of c, if any.
+func (api *PinAPI) clearExpiry(c cid.Cid) error {
+	info, ok, err := api.pinMeta.Get(c)
+	if err != nil || !ok || info.Expires.IsZero() {
+		return err
+	}
+	info.Expires = time.Time{}
+	return api.pinMeta.Put(c, info)
+}
+
+// AllInfo returns the information recorded alongside every pin.
+func (api *PinAPI) AllInfo(ctx context.Context) (map[cid.Cid]pinmeta.Info, error) {
+	return api.pinMeta.All()
+}
+
+// Named returns the pins with the given name.
+func (api *PinAPI) Named(ctx context.Context, name string) ([]path.Resolved, error) {
+	cids, err := api.pinMeta.Named(name)
+	if err != nil {
+		return nil, err
+	}
+	named := make([]path.Resolved, len(cids))
+	for i, c := range cids {
+		named[i] = path.IpldPath(c)
+	}
+	return named, nil
+}
+
 // Rm pin rm api
 func (api *PinAPI) Rm(ctx context.Context, p path.Path, opts ...caopts.PinRmOption) error {
 	rp, err := api.core().ResolvePath(ctx, p)
@@ -8,6 +8,7 @@ import (
 	"github.com/ipfs/go-ipfs/core"
 
 	"github.com/ipfs/go-ipfs/core/coreunix"
+	"github.com/ipfs/go-ipfs/denylist"
 
 	blockservice "github.com/ipfs/go-blockservice"
 	cid "github.com/ipfs/go-cid"
@@ -179,6 +180,10 @@ func (api *UnixfsAPI) Add(ctx context.Context, files files.Node, opts ...options
 }
 
 func (api *UnixfsAPI) Get(ctx context.Context, p path.Path) (files.Node, error) {
+	if err := api.denylist.CheckPath(ctx, api.core(), p); err != nil {
+		return nil, err
+	}
+
 	ses := api.core().getSession(ctx)
 
 	nd, err := ses.ResolveNode(ctx, p)
@@ -186,7 +191,8 @@ func (api *UnixfsAPI) Get(ctx context.Context, p path.Path) (files.Node, error)
 		return nil, err
 	}
 
-	return unixfile.NewUnixfsFile(ctx, ses.dag, nd)
+	// Blocked content under p is refused as it is read
+	return unixfile.NewUnixfsFile(ctx, denylist.NewDAGService(ses.dag, api.denylist), nd)
 }
 
 // Ls returns the contents of an IPFS or IPNS object(s) at path p, with the format:
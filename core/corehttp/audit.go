@@ -0,0 +1,160 @@
+package corehttp
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ipfs/go-ipfs/audit"
+)
+
+// auditMaxErrorSize is how much of the body of an error response is kept to
+// find the error message.
+const auditMaxErrorSize = 1024
+
+// auditRedactedConfigKeys are the config keys whose values are not recorded
+// when set with 'ipfs config'.
+var auditRedactedConfigKeys = []string{
+	"API.ClientToken",
+	APITokensSelector,
+	WriteTokensSelector,
+	"Identity.PrivKey",
+	"Pinning.RemoteServices",
+}
+
+// auditRedactedArguments are the positions of the secret arguments of
+// commands.
+var auditRedactedArguments = map[string]int{
+	"pin/remote/service/add": 2, // key
+}
+
+// auditHandler records the calls to the commands l audits.
+func auditHandler(l *audit.Log, tokens []APIToken, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cmdPath := apiCommandPath(r)
+		if r.Method == http.MethodOptions || !l.Audits(cmdPath) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		start := time.Now()
+		rec := &auditResponseWriter{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+
+		e := audit.Entry{
+			Time:    start.UTC(),
+			Remote:  r.RemoteAddr,
+			Token:   tokenIdentity(tokens, r),
+			Command: cmdPath,
+			Status:  rec.status,
+		}
+		if e.Status == 0 {
+			e.Status = http.StatusOK
+		}
+		e.Arguments, e.Options = auditArguments(cmdPath, r)
+		if msg := w.Header().Get("X-Stream-Error"); msg != "" {
+			e.Error = msg
+		} else if e.Status >= http.StatusBadRequest {
+			e.Error = errorMessage(rec.body)
+		}
+
+		if err := l.Write(e); err != nil {
+			log.Errorf("writing the audit log: %s", err)
+		}
+	})
+}
+
+// tokenIdentity identifies the token of r, if tokens are required.
+func tokenIdentity(tokens []APIToken, r *http.Request) string {
+	if len(tokens) == 0 {
+		return ""
+	}
+	secret, ok := bearerToken(r)
+	if !ok {
+		return ""
+	}
+	if t := findAPIToken(tokens, secret); t != nil {
+		return t.identity()
+	}
+	return "invalid"
+}
+
+// auditArguments returns the arguments and options of a call, with secrets
+// redacted.
+func auditArguments(cmdPath string, r *http.Request) ([]string, map[string][]string) {
+	query := r.URL.Query()
+	args := query["arg"]
+	delete(query, "arg")
+
+	redact := -1
+	if i, ok := auditRedactedArguments[cmdPath]; ok {
+		redact = i
+	}
+	if cmdPath == "config" && len(args) > 1 {
+		// Config keys are case insensitive. Setting a key under a secret key,
+		// or one holding a secret key, sets the secret.
+		key := strings.ToLower(args[0])
+		for _, k := range auditRedactedConfigKeys {
+			k = strings.ToLower(k)
+			if key == k || strings.HasPrefix(key, k+".") || strings.HasPrefix(k, key+".") {
+				redact = 1
+				break
+			}
+		}
+	}
+	if redact >= 0 && redact < len(args) {
+		args = append([]string(nil), args...)
+		args[redact] = "<redacted>"
+	}
+	if len(query) == 0 {
+		return args, nil
+	}
+	return args, query
+}
+
+// errorMessage returns the message of the error response body.
+func errorMessage(body []byte) string {
+	var cmdsErr struct {
+		Message string
+	}
+	if err := json.Unmarshal(body, &cmdsErr); err == nil && cmdsErr.Message != "" {
+		return cmdsErr.Message
+	}
+	return strings.TrimSpace(string(body))
+}
+
+// auditResponseWriter records the status of a response, and the start of its
+// body when it is an error.
+type auditResponseWriter struct {
+	http.ResponseWriter
+	status int
+	body   []byte
+}
+
+func (w *auditResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *auditResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if w.status >= http.StatusBadRequest && len(w.body) < auditMaxErrorSize {
+		n := auditMaxErrorSize - len(w.body)
+		if n > len(b) {
+			n = len(b)
+		}
+		w.body = append(w.body, b[:n]...)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *auditResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
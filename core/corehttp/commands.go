@@ -1,6 +1,9 @@
 package corehttp
 
 import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"net"
@@ -13,6 +16,7 @@ import (
 	oldcmds "github.com/ipfs/go-ipfs/commands"
 	"github.com/ipfs/go-ipfs/core"
 	corecommands "github.com/ipfs/go-ipfs/core/commands"
+	"github.com/ipfs/go-ipfs/repo"
 
 	cmds "github.com/ipfs/go-ipfs-cmds"
 	cmdsHttp "github.com/ipfs/go-ipfs-cmds/http"
@@ -119,7 +123,104 @@ func patchCORSVars(c *cmdsHttp.ServerConfig, addr net.Addr) {
 	c.SetAllowedOrigins(newOrigins...)
 }
 
-func commandsOption(cctx oldcmds.Context, command *cmds.Command, allowGet bool) ServeOption {
+// APITokensSelector is the configuration key of the tokens authorizing calls
+// to the API.
+const APITokensSelector = "API.Tokens"
+
+// APIToken is a bearer token authorizing calls to a set of commands.
+type APIToken struct {
+	// Name identifies the token in the audit log. The token is identified by
+	// a hash of its secret when empty.
+	Name string
+
+	// Token is the secret sent in the Authorization header.
+	Token string
+
+	// Commands lists the paths of the commands the token authorizes, such as
+	// "cat" or "pin/ls". A path authorizes its subcommands, and "*"
+	// authorizes every command.
+	Commands []string
+}
+
+func (t APIToken) validate() error {
+	if t.Token == "" {
+		return fmt.Errorf("%s: empty token", APITokensSelector)
+	}
+	if len(t.Commands) == 0 {
+		return fmt.Errorf("%s: token authorizes no command", APITokensSelector)
+	}
+	return nil
+}
+
+// identity is the name of the token in the audit log.
+func (t APIToken) identity() string {
+	if t.Name != "" {
+		return t.Name
+	}
+	h := sha256.Sum256([]byte(t.Token))
+	return "sha256:" + hex.EncodeToString(h[:8])
+}
+
+func (t APIToken) allows(cmdPath string) bool {
+	for _, c := range t.Commands {
+		c = strings.Trim(c, "/")
+		if c == "*" || cmdPath == c || strings.HasPrefix(cmdPath, c+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// findAPIToken returns the token with the given secret, or nil.
+func findAPIToken(tokens []APIToken, secret string) *APIToken {
+	for i := range tokens {
+		if subtle.ConstantTimeCompare([]byte(tokens[i].Token), []byte(secret)) == 1 {
+			return &tokens[i]
+		}
+	}
+	return nil
+}
+
+// apiAuthHandler only lets through the calls to commands authorized by the
+// bearer token of the request.
+func apiAuthHandler(tokens []APIToken, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// CORS preflight requests carry no credentials
+		if r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token, ok := bearerToken(r)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="ipfs-api"`)
+			http.Error(w, "missing bearer token", http.StatusUnauthorized)
+			return
+		}
+
+		match := findAPIToken(tokens, token)
+		if match == nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="ipfs-api", error="invalid_token"`)
+			http.Error(w, "invalid bearer token", http.StatusUnauthorized)
+			return
+		}
+
+		cmdPath := apiCommandPath(r)
+		if !match.allows(cmdPath) {
+			http.Error(w, fmt.Sprintf("token does not allow the command %q", cmdPath), http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// apiCommandPath returns the path of the command called by r, such as
+// "pin/ls".
+func apiCommandPath(r *http.Request) string {
+	return strings.Trim(strings.TrimPrefix(r.URL.Path, APIPath), "/")
+}
+
+func commandsOption(cctx oldcmds.Context, command *cmds.Command, allowGet bool, protect bool) ServeOption {
 	return func(n *core.IpfsNode, l net.Listener, mux *http.ServeMux) (*http.ServeMux, error) {
 
 		cfg := cmdsHttp.NewServerConfig()
@@ -141,22 +242,52 @@ func commandsOption(cctx oldcmds.Context, command *cmds.Command, allowGet bool)
 		addCORSDefaults(cfg)
 		patchCORSVars(cfg, l.Addr())
 
-		cmdHandler := cmdsHttp.NewHandler(&cctx, command, cfg)
+		var cmdHandler http.Handler = cmdsHttp.NewHandler(&cctx, command, cfg)
+		if protect {
+			cmdHandler, err = protectCommands(n, cmdHandler)
+			if err != nil {
+				return nil, err
+			}
+		}
 		mux.Handle(APIPath+"/", cmdHandler)
 		return mux, nil
 	}
 }
 
+// protectCommands requires the tokens of API.Tokens, when set, and records
+// the calls in the audit log, when enabled.
+func protectCommands(n *core.IpfsNode, h http.Handler) (http.Handler, error) {
+	var tokens []APIToken
+	if _, err := repo.ReadConfigKey(n.Repo, APITokensSelector, &tokens); err != nil {
+		return nil, err
+	}
+	for _, t := range tokens {
+		if err := t.validate(); err != nil {
+			return nil, err
+		}
+	}
+	if len(tokens) > 0 {
+		h = apiAuthHandler(tokens, h)
+	}
+
+	// The audit log is shared by the API listeners of the node
+	if n.AuditLog != nil {
+		h = auditHandler(n.AuditLog, tokens, h)
+	}
+	return h, nil
+}
+
 // CommandsOption constructs a ServerOption for hooking the commands into the
-// HTTP server. It will NOT allow GET requests.
+// HTTP server. It will NOT allow GET requests. Calls need a token of
+// API.Tokens, when set, and are recorded in the audit log, when enabled.
 func CommandsOption(cctx oldcmds.Context) ServeOption {
-	return commandsOption(cctx, corecommands.Root, false)
+	return commandsOption(cctx, corecommands.Root, false, true)
 }
 
 // CommandsROOption constructs a ServerOption for hooking the read-only commands
 // into the HTTP server. It will allow GET requests.
 func CommandsROOption(cctx oldcmds.Context) ServeOption {
-	return commandsOption(cctx, corecommands.RootRO, true)
+	return commandsOption(cctx, corecommands.RootRO, true, false)
 }
 
 // CheckVersionOption returns a ServeOption that checks whether the client ipfs version matches. Does nothing when the user agent string does not contain `/go-ipfs/`
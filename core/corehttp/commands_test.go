@@ -0,0 +1,168 @@
+package corehttp
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/ipfs/go-ipfs/audit"
+)
+
+func TestAPITokenAuth(t *testing.T) {
+	tokens := []APIToken{
+		{Token: "reader", Commands: []string{"cat", "pin/ls"}},
+		{Token: "admin", Commands: []string{"*"}},
+	}
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	h := apiAuthHandler(tokens, next)
+
+	for _, tc := range []struct {
+		method string
+		path   string
+		token  string
+		status int
+	}{
+		{http.MethodPost, "/api/v0/cat", "", http.StatusUnauthorized},
+		{http.MethodPost, "/api/v0/cat", "wrong", http.StatusUnauthorized},
+		{http.MethodPost, "/api/v0/cat", "reader", http.StatusOK},
+		{http.MethodPost, "/api/v0/pin/ls", "reader", http.StatusOK},
+		{http.MethodPost, "/api/v0/pin/add", "reader", http.StatusForbidden},
+		{http.MethodPost, "/api/v0/catalog", "reader", http.StatusForbidden},
+		{http.MethodPost, "/api/v0/add", "reader", http.StatusForbidden},
+		{http.MethodPost, "/api/v0/pin/add", "admin", http.StatusOK},
+		{http.MethodOptions, "/api/v0/add", "", http.StatusOK},
+	} {
+		req := httptest.NewRequest(tc.method, tc.path, nil)
+		if tc.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tc.token)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != tc.status {
+			t.Errorf("%s %s with token %q: expected %d, got %d", tc.method, tc.path, tc.token, tc.status, rec.Code)
+		}
+		if rec.Code == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("%s %s: missing WWW-Authenticate header", tc.method, tc.path)
+		}
+	}
+}
+
+func TestAPITokenValidate(t *testing.T) {
+	if err := (APIToken{Commands: []string{"cat"}}).validate(); err == nil {
+		t.Error("expected an empty token to be invalid")
+	}
+	if err := (APIToken{Token: "t"}).validate(); err == nil {
+		t.Error("expected a token without commands to be invalid")
+	}
+	if err := (APIToken{Token: "t", Commands: []string{"cat"}}).validate(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestAuditHandler(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	l, err := audit.Open(dir, audit.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	tokens := []APIToken{
+		{Name: "ci", Token: "secret", Commands: []string{"*"}},
+	}
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("arg") == "fail" {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{"Message":"pin failed","Code":0,"Type":"error"}`))
+			return
+		}
+		w.Write([]byte("ok"))
+	})
+	h := auditHandler(l, tokens, apiAuthHandler(tokens, next))
+
+	for _, tc := range []struct {
+		path  string
+		token string
+	}{
+		{"/api/v0/pin/add?arg=bafkqaaa&recursive=true", "secret"},
+		{"/api/v0/pin/ls", "secret"},
+		{"/api/v0/pin/add?arg=fail", "secret"},
+		{"/api/v0/key/gen?arg=k", "wrong"},
+		{"/api/v0/config?arg=API.ClientToken&arg=other", "secret"},
+		{"/api/v0/pin/remote/service/add?arg=svc&arg=https://pin.example.com&arg=key", "secret"},
+	} {
+		req := httptest.NewRequest(http.MethodPost, tc.path, nil)
+		req.Header.Set("Authorization", "Bearer "+tc.token)
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	var entries []audit.Entry
+	if err := audit.Read(dir, func(e audit.Entry) error {
+		entries = append(entries, e)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 5 {
+		t.Fatalf("expected 5 audited calls, got %d", len(entries))
+	}
+
+	if e := entries[0]; e.Command != "pin/add" || e.Token != "ci" || e.Status != http.StatusOK ||
+		len(e.Arguments) != 1 || e.Arguments[0] != "bafkqaaa" || e.Options["recursive"][0] != "true" {
+		t.Errorf("unexpected entry of a successful call: %+v", e)
+	}
+	if e := entries[1]; e.Status != http.StatusInternalServerError || e.Error != "pin failed" {
+		t.Errorf("unexpected entry of a failed call: %+v", e)
+	}
+	if e := entries[2]; e.Command != "key/gen" || e.Token != "invalid" || e.Status != http.StatusUnauthorized {
+		t.Errorf("unexpected entry of an unauthorized call: %+v", e)
+	}
+	if e := entries[3]; len(e.Arguments) != 2 || e.Arguments[1] != "<redacted>" {
+		t.Errorf("expected the config value to be redacted: %+v", e)
+	}
+	if e := entries[4]; len(e.Arguments) != 3 || e.Arguments[1] != "https://pin.example.com" || e.Arguments[2] != "<redacted>" {
+		t.Errorf("expected the key of the pinning service to be redacted: %+v", e)
+	}
+}
+
+func TestAuditConfigArguments(t *testing.T) {
+	for key, redacted := range map[string]bool{
+		"API.ClientToken":                    true,
+		"API.Tokens.0.Token":                 true,
+		"api.tokens":                         true,
+		"Pinning.RemoteServices.svc.API.Key": true,
+		// the values of parents hold the secrets
+		"API":              true,
+		"Gateway":          true,
+		"Identity":         true,
+		"Pinning":          true,
+		"API.HTTPHeaders":  false,
+		"Gateway.Writable": false,
+		"Addresses.API":    false,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/api/v0/config?arg="+key+"&arg=value&json=true", nil)
+		args, _ := auditArguments("config", req)
+		if (args[1] == "<redacted>") != redacted {
+			t.Errorf("%s: expected the value to be redacted: %t, got %q", key, redacted, args[1])
+		}
+		if args[0] != key {
+			t.Errorf("expected the key %s to be kept, got %q", key, args[0])
+		}
+	}
+
+	// Reading a key records no value
+	req := httptest.NewRequest(http.MethodPost, "/api/v0/config?arg=API", nil)
+	if args, _ := auditArguments("config", req); len(args) != 1 || args[0] != "API" {
+		t.Errorf("unexpected arguments %q", args)
+	}
+}
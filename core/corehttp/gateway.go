@@ -9,7 +9,10 @@ import (
 	version "github.com/ipfs/go-ipfs"
 	core "github.com/ipfs/go-ipfs/core"
 	coreapi "github.com/ipfs/go-ipfs/core/coreapi"
+	denylist "github.com/ipfs/go-ipfs/denylist"
+	repo "github.com/ipfs/go-ipfs/repo"
 
+	config "github.com/ipfs/go-ipfs-config"
 	options "github.com/ipfs/interface-go-ipfs-core/options"
 	id "github.com/libp2p/go-libp2p/p2p/protocol/identify"
 )
@@ -18,8 +21,23 @@ type GatewayConfig struct {
 	Headers      map[string][]string
 	Writable     bool
 	PathPrefixes []string
+
+	// TrustlessOnly refuses deserialized responses: only raw blocks and CAR
+	// files, which clients can verify, are served.
+	TrustlessOnly bool
+
+	// Denylist is the content answered with 410 Gone.
+	Denylist *denylist.Denylist
+
+	// WriteTokens authorize writes when Writable is set. Writes are not
+	// authenticated when it is empty.
+	WriteTokens []GatewayWriteToken
 }
 
+// TrustlessOnlySelector is the configuration key enabling
+// GatewayConfig.TrustlessOnly.
+const TrustlessOnlySelector = "Gateway.TrustlessOnly"
+
 // A helper function to clean up a set of headers:
 // 1. Canonicalizes.
 // 2. Deduplicates.
@@ -52,47 +70,35 @@ func GatewayOption(writable bool, paths ...string) ServeOption {
 			return nil, err
 		}
 
-		headers := make(map[string][]string, len(cfg.Gateway.HTTPHeaders))
-		for h, v := range cfg.Gateway.HTTPHeaders {
-			headers[http.CanonicalHeaderKey(h)] = v
+		var trustlessOnly bool
+		if _, err := repo.ReadConfigKey(n.Repo, TrustlessOnlySelector, &trustlessOnly); err != nil {
+			return nil, err
 		}
 
-		// Hard-coded headers.
-		const ACAHeadersName = "Access-Control-Allow-Headers"
-		const ACEHeadersName = "Access-Control-Expose-Headers"
-		const ACAOriginName = "Access-Control-Allow-Origin"
-		const ACAMethodsName = "Access-Control-Allow-Methods"
-
-		if _, ok := headers[ACAOriginName]; !ok {
-			// Default to *all*
-			headers[ACAOriginName] = []string{"*"}
+		var writeTokens []GatewayWriteToken
+		if _, err := repo.ReadConfigKey(n.Repo, WriteTokensSelector, &writeTokens); err != nil {
+			return nil, err
 		}
-		if _, ok := headers[ACAMethodsName]; !ok {
-			// Default to GET
-			headers[ACAMethodsName] = []string{http.MethodGet}
+		for _, t := range writeTokens {
+			if err := t.validate(); err != nil {
+				return nil, err
+			}
 		}
 
-		headers[ACAHeadersName] = cleanHeaderSet(
-			append([]string{
-				"Content-Type",
-				"User-Agent",
-				"Range",
-				"X-Requested-With",
-			}, headers[ACAHeadersName]...))
-
-		headers[ACEHeadersName] = cleanHeaderSet(
-			append([]string{
-				"Content-Range",
-				"X-Chunked-Output",
-				"X-Stream-Output",
-			}, headers[ACEHeadersName]...))
-
 		gateway := newGatewayHandler(GatewayConfig{
-			Headers:      headers,
-			Writable:     writable,
-			PathPrefixes: cfg.Gateway.PathPrefixes,
+			Headers:       gatewayHeaders(cfg),
+			Writable:      writable,
+			PathPrefixes:  cfg.Gateway.PathPrefixes,
+			TrustlessOnly: trustlessOnly,
+			Denylist:      n.Denylist,
+			WriteTokens:   writeTokens,
 		}, api)
 
+		n.OnConfigReload(func(cfg *config.Config) error {
+			gateway.setHeaders(gatewayHeaders(cfg))
+			return nil
+		}, "Gateway.HTTPHeaders")
+
 		for _, p := range paths {
 			mux.Handle(p+"/", gateway)
 		}
@@ -100,6 +106,46 @@ func GatewayOption(writable bool, paths ...string) ServeOption {
 	}
 }
 
+// gatewayHeaders returns the headers of Gateway.HTTPHeaders, with the CORS
+// headers the gateway needs.
+func gatewayHeaders(cfg *config.Config) map[string][]string {
+	headers := make(map[string][]string, len(cfg.Gateway.HTTPHeaders))
+	for h, v := range cfg.Gateway.HTTPHeaders {
+		headers[http.CanonicalHeaderKey(h)] = v
+	}
+
+	// Hard-coded headers.
+	const ACAHeadersName = "Access-Control-Allow-Headers"
+	const ACEHeadersName = "Access-Control-Expose-Headers"
+	const ACAOriginName = "Access-Control-Allow-Origin"
+	const ACAMethodsName = "Access-Control-Allow-Methods"
+
+	if _, ok := headers[ACAOriginName]; !ok {
+		// Default to *all*
+		headers[ACAOriginName] = []string{"*"}
+	}
+	if _, ok := headers[ACAMethodsName]; !ok {
+		// Default to GET
+		headers[ACAMethodsName] = []string{http.MethodGet}
+	}
+
+	headers[ACAHeadersName] = cleanHeaderSet(
+		append([]string{
+			"Content-Type",
+			"User-Agent",
+			"Range",
+			"X-Requested-With",
+		}, headers[ACAHeadersName]...))
+
+	headers[ACEHeadersName] = cleanHeaderSet(
+		append([]string{
+			"Content-Range",
+			"X-Chunked-Output",
+			"X-Stream-Output",
+		}, headers[ACEHeadersName]...))
+	return headers
+}
+
 func VersionOption() ServeOption {
 	return func(_ *core.IpfsNode, _ net.Listener, mux *http.ServeMux) (*http.ServeMux, error) {
 		mux.HandleFunc("/version", func(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,183 @@
+package corehttp
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+
+	cid "github.com/ipfs/go-cid"
+)
+
+// WriteTokensSelector is the configuration key of the tokens authorizing
+// writes to the writable gateway.
+const WriteTokensSelector = "Gateway.WriteTokens"
+
+// GatewayWriteToken is a bearer token authorizing writes to the writable
+// gateway. Empty scopes do not restrict the token.
+type GatewayWriteToken struct {
+	// Token is the secret sent in the Authorization header.
+	Token string
+
+	// Methods lists the HTTP methods the token authorizes, out of POST, PUT
+	// and DELETE.
+	Methods []string
+
+	// Paths lists the /ipfs/ paths under which PUT and DELETE requests are
+	// authorized.
+	Paths []string
+
+	// Keys lists the names or IDs of IPNS keys. PUT and DELETE requests are
+	// authorized under the paths the keys currently point to.
+	Keys []string
+}
+
+// validate checks the token can be used.
+func (t GatewayWriteToken) validate() error {
+	if t.Token == "" {
+		return fmt.Errorf("%s: empty token", WriteTokensSelector)
+	}
+	for _, m := range t.Methods {
+		switch m {
+		case http.MethodPost, http.MethodPut, http.MethodDelete:
+		default:
+			return fmt.Errorf("%s: unsupported method %q, expected POST, PUT or DELETE", WriteTokensSelector, m)
+		}
+	}
+	for _, p := range t.Paths {
+		if _, _, err := parseIpfsPath(p); err != nil {
+			return fmt.Errorf("%s: invalid path %q: %s", WriteTokensSelector, p, err)
+		}
+	}
+	return nil
+}
+
+func (t GatewayWriteToken) allowsMethod(method string) bool {
+	if len(t.Methods) == 0 {
+		return true
+	}
+	for _, m := range t.Methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// authorizeWrite checks the bearer token of a write request. When no token is
+// configured, every write is authorized. It writes a 401 or 403 response and
+// returns false when the request is not authorized.
+func (i *gatewayHandler) authorizeWrite(w http.ResponseWriter, r *http.Request) bool {
+	if len(i.config.WriteTokens) == 0 {
+		return true
+	}
+
+	token, ok := bearerToken(r)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="ipfs-gateway"`)
+		http.Error(w, "WritableGateway: missing bearer token", http.StatusUnauthorized)
+		return false
+	}
+
+	var scope *GatewayWriteToken
+	for idx := range i.config.WriteTokens {
+		t := &i.config.WriteTokens[idx]
+		if subtle.ConstantTimeCompare([]byte(t.Token), []byte(token)) == 1 {
+			scope = t
+			break
+		}
+	}
+	if scope == nil {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="ipfs-gateway", error="invalid_token"`)
+		http.Error(w, "WritableGateway: invalid bearer token", http.StatusUnauthorized)
+		return false
+	}
+
+	if !scope.allowsMethod(r.Method) {
+		http.Error(w, "WritableGateway: token does not allow "+r.Method, http.StatusForbidden)
+		return false
+	}
+
+	// POST adds new content, unrelated to the request path
+	if r.Method == http.MethodPost || (len(scope.Paths) == 0 && len(scope.Keys) == 0) {
+		return true
+	}
+
+	allowed, err := i.allowsPath(r.Context(), scope, r.URL.Path)
+	if err != nil {
+		webError(w, "WritableGateway: failed to check the token scope", err, http.StatusInternalServerError)
+		return false
+	}
+	if !allowed {
+		http.Error(w, "WritableGateway: token does not allow writes to "+r.URL.Path, http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// allowsPath returns true if urlPath is under one of the paths of the token,
+// or one of the paths its keys point to.
+func (i *gatewayHandler) allowsPath(ctx context.Context, t *GatewayWriteToken, urlPath string) (bool, error) {
+	prefixes := append([]string(nil), t.Paths...)
+
+	if len(t.Keys) > 0 {
+		keys, err := i.api.Key().List(ctx)
+		if err != nil {
+			return false, err
+		}
+		for _, k := range keys {
+			if !containsKey(t.Keys, k.Name(), k.ID().Pretty()) {
+				continue
+			}
+			p, err := i.api.Name().Resolve(ctx, k.Path().String())
+			if err != nil {
+				// nothing published with the key yet
+				log.Debugf("resolving key %s: %s", k.Name(), err)
+				continue
+			}
+			prefixes = append(prefixes, p.String())
+		}
+	}
+
+	root, subpath, err := parseIpfsPath(urlPath)
+	if err != nil {
+		return false, nil
+	}
+	for _, prefix := range prefixes {
+		if underIpfsPath(prefix, root, subpath) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// underIpfsPath returns true if the path made of root and subpath is prefix,
+// or under it. CIDs of both versions match.
+func underIpfsPath(prefix string, root cid.Cid, subpath string) bool {
+	prefixRoot, prefixSub, err := parseIpfsPath(prefix)
+	if err != nil || !bytes.Equal(prefixRoot.Hash(), root.Hash()) {
+		return false
+	}
+	return prefixSub == "" || subpath == prefixSub || strings.HasPrefix(subpath, prefixSub+"/")
+}
+
+func containsKey(keys []string, name string, id string) bool {
+	for _, k := range keys {
+		if k == name || k == id {
+			return true
+		}
+	}
+	return false
+}
+
+// bearerToken returns the token of the Authorization header.
+func bearerToken(r *http.Request) (string, bool) {
+	auth := r.Header.Get("Authorization")
+	const prefix = "Bearer "
+	if len(auth) <= len(prefix) || !strings.EqualFold(auth[:len(prefix)], prefix) {
+		return "", false
+	}
+	return strings.TrimSpace(auth[len(prefix):]), true
+}
@@ -2,6 +2,7 @@ package corehttp
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"html/template"
 	"io"
@@ -14,6 +15,7 @@ import (
 	"runtime/debug"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	humanize "github.com/dustin/go-humanize"
@@ -21,10 +23,12 @@ import (
 	"github.com/ipfs/go-cid"
 	files "github.com/ipfs/go-ipfs-files"
 	assets "github.com/ipfs/go-ipfs/assets"
+	denylist "github.com/ipfs/go-ipfs/denylist"
 	dag "github.com/ipfs/go-merkledag"
 	mfs "github.com/ipfs/go-mfs"
 	path "github.com/ipfs/go-path"
 	"github.com/ipfs/go-path/resolver"
+	unixfile "github.com/ipfs/go-unixfs/file"
 	coreiface "github.com/ipfs/interface-go-ipfs-core"
 	ipath "github.com/ipfs/interface-go-ipfs-core/path"
 	routing "github.com/libp2p/go-libp2p-core/routing"
@@ -60,8 +64,12 @@ type redirectTemplateData struct {
 // gatewayHandler is a HTTP handler that serves IPFS objects (accessible by default at /ipfs/<path>)
 // (it serves requests like GET /ipfs/QmVRzPKPzNtSrEzBFm2UZfxmPAgnaLke4DMcerbsGGSaFe/link)
 type gatewayHandler struct {
-	config GatewayConfig
-	api    coreiface.CoreAPI
+	config    GatewayConfig
+	api       coreiface.CoreAPI
+	redirects *redirectsCache
+
+	// headersLk guards config.Headers, replaced on config reloads
+	headersLk sync.RWMutex
 }
 
 // StatusResponseWriter enables us to override HTTP Status Code passed to
@@ -85,8 +93,9 @@ func (sw *statusResponseWriter) WriteHeader(code int) {
 
 func newGatewayHandler(c GatewayConfig, api coreiface.CoreAPI) *gatewayHandler {
 	i := &gatewayHandler{
-		config: c,
-		api:    api,
+		config:    c,
+		api:       api,
+		redirects: newRedirectsCache(),
 	}
 	return i
 }
@@ -126,6 +135,13 @@ func (i *gatewayHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}()
 
 	if i.config.Writable {
+		switch r.Method {
+		case http.MethodPost, http.MethodPut, http.MethodDelete:
+			if !i.authorizeWrite(w, r) {
+				return
+			}
+		}
+
 		switch r.Method {
 		case http.MethodPost:
 			i.postHandler(w, r)
@@ -177,6 +193,11 @@ func (i *gatewayHandler) getOrHeadHandler(w http.ResponseWriter, r *http.Request
 	urlPath := r.URL.Path
 	escapedURLPath := r.URL.EscapedPath()
 
+	// The same path is served in several formats depending on the Accept
+	// header, so every response varies on it, including errors and
+	// redirects.
+	w.Header().Set("Vary", "Accept")
+
 	// If the gateway is behind a reverse proxy and mounted at a sub-path,
 	// the prefix header can be set to signal this sub-path.
 	// It will be prepended to links in directory listings and the index.html redirect.
@@ -249,6 +270,19 @@ func (i *gatewayHandler) getOrHeadHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	// Detect when an explicit response format was requested with the format
+	// query parameter or the Accept header
+	responseFormat, err := customResponseFormat(r)
+	if err != nil {
+		webError(w, "error while processing the requested response format", err, http.StatusBadRequest)
+		return
+	}
+	if i.config.TrustlessOnly && responseFormat != rawResponseFormat && responseFormat != carResponseFormat {
+		err := fmt.Errorf("only verifiable responses are served, request %s or %s", rawResponseFormat, carResponseFormat)
+		webError(w, "trustless gateway", err, http.StatusNotAcceptable)
+		return
+	}
+
 	// Resolve path to the final DAG node for the ETag
 	resolvedPath, err := i.api.ResolvePath(r.Context(), parsedPath)
 	switch err {
@@ -257,6 +291,9 @@ func (i *gatewayHandler) getOrHeadHandler(w http.ResponseWriter, r *http.Request
 		webError(w, "ipfs resolve -r "+escapedURLPath, err, http.StatusServiceUnavailable)
 		return
 	default:
+		if i.serveRedirectsIfPresent(w, r, urlPath) {
+			return
+		}
 		if i.servePretty404IfPresent(w, r, parsedPath) {
 			return
 		}
@@ -265,6 +302,35 @@ func (i *gatewayHandler) getOrHeadHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	if err := i.config.Denylist.CheckPath(r.Context(), i.api, parsedPath); err != nil {
+		webError(w, "ipfs resolve -r "+escapedURLPath, err, http.StatusInternalServerError)
+		return
+	}
+
+	switch responseFormat {
+	case "": // deserialized response, continue below
+	case carResponseFormat:
+		i.serveCar(w, r, resolvedPath, urlPath)
+		return
+	case rawResponseFormat:
+		if i.config.TrustlessOnly && len(path.FromString(urlPath).Segments()) > 2 {
+			// The block alone doesn't prove it is at that path.
+			err := fmt.Errorf("only the block of a CID is verifiable, request %s for paths", carResponseFormat)
+			webError(w, "trustless gateway", err, http.StatusBadRequest)
+			return
+		}
+		i.serveRawBlock(w, r, resolvedPath, urlPath)
+		return
+	case tarResponseFormat:
+		i.serveTar(w, r, resolvedPath, urlPath)
+		return
+	case jsonResponseFormat:
+		if i.serveDirectoryJSON(w, r, resolvedPath, urlPath) {
+			return
+		}
+		// not a directory, serve the file itself
+	}
+
 	dr, err := i.api.Unixfs().Get(r.Context(), resolvedPath)
 	if err != nil {
 		webError(w, "ipfs cat "+escapedURLPath, err, http.StatusNotFound)
@@ -317,9 +383,7 @@ func (i *gatewayHandler) getOrHeadHandler(w http.ResponseWriter, r *http.Request
 			if r.URL.Query().Get("download") == "true" {
 				disposition = "attachment"
 			}
-			utf8Name := url.PathEscape(urlFilename)
-			asciiName := url.PathEscape(onlyAscii.ReplaceAllLiteralString(urlFilename, "_"))
-			w.Header().Set("Content-Disposition", fmt.Sprintf("%s; filename=\"%s\"; filename*=UTF-8''%s", disposition, asciiName, utf8Name))
+			setContentDispositionHeader(w, urlFilename, disposition)
 			name = urlFilename
 		} else {
 			name = getFilename(urlPath)
@@ -361,7 +425,7 @@ func (i *gatewayHandler) getOrHeadHandler(w http.ResponseWriter, r *http.Request
 	case resolver.ErrNoLink:
 		// no index.html; noop
 	default:
-		internalWebError(w, err)
+		webError(w, "ipfs get "+urlPath+"/index.html", err, http.StatusInternalServerError)
 		return
 	}
 
@@ -381,9 +445,27 @@ func (i *gatewayHandler) getOrHeadHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	// The entries are listed from the DAG itself: Unixfs().Get refuses to
+	// read blocked entries, but their names and sizes are still listed.
+	dirNode, err := i.api.ResolveNode(r.Context(), resolvedPath)
+	if err != nil {
+		internalWebError(w, err)
+		return
+	}
+	listed, err := unixfile.NewUnixfsFile(r.Context(), i.api.Dag(), dirNode)
+	if err != nil {
+		internalWebError(w, err)
+		return
+	}
+	listedDir, ok := listed.(files.Directory)
+	if !ok {
+		internalWebError(w, fmt.Errorf("unsupported file type"))
+		return
+	}
+
 	// storage for directory listing
 	var dirListing []directoryItem
-	dirit := dir.Entries()
+	dirit := listedDir.Entries()
 	for dirit.Next() {
 		size := "?"
 		if s, err := dirit.Node().Size(); err == nil {
@@ -475,6 +557,79 @@ func (i *gatewayHandler) getOrHeadHandler(w http.ResponseWriter, r *http.Request
 	}
 }
 
+// customResponseFormat returns the media type requested with the format query
+// parameter, or else with the Accept header. It returns an empty string when
+// the default, deserialized, response is expected: when no other format is
+// accepted, or when HTML is preferred over them. Formats are ranked by their
+// q-value, then by their order in the header.
+func customResponseFormat(r *http.Request) (string, error) {
+	if format := r.URL.Query().Get("format"); format != "" {
+		switch format {
+		case "car":
+			return carResponseFormat, nil
+		case "raw":
+			return rawResponseFormat, nil
+		case "tar":
+			return tarResponseFormat, nil
+		case "json":
+			return jsonResponseFormat, nil
+		default:
+			return "", fmt.Errorf("unsupported format %q", format)
+		}
+	}
+	var format string
+	var formatQ, htmlQ float64
+	for _, accept := range r.Header.Values("Accept") {
+		for _, value := range strings.Split(accept, ",") {
+			mediatype, params, err := mime.ParseMediaType(strings.TrimSpace(value))
+			if err != nil {
+				continue
+			}
+			q := 1.0
+			if s, ok := params["q"]; ok {
+				q, err = strconv.ParseFloat(s, 64)
+				if err != nil || q < 0 || q > 1 {
+					continue
+				}
+			}
+			switch mediatype {
+			case carResponseFormat, rawResponseFormat, jsonResponseFormat:
+				if q > formatQ {
+					format, formatQ = mediatype, q
+				}
+			case "text/html", "text/*", "*/*":
+				if q > htmlQ {
+					htmlQ = q
+				}
+			}
+		}
+	}
+	// q=0 means not acceptable
+	if formatQ == 0 || htmlQ > formatQ {
+		return "", nil
+	}
+	return format, nil
+}
+
+// setCacheControlForPath marks responses for /ipfs/ paths as immutable.
+// Responses for /ipns/ paths must be revalidated, as the name may point at
+// other content on the next request.
+func setCacheControlForPath(w http.ResponseWriter, urlPath string) {
+	if strings.HasPrefix(urlPath, ipnsPathPrefix) {
+		w.Header().Set("Cache-Control", "no-cache")
+	} else {
+		w.Header().Set("Cache-Control", "public, max-age=29030400, immutable")
+	}
+}
+
+// setContentDispositionHeader sets the Content-Disposition header with both
+// the ASCII and UTF-8 forms of the filename.
+func setContentDispositionHeader(w http.ResponseWriter, filename string, disposition string) {
+	utf8Name := url.PathEscape(filename)
+	asciiName := url.PathEscape(onlyAscii.ReplaceAllLiteralString(filename, "_"))
+	w.Header().Set("Content-Disposition", fmt.Sprintf("%s; filename=\"%s\"; filename*=UTF-8''%s", disposition, asciiName, utf8Name))
+}
+
 func (i *gatewayHandler) serveFile(w http.ResponseWriter, req *http.Request, name string, modtime time.Time, file files.File) {
 	size, err := file.Size()
 	if err != nil {
@@ -731,11 +886,19 @@ func (i *gatewayHandler) deleteHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func (i *gatewayHandler) addUserHeaders(w http.ResponseWriter) {
+	i.headersLk.RLock()
+	defer i.headersLk.RUnlock()
 	for k, v := range i.config.Headers {
 		w.Header()[k] = v
 	}
 }
 
+func (i *gatewayHandler) setHeaders(headers map[string][]string) {
+	i.headersLk.Lock()
+	i.config.Headers = headers
+	i.headersLk.Unlock()
+}
+
 func webError(w http.ResponseWriter, message string, err error, defaultCode int) {
 	if _, ok := err.(resolver.ErrNoLink); ok {
 		webErrorWithCode(w, message, err, http.StatusNotFound)
@@ -743,6 +906,8 @@ func webError(w http.ResponseWriter, message string, err error, defaultCode int)
 		webErrorWithCode(w, message, err, http.StatusNotFound)
 	} else if err == context.DeadlineExceeded {
 		webErrorWithCode(w, message, err, http.StatusRequestTimeout)
+	} else if errors.Is(err, denylist.ErrBlocked) {
+		webErrorWithCode(w, message, err, http.StatusGone)
 	} else {
 		webErrorWithCode(w, message, err, defaultCode)
 	}
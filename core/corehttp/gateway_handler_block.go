@@ -0,0 +1,40 @@
+package corehttp
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	ipath "github.com/ipfs/interface-go-ipfs-core/path"
+)
+
+const rawResponseFormat = "application/vnd.ipld.raw"
+
+// serveRawBlock returns the block resolvedPath points at, as stored, so that
+// the client can verify it against its CID.
+func (i *gatewayHandler) serveRawBlock(w http.ResponseWriter, r *http.Request, resolvedPath ipath.Resolved, urlPath string) {
+	blockCid := resolvedPath.Cid()
+	blockReader, err := i.api.Block().Get(r.Context(), resolvedPath)
+	if err != nil {
+		webError(w, "ipfs block get "+blockCid.String(), err, http.StatusInternalServerError)
+		return
+	}
+	block, err := ioutil.ReadAll(blockReader)
+	if err != nil {
+		webError(w, "ipfs block get "+blockCid.String(), err, http.StatusInternalServerError)
+		return
+	}
+
+	i.addUserHeaders(w)
+	w.Header().Set("X-IPFS-Path", urlPath)
+	w.Header().Set("Etag", `"`+blockCid.String()+`.raw"`)
+	setCacheControlForPath(w, urlPath)
+	name := blockCid.String() + ".bin"
+	setContentDispositionHeader(w, name, "attachment")
+	w.Header().Set("Content-Type", rawResponseFormat)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	// ServeContent takes care of If-None-Match, Range and HEAD requests
+	http.ServeContent(w, r, name, time.Time{}, bytes.NewReader(block))
+}
@@ -0,0 +1,184 @@
+package corehttp
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	denylist "github.com/ipfs/go-ipfs/denylist"
+
+	cid "github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+	dag "github.com/ipfs/go-merkledag"
+	path "github.com/ipfs/go-path"
+	"github.com/ipfs/go-path/resolver"
+	uio "github.com/ipfs/go-unixfs/io"
+	ipath "github.com/ipfs/interface-go-ipfs-core/path"
+	gocar "github.com/ipld/go-car"
+	carutil "github.com/ipld/go-car/util"
+)
+
+const carResponseFormat = "application/vnd.ipld.car"
+
+// serveCar streams the DAG under resolvedPath as a CAR file, written the same
+// way as 'ipfs dag export'. When the path goes through other blocks, they are
+// written first, so that clients can verify the path from the CID they
+// requested.
+func (i *gatewayHandler) serveCar(w http.ResponseWriter, r *http.Request, resolvedPath ipath.Resolved, urlPath string) {
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	rootCid := resolvedPath.Cid()
+
+	pathCids, err := i.pathBlocks(ctx, resolvedPath)
+	if err != nil {
+		webError(w, "ipfs resolve -r "+urlPath, err, http.StatusInternalServerError)
+		return
+	}
+
+	// The blocks are always written in the same order, but a CAR is not
+	// guaranteed to be byte-for-byte identical across versions: the ETag is
+	// weak.
+	etag := `W/"` + rootCid.String() + `.car"`
+	if etagMatch(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	i.addUserHeaders(w)
+	w.Header().Set("X-IPFS-Path", urlPath)
+	w.Header().Set("Etag", etag)
+	setCacheControlForPath(w, urlPath)
+	setContentDispositionHeader(w, rootCid.String()+".car", "attachment")
+	w.Header().Set("Content-Type", carResponseFormat+"; version=1")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	// The status and headers are sent with the first bytes, errors past
+	// that point can only be logged.
+	ng := denylist.NewNodeGetter(dag.NewSession(ctx, i.api.Dag()), i.config.Denylist)
+	if err := writeCar(ctx, ng, rootCid, pathCids, w); err != nil {
+		log.Errorf("failed to write CAR for %s: %s", urlPath, err)
+	}
+}
+
+// writeCar writes a CAR file rooted at root, with the path blocks followed
+// by the DAG under root, like gocar.WriteCar.
+func writeCar(ctx context.Context, ng ipld.NodeGetter, root cid.Cid, pathCids []cid.Cid, w io.Writer) error {
+	if err := gocar.WriteHeader(&gocar.CarHeader{Roots: []cid.Cid{root}, Version: 1}, w); err != nil {
+		return err
+	}
+
+	for _, c := range pathCids {
+		nd, err := ng.Get(ctx, c)
+		if err != nil {
+			return err
+		}
+		if err := carutil.LdWrite(w, c.Bytes(), nd.RawData()); err != nil {
+			return err
+		}
+	}
+
+	getLinks := func(ctx context.Context, c cid.Cid) ([]*ipld.Link, error) {
+		nd, err := ng.Get(ctx, c)
+		if err != nil {
+			return nil, err
+		}
+		if err := carutil.LdWrite(w, c.Bytes(), nd.RawData()); err != nil {
+			return nil, err
+		}
+		return nd.Links(), nil
+	}
+	return dag.Walk(ctx, getLinks, root, cid.NewSet().Visit)
+}
+
+// pathBlocks returns the blocks traversed to resolve the path, from its root
+// down to the parent of the resolved block, including the inner blocks of
+// sharded directories.
+func (i *gatewayHandler) pathBlocks(ctx context.Context, resolvedPath ipath.Resolved) ([]cid.Cid, error) {
+	p := path.FromString(resolvedPath.String())
+	if len(p.Segments()) <= 2 {
+		return nil, nil
+	}
+
+	rec := &recordingNodeGetter{NodeGetter: i.api.Dag(), seen: cid.NewSet()}
+	res := &resolver.Resolver{
+		DAG:         rec,
+		ResolveOnce: uio.ResolveUnixfsOnce,
+	}
+	if _, _, err := res.ResolveToLastNode(ctx, p); err != nil {
+		return nil, err
+	}
+
+	blocks := make([]cid.Cid, 0, len(rec.cids))
+	for _, c := range rec.cids {
+		if !c.Equals(resolvedPath.Cid()) {
+			blocks = append(blocks, c)
+		}
+	}
+	return blocks, nil
+}
+
+// recordingNodeGetter records the nodes it gets, in order.
+type recordingNodeGetter struct {
+	ipld.NodeGetter
+
+	lk   sync.Mutex
+	seen *cid.Set
+	cids []cid.Cid
+}
+
+func (g *recordingNodeGetter) record(c cid.Cid) {
+	g.lk.Lock()
+	if g.seen.Visit(c) {
+		g.cids = append(g.cids, c)
+	}
+	g.lk.Unlock()
+}
+
+func (g *recordingNodeGetter) Get(ctx context.Context, c cid.Cid) (ipld.Node, error) {
+	nd, err := g.NodeGetter.Get(ctx, c)
+	if err == nil {
+		g.record(c)
+	}
+	return nd, err
+}
+
+func (g *recordingNodeGetter) GetMany(ctx context.Context, cids []cid.Cid) <-chan *ipld.NodeOption {
+	out := make(chan *ipld.NodeOption, len(cids))
+	go func() {
+		defer close(out)
+		for opt := range g.NodeGetter.GetMany(ctx, cids) {
+			if opt.Err == nil {
+				g.record(opt.Node.Cid())
+			}
+			select {
+			case out <- opt:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// etagMatch returns true if the If-None-Match header value lists etag,
+// ignoring whether the tags are weak.
+func etagMatch(ifNoneMatch string, etag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, tag := range strings.Split(ifNoneMatch, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
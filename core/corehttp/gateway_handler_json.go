@@ -0,0 +1,199 @@
+package corehttp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	cid "github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+	dag "github.com/ipfs/go-merkledag"
+	ft "github.com/ipfs/go-unixfs"
+	uio "github.com/ipfs/go-unixfs/io"
+	ipath "github.com/ipfs/interface-go-ipfs-core/path"
+)
+
+const jsonResponseFormat = "application/json"
+
+const (
+	// defaultListingLimit is the number of entries in a page of a JSON
+	// directory listing when the limit query parameter is not set.
+	defaultListingLimit = 1000
+	// maxListingLimit caps the limit query parameter.
+	maxListingLimit = 10000
+)
+
+// directoryListing is the JSON directory listing. NextOffset is set when the
+// listing continues on another page.
+type directoryListing struct {
+	Path       string
+	Cid        string
+	Entries    []directoryEntry
+	Offset     int
+	NextOffset int `json:",omitempty"`
+}
+
+type directoryEntry struct {
+	Name   string
+	Cid    string
+	Type   string
+	Size   uint64 `json:",omitempty"` // files only
+	Target string `json:",omitempty"` // symlinks only
+}
+
+// errPageFull stops the directory walk once a page is complete.
+var errPageFull = errors.New("page full")
+
+// serveDirectoryJSON writes a page of the listing of the directory under
+// resolvedPath. Pages are read in the order the directory, or its HAMT
+// shards, store the links so that only the requested page is held in
+// memory. Links can't be looked up by position, so the links before the
+// offset are walked again for every page: listing a whole directory page by
+// page is quadratic in its number of pages. It returns false, without
+// writing anything, when resolvedPath is not a directory.
+func (i *gatewayHandler) serveDirectoryJSON(w http.ResponseWriter, r *http.Request, resolvedPath ipath.Resolved, urlPath string) bool {
+	ctx := r.Context()
+
+	nd, err := i.api.ResolveNode(ctx, resolvedPath)
+	if err != nil {
+		webError(w, "ipfs resolve "+urlPath, err, http.StatusNotFound)
+		return true
+	}
+	dir, err := uio.NewDirectoryFromNode(i.api.Dag(), nd)
+	if err == uio.ErrNotADir {
+		return false
+	}
+	if err != nil {
+		internalWebError(w, err)
+		return true
+	}
+
+	offset, limit, err := listingPage(r)
+	if err != nil {
+		webError(w, "invalid directory listing page", err, http.StatusBadRequest)
+		return true
+	}
+
+	etag := `W/"` + resolvedPath.Cid().String() + `.json"`
+	if etagMatch(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return true
+	}
+
+	// One more link than the page holds tells whether another page follows
+	var links []*ipld.Link
+	n := 0
+	err = dir.ForEachLink(ctx, func(l *ipld.Link) error {
+		n++
+		if n <= offset {
+			return nil
+		}
+		links = append(links, l)
+		if len(links) > limit {
+			return errPageFull
+		}
+		return nil
+	})
+	if err != nil && err != errPageFull {
+		internalWebError(w, err)
+		return true
+	}
+
+	listing := directoryListing{
+		Path:    urlPath,
+		Cid:     resolvedPath.Cid().String(),
+		Entries: make([]directoryEntry, 0, len(links)),
+		Offset:  offset,
+	}
+	if len(links) > limit {
+		links = links[:limit]
+		listing.NextOffset = offset + limit
+	}
+	for _, l := range links {
+		entry, err := i.directoryEntry(ctx, l)
+		if err != nil {
+			internalWebError(w, err)
+			return true
+		}
+		listing.Entries = append(listing.Entries, entry)
+	}
+
+	i.addUserHeaders(w)
+	w.Header().Set("X-IPFS-Path", urlPath)
+	w.Header().Set("Etag", etag)
+	setCacheControlForPath(w, urlPath)
+	w.Header().Set("Content-Type", jsonResponseFormat)
+	if r.Method == http.MethodHead {
+		return true
+	}
+
+	if err := json.NewEncoder(w).Encode(listing); err != nil {
+		log.Errorf("failed to write JSON listing for %s: %s", urlPath, err)
+	}
+	return true
+}
+
+// directoryEntry describes the target of a directory link, the same way as
+// 'ipfs ls' does.
+func (i *gatewayHandler) directoryEntry(ctx context.Context, l *ipld.Link) (directoryEntry, error) {
+	entry := directoryEntry{
+		Name: l.Name,
+		Cid:  l.Cid.String(),
+		Type: "unknown",
+	}
+
+	switch l.Cid.Type() {
+	case cid.Raw:
+		entry.Type = "file"
+		entry.Size = l.Size
+	case cid.DagProtobuf:
+		nd, err := l.GetNode(ctx, i.api.Dag())
+		if err != nil {
+			return entry, err
+		}
+		pn, ok := nd.(*dag.ProtoNode)
+		if !ok {
+			return entry, dag.ErrNotProtobuf
+		}
+		d, err := ft.FSNodeFromBytes(pn.Data())
+		if err != nil {
+			return entry, err
+		}
+		switch d.Type() {
+		case ft.TFile, ft.TRaw:
+			entry.Type = "file"
+			entry.Size = d.FileSize()
+		case ft.THAMTShard, ft.TDirectory, ft.TMetadata:
+			entry.Type = "directory"
+		case ft.TSymlink:
+			entry.Type = "symlink"
+			entry.Target = string(d.Data())
+		}
+	}
+	return entry, nil
+}
+
+// listingPage returns the offset and limit query parameters of a directory
+// listing.
+func listingPage(r *http.Request) (offset int, limit int, err error) {
+	q := r.URL.Query()
+
+	if s := q.Get("offset"); s != "" {
+		if offset, err = strconv.Atoi(s); err != nil || offset < 0 {
+			return 0, 0, errors.New("offset must be a non-negative integer")
+		}
+	}
+
+	limit = defaultListingLimit
+	if s := q.Get("limit"); s != "" {
+		if limit, err = strconv.Atoi(s); err != nil || limit <= 0 {
+			return 0, 0, errors.New("limit must be a positive integer")
+		}
+		if limit > maxListingLimit {
+			limit = maxListingLimit
+		}
+	}
+	return offset, limit, nil
+}
@@ -0,0 +1,324 @@
+package corehttp
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	gopath "path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+	files "github.com/ipfs/go-ipfs-files"
+	"github.com/ipfs/go-path/resolver"
+	ipath "github.com/ipfs/interface-go-ipfs-core/path"
+)
+
+const (
+	// redirectsFile is the name of the file holding the redirect rules of a
+	// website, at its root.
+	redirectsFile = "_redirects"
+	// maxRedirectsFileSize caps the size of a _redirects file.
+	maxRedirectsFileSize = 64 << 10
+	// redirectsCacheSize is the number of websites whose rules are cached.
+	redirectsCacheSize = 128
+)
+
+// redirectRule is a rule of a _redirects file:
+//
+//	/from/:placeholder/* /to/:placeholder/:splat [status]
+//
+// Redirect statuses send the client to the target path or URL. The other
+// statuses serve the target file, found under the website root, with the
+// status.
+type redirectRule struct {
+	from   []string
+	to     string
+	status int
+}
+
+var placeholderRe = regexp.MustCompile(`:[A-Za-z0-9_]+`)
+
+// match returns the values of the placeholders of the rule, with the rest
+// of the path matched by * as "splat", if the rule matches the path.
+func (rule redirectRule) match(segs []string) (map[string]string, bool) {
+	params := make(map[string]string)
+	for idx, s := range rule.from {
+		if s == "*" {
+			params["splat"] = strings.Join(segs[idx:], "/")
+			return params, true
+		}
+		if idx >= len(segs) {
+			return nil, false
+		}
+		if strings.HasPrefix(s, ":") {
+			params[s[1:]] = segs[idx]
+		} else if s != segs[idx] {
+			return nil, false
+		}
+	}
+	return params, len(segs) == len(rule.from)
+}
+
+// target returns the target of the rule with its placeholders replaced.
+func (rule redirectRule) target(params map[string]string) string {
+	return placeholderRe.ReplaceAllStringFunc(rule.to, func(p string) string {
+		if v, ok := params[p[1:]]; ok {
+			return v
+		}
+		return p
+	})
+}
+
+func isRedirectStatus(status int) bool {
+	switch status {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+	return false
+}
+
+// parseRedirects parses the rules of a _redirects file. Blank lines and
+// lines starting with # are ignored.
+func parseRedirects(r io.Reader) ([]redirectRule, error) {
+	var rules []redirectRule
+
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 2 || len(fields) > 3 {
+			return nil, fmt.Errorf("line %d: expected a source, a target and an optional status", n)
+		}
+
+		rule := redirectRule{to: fields[1], status: http.StatusMovedPermanently}
+		if len(fields) == 3 {
+			status, err := strconv.Atoi(fields[2])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid status %q", n, fields[2])
+			}
+			rule.status = status
+		}
+
+		from := fields[0]
+		if !strings.HasPrefix(from, "/") {
+			return nil, fmt.Errorf("line %d: source %q must be a path", n, from)
+		}
+		rule.from = splitWebsitePath(from)
+		for idx, seg := range rule.from {
+			if seg == "*" && idx != len(rule.from)-1 {
+				return nil, fmt.Errorf("line %d: * must end the source %q", n, from)
+			}
+		}
+
+		switch {
+		case isRedirectStatus(rule.status):
+			if u, err := url.Parse(rule.to); err != nil || (!u.IsAbs() && !strings.HasPrefix(rule.to, "/")) {
+				return nil, fmt.Errorf("line %d: target %q must be a path or an absolute URL", n, rule.to)
+			}
+		case rule.status == http.StatusOK, rule.status == http.StatusNotFound,
+			rule.status == http.StatusGone, rule.status == http.StatusUnavailableForLegalReasons:
+			if !strings.HasPrefix(rule.to, "/") {
+				return nil, fmt.Errorf("line %d: target %q must be a path", n, rule.to)
+			}
+		default:
+			return nil, fmt.Errorf("line %d: unsupported status %d", n, rule.status)
+		}
+
+		rules = append(rules, rule)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// splitWebsitePath splits a path relative to a website root in segments.
+func splitWebsitePath(p string) []string {
+	p = strings.Trim(p, "/")
+	if p == "" {
+		return nil
+	}
+	return strings.Split(p, "/")
+}
+
+// websiteRoot splits a /ipfs/ or /ipns/ path in the path of its root and the
+// rest of the path.
+func websiteRoot(urlPath string) (root string, rest string, ok bool) {
+	parts := strings.SplitN(urlPath, "/", 4)
+	if len(parts) < 3 || parts[0] != "" || (parts[1] != "ipfs" && parts[1] != "ipns") || parts[2] == "" {
+		return "", "", false
+	}
+	root = "/" + parts[1] + "/" + parts[2]
+	if len(parts) == 4 {
+		rest = parts[3]
+	}
+	return root, "/" + rest, true
+}
+
+// redirectsCacheEntry holds the rules of a website, or the error met while
+// parsing them.
+type redirectsCacheEntry struct {
+	rules []redirectRule
+	err   error
+}
+
+// redirectsCache caches the rules of websites by root CID. Websites are
+// immutable, so entries never go stale; an arbitrary entry is evicted when
+// the cache is full.
+type redirectsCache struct {
+	lk      sync.Mutex
+	entries map[cid.Cid]redirectsCacheEntry
+}
+
+func newRedirectsCache() *redirectsCache {
+	return &redirectsCache{entries: make(map[cid.Cid]redirectsCacheEntry)}
+}
+
+func (c *redirectsCache) get(k cid.Cid) (redirectsCacheEntry, bool) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	e, ok := c.entries[k]
+	return e, ok
+}
+
+func (c *redirectsCache) put(k cid.Cid, e redirectsCacheEntry) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	if len(c.entries) >= redirectsCacheSize {
+		for old := range c.entries {
+			delete(c.entries, old)
+			break
+		}
+	}
+	c.entries[k] = e
+}
+
+// websiteRedirects returns the rules of the website under root, nil when it
+// has no _redirects file.
+func (i *gatewayHandler) websiteRedirects(ctx context.Context, root ipath.Resolved) ([]redirectRule, error) {
+	if e, ok := i.redirects.get(root.Cid()); ok {
+		return e.rules, e.err
+	}
+
+	var e redirectsCacheEntry
+	node, err := i.api.Unixfs().Get(ctx, ipath.Join(root, redirectsFile))
+	switch err.(type) {
+	case nil:
+		defer node.Close()
+		f, ok := node.(files.File)
+		if !ok {
+			e.err = fmt.Errorf("%s is not a file", redirectsFile)
+			break
+		}
+		b, err := ioutil.ReadAll(io.LimitReader(f, maxRedirectsFileSize+1))
+		if err != nil {
+			// possibly transient, do not cache
+			return nil, err
+		}
+		if len(b) > maxRedirectsFileSize {
+			e.err = fmt.Errorf("%s is larger than %d bytes", redirectsFile, maxRedirectsFileSize)
+			break
+		}
+		e.rules, e.err = parseRedirects(strings.NewReader(string(b)))
+	case resolver.ErrNoLink:
+		// no rules
+	default:
+		return nil, err
+	}
+
+	i.redirects.put(root.Cid(), e)
+	return e.rules, e.err
+}
+
+// serveRedirectsIfPresent applies the rules of the _redirects file of the
+// DNSLink or subdomain website urlPath belongs to. It returns false when no
+// rule applied.
+func (i *gatewayHandler) serveRedirectsIfPresent(w http.ResponseWriter, r *http.Request, urlPath string) bool {
+	// Only websites have a root the rules can be relative to
+	if _, ok := r.Context().Value("gw-hostname").(string); !ok {
+		return false
+	}
+	root, rest, ok := websiteRoot(urlPath)
+	if !ok {
+		return false
+	}
+
+	resolvedRoot, err := i.api.ResolvePath(r.Context(), ipath.New(root))
+	if err != nil {
+		return false
+	}
+	rules, err := i.websiteRedirects(r.Context(), resolvedRoot)
+	if err != nil {
+		webError(w, "invalid "+redirectsFile+" file in "+root, err, http.StatusInternalServerError)
+		return true
+	}
+
+	segs := splitWebsitePath(rest)
+	for _, rule := range rules {
+		params, ok := rule.match(segs)
+		if !ok {
+			continue
+		}
+		to := rule.target(params)
+
+		if isRedirectStatus(rule.status) {
+			http.Redirect(w, r, to, rule.status)
+			return true
+		}
+		target := ipath.Join(resolvedRoot, splitWebsitePath(to)...)
+		if i.serveRedirectTarget(w, r, target, root+to, rule.status) {
+			return true
+		}
+		log.Debugf("%s rule %s: no file at %s", redirectsFile, rule.to, root+to)
+	}
+	return false
+}
+
+// serveRedirectTarget serves the file at p with the given status. It
+// returns false, without writing anything, when there is no file at p.
+func (i *gatewayHandler) serveRedirectTarget(w http.ResponseWriter, r *http.Request, p ipath.Path, targetPath string, status int) bool {
+	node, err := i.api.Unixfs().Get(r.Context(), p)
+	if err != nil {
+		return false
+	}
+	defer node.Close()
+	f, ok := node.(files.File)
+	if !ok {
+		return false
+	}
+
+	i.addUserHeaders(w)
+	w.Header().Set("X-IPFS-Path", targetPath)
+	if status == http.StatusOK {
+		i.serveFile(w, r, targetPath, time.Now(), f)
+		return true
+	}
+
+	size, err := f.Size()
+	if err != nil {
+		return false
+	}
+	if ctype := mime.TypeByExtension(gopath.Ext(targetPath)); ctype != "" {
+		w.Header().Set("Content-Type", ctype)
+	}
+	w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	w.WriteHeader(status)
+	if r.Method != http.MethodHead {
+		_, _ = io.CopyN(w, f, size)
+	}
+	return true
+}
@@ -0,0 +1,72 @@
+package corehttp
+
+import (
+	"context"
+	"io"
+	"net/http"
+
+	corecommands "github.com/ipfs/go-ipfs/core/commands"
+	ipath "github.com/ipfs/interface-go-ipfs-core/path"
+)
+
+const tarResponseFormat = "application/x-tar"
+
+// serveTar streams the UnixFS tree under resolvedPath as a TAR archive, the
+// same way as 'ipfs get --archive'.
+func (i *gatewayHandler) serveTar(w http.ResponseWriter, r *http.Request, resolvedPath ipath.Resolved, urlPath string) {
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	rootCid := resolvedPath.Cid()
+
+	// The archive has no timestamps, but its encoding may change across
+	// versions: the ETag is weak.
+	etag := `W/"` + rootCid.String() + `.tar"`
+	if etagMatch(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	file, err := i.api.Unixfs().Get(ctx, resolvedPath)
+	if err != nil {
+		webError(w, "ipfs get "+urlPath, err, http.StatusNotFound)
+		return
+	}
+	defer file.Close()
+
+	// The root entry is named after the last path segment, or the CID
+	name := getFilename(urlPath)
+	if name == "" {
+		name = rootCid.String()
+	}
+	filename := name + ".tar"
+	if urlFilename := r.URL.Query().Get("filename"); urlFilename != "" {
+		filename = urlFilename
+	}
+
+	i.addUserHeaders(w)
+	w.Header().Set("X-IPFS-Path", urlPath)
+	w.Header().Set("Etag", etag)
+	setCacheControlForPath(w, urlPath)
+	setContentDispositionHeader(w, filename, "attachment")
+	w.Header().Set("Content-Type", tarResponseFormat)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	archive, err := corecommands.TarArchive(file, name)
+	if err != nil {
+		webError(w, "ipfs get "+urlPath, err, http.StatusInternalServerError)
+		return
+	}
+	// Closing the archive stops the writer when the client goes away
+	defer archive.Close()
+
+	// The status and headers are sent with the first bytes, errors past
+	// that point can only be logged.
+	if _, err := io.Copy(w, archive); err != nil {
+		log.Errorf("failed to write TAR for %s: %s", urlPath, err)
+	}
+}
@@ -1,12 +1,18 @@
 package corehttp
 
 import (
+	"archive/tar"
 	"context"
+	"encoding/json"
 	"errors"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -14,9 +20,11 @@ import (
 	version "github.com/ipfs/go-ipfs"
 	core "github.com/ipfs/go-ipfs/core"
 	"github.com/ipfs/go-ipfs/core/coreapi"
+	denylist "github.com/ipfs/go-ipfs/denylist"
 	repo "github.com/ipfs/go-ipfs/repo"
 	namesys "github.com/ipfs/go-namesys"
 
+	cid "github.com/ipfs/go-cid"
 	datastore "github.com/ipfs/go-datastore"
 	syncds "github.com/ipfs/go-datastore/sync"
 	config "github.com/ipfs/go-ipfs-config"
@@ -25,6 +33,7 @@ import (
 	iface "github.com/ipfs/interface-go-ipfs-core"
 	nsopts "github.com/ipfs/interface-go-ipfs-core/options/namesys"
 	ipath "github.com/ipfs/interface-go-ipfs-core/path"
+	gocar "github.com/ipld/go-car"
 	ci "github.com/libp2p/go-libp2p-core/crypto"
 	id "github.com/libp2p/go-libp2p/p2p/protocol/identify"
 )
@@ -740,3 +749,825 @@ func TestVersion(t *testing.T) {
 		t.Fatalf("response doesn't contain protocol version:\n%s", s)
 	}
 }
+
+func TestCarResponse(t *testing.T) {
+	ns := mockNamesys{}
+	ts, api, ctx := newTestServerAndNode(t, ns)
+
+	dir := files.NewMapDirectory(map[string]files.Node{
+		"a.txt": files.NewBytesFile([]byte("a")),
+		"sub": files.NewMapDirectory(map[string]files.Node{
+			"b.txt": files.NewBytesFile([]byte("b")),
+		}),
+	})
+	k, err := api.Unixfs().Add(ctx, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ns["/ipns/example.net"] = path.FromString(k.String())
+
+	for _, test := range []struct {
+		path   string
+		accept string
+		root   string
+		cache  string
+	}{
+		{k.String() + "?format=car", "", k.Cid().String(), "public, max-age=29030400, immutable"},
+		{k.String(), "application/vnd.ipld.car", k.Cid().String(), "public, max-age=29030400, immutable"},
+		{k.String() + "/sub", "text/html, application/vnd.ipld.car;version=1", "", "public, max-age=29030400, immutable"},
+		{"/ipns/example.net?format=car", "", k.Cid().String(), "no-cache"},
+	} {
+		req, err := http.NewRequest(http.MethodGet, ts.URL+test.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.accept != "" {
+			req.Header.Set("Accept", test.accept)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d", test.path, resp.StatusCode)
+		}
+		if ct := resp.Header.Get("Content-Type"); ct != "application/vnd.ipld.car; version=1" {
+			t.Errorf("%s: unexpected Content-Type %q", test.path, ct)
+		}
+		if cc := resp.Header.Get("Cache-Control"); cc != test.cache {
+			t.Errorf("%s: unexpected Cache-Control %q", test.path, cc)
+		}
+
+		car, err := gocar.NewCarReader(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(car.Header.Roots) != 1 {
+			t.Fatalf("%s: expected a single root, got %v", test.path, car.Header.Roots)
+		}
+		root := car.Header.Roots[0]
+		if test.root != "" && root.String() != test.root {
+			t.Errorf("%s: expected root %s, got %s", test.path, test.root, root)
+		}
+		if etag := resp.Header.Get("Etag"); etag != `W/"`+root.String()+`.car"` {
+			t.Errorf("%s: unexpected Etag %q", test.path, etag)
+		}
+
+		blocks := 0
+		for {
+			_, err := car.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			blocks++
+		}
+		if blocks < 2 {
+			t.Errorf("%s: expected the whole DAG, got %d blocks", test.path, blocks)
+		}
+	}
+
+	// A matching If-None-Match gets a 304
+	req, err := http.NewRequest(http.MethodGet, ts.URL+k.String()+"?format=car", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("If-None-Match", `W/"`+k.Cid().String()+`.car"`)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotModified {
+		t.Errorf("expected 304, got %d", resp.StatusCode)
+	}
+
+	// Unknown formats are rejected
+	resp, err = http.Get(ts.URL + k.String() + "?format=nope")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown format, got %d", resp.StatusCode)
+	}
+}
+
+func TestResponseFormatAccept(t *testing.T) {
+	for _, test := range []struct {
+		accept string
+		format string
+	}{
+		{"", ""},
+		{"application/vnd.ipld.car", carResponseFormat},
+		{"text/html, application/vnd.ipld.car;version=1", carResponseFormat},
+		{"application/vnd.ipld.raw, application/vnd.ipld.car", rawResponseFormat},
+		{"application/vnd.ipld.raw;q=0.5, application/vnd.ipld.car", carResponseFormat},
+		{"application/vnd.ipld.car;q=0", ""},
+		{"application/vnd.ipld.car;q=0, application/json", jsonResponseFormat},
+		{"text/html, application/json;q=0.9", ""},
+		{"text/html;q=0.8, application/json;q=0.9", jsonResponseFormat},
+		{"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", ""},
+		{"application/json, */*;q=0.1", jsonResponseFormat},
+		{"application/vnd.ipld.raw;q=2", ""},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/ipfs/bafkqaaa", nil)
+		if test.accept != "" {
+			r.Header.Set("Accept", test.accept)
+		}
+		format, err := customResponseFormat(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if format != test.format {
+			t.Errorf("Accept %q: expected %q, got %q", test.accept, test.format, format)
+		}
+	}
+}
+
+func TestVaryAccept(t *testing.T) {
+	ts, api, ctx := newTestServerAndNode(t, mockNamesys{})
+
+	dir := files.NewMapDirectory(map[string]files.Node{
+		"a.txt": files.NewBytesFile([]byte("a")),
+	})
+	k, err := api.Unixfs().Add(ctx, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		path   string
+		status int
+	}{
+		{k.String() + "/a.txt", http.StatusOK},
+		{k.String() + "/", http.StatusOK},
+		{k.String(), http.StatusMovedPermanently},
+		{k.String() + "?format=car", http.StatusOK},
+		{k.String() + "?format=raw", http.StatusOK},
+		{k.String() + "/missing", http.StatusNotFound},
+		{k.String() + "?format=nope", http.StatusBadRequest},
+	} {
+		req, err := http.NewRequest(http.MethodGet, ts.URL+test.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := doWithoutRedirect(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != test.status {
+			t.Errorf("%s: expected %d, got %d", test.path, test.status, resp.StatusCode)
+		}
+		if vary := resp.Header.Get("Vary"); vary != "Accept" {
+			t.Errorf("%s: expected Vary: Accept, got %q", test.path, vary)
+		}
+	}
+}
+
+func TestRawBlockResponse(t *testing.T) {
+	ts, api, ctx := newTestServerAndNode(t, mockNamesys{})
+
+	k, err := api.Unixfs().Add(ctx, files.NewBytesFile([]byte("raw block")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		path   string
+		accept string
+	}{
+		{k.String() + "?format=raw", ""},
+		{k.String(), "application/vnd.ipld.raw"},
+	} {
+		req, err := http.NewRequest(http.MethodGet, ts.URL+test.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.accept != "" {
+			req.Header.Set("Accept", test.accept)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d", test.path, resp.StatusCode)
+		}
+		if ct := resp.Header.Get("Content-Type"); ct != "application/vnd.ipld.raw" {
+			t.Errorf("%s: unexpected Content-Type %q", test.path, ct)
+		}
+		if etag := resp.Header.Get("Etag"); etag != `"`+k.Cid().String()+`.raw"` {
+			t.Errorf("%s: unexpected Etag %q", test.path, etag)
+		}
+
+		// The body must be the block itself
+		got, err := k.Cid().Prefix().Sum(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !got.Equals(k.Cid()) {
+			t.Errorf("%s: block hashes to %s, expected %s", test.path, got, k.Cid())
+		}
+	}
+}
+
+func TestCarPathBlocks(t *testing.T) {
+	ts, api, ctx := newTestServerAndNode(t, mockNamesys{})
+
+	dir := files.NewMapDirectory(map[string]files.Node{
+		"a": files.NewMapDirectory(map[string]files.Node{
+			"b.txt": files.NewBytesFile([]byte("b")),
+		}),
+	})
+	k, err := api.Unixfs().Add(ctx, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := api.ResolvePath(ctx, ipath.Join(k, "a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := api.ResolvePath(ctx, ipath.Join(k, "a", "b.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := http.Get(ts.URL + k.String() + "/a/b.txt?format=car")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	car, err := gocar.NewCarReader(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(car.Header.Roots) != 1 || !car.Header.Roots[0].Equals(b.Cid()) {
+		t.Fatalf("expected root %s, got %v", b.Cid(), car.Header.Roots)
+	}
+
+	var got []cid.Cid
+	for {
+		blk, err := car.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, blk.Cid())
+	}
+	// the path blocks come first, in path order
+	expected := []cid.Cid{k.Cid(), a.Cid(), b.Cid()}
+	if len(got) != len(expected) {
+		t.Fatalf("expected blocks %s, got %s", expected, got)
+	}
+	for i := range expected {
+		if !got[i].Equals(expected[i]) {
+			t.Fatalf("expected blocks %s, got %s", expected, got)
+		}
+	}
+}
+
+func TestTrustlessOnly(t *testing.T) {
+	n, err := newNodeWithMockNamesys(mockNamesys{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	api, err := coreapi.NewCoreAPI(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k, err := api.Unixfs().Add(n.Context(), files.NewMapDirectory(map[string]files.Node{
+		"f.txt": files.NewBytesFile([]byte("trustless")),
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := httptest.NewServer(newGatewayHandler(GatewayConfig{
+		Headers:       map[string][]string{},
+		TrustlessOnly: true,
+	}, api))
+	t.Cleanup(ts.Close)
+
+	for _, test := range []struct {
+		path   string
+		status int
+	}{
+		{k.String(), http.StatusNotAcceptable},
+		{k.String() + "?format=raw", http.StatusOK},
+		{k.String() + "?format=car", http.StatusOK},
+		{k.String() + "?format=tar", http.StatusNotAcceptable},
+		{k.String() + "/f.txt?format=car", http.StatusOK},
+		{k.String() + "/f.txt?format=raw", http.StatusBadRequest},
+	} {
+		resp, err := http.Get(ts.URL + test.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != test.status {
+			t.Errorf("%s: expected %d, got %d", test.path, test.status, resp.StatusCode)
+		}
+	}
+}
+
+func TestTarResponse(t *testing.T) {
+	ts, api, ctx := newTestServerAndNode(t, mockNamesys{})
+
+	dir := files.NewMapDirectory(map[string]files.Node{
+		"sub": files.NewMapDirectory(map[string]files.Node{
+			"a.txt": files.NewBytesFile([]byte("a")),
+			"b.txt": files.NewBytesFile([]byte("bb")),
+		}),
+	})
+	k, err := api.Unixfs().Add(ctx, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := http.Get(ts.URL + k.String() + "/sub?format=tar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "application/x-tar" {
+		t.Errorf("unexpected Content-Type %q", ct)
+	}
+	if cd := resp.Header.Get("Content-Disposition"); !strings.HasPrefix(cd, `attachment; filename="sub.tar"`) {
+		t.Errorf("unexpected Content-Disposition %q", cd)
+	}
+
+	sizes := make(map[string]int64)
+	tr := tar.NewReader(resp.Body)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		sizes[hdr.Name] = hdr.Size
+	}
+	for name, size := range map[string]int64{"sub/a.txt": 1, "sub/b.txt": 2} {
+		if got, ok := sizes[name]; !ok || got != size {
+			t.Errorf("expected %s of %d bytes in the archive, got %v", name, size, sizes)
+		}
+	}
+
+	// Directories named by their CID are archived under it
+	resp, err = http.Get(ts.URL + k.String() + "?format=tar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if cd := resp.Header.Get("Content-Disposition"); !strings.HasPrefix(cd, `attachment; filename="`+k.Cid().String()+`.tar"`) {
+		t.Errorf("unexpected Content-Disposition %q", cd)
+	}
+}
+
+func TestDirectoryJSONResponse(t *testing.T) {
+	ts, api, ctx := newTestServerAndNode(t, mockNamesys{})
+
+	dir := files.NewMapDirectory(map[string]files.Node{
+		"a.txt": files.NewBytesFile([]byte("a")),
+		"b.txt": files.NewBytesFile([]byte("bb")),
+		"sub":   files.NewMapDirectory(map[string]files.Node{}),
+	})
+	k, err := api.Unixfs().Add(ctx, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	getListing := func(query string, accept string) directoryListing {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodGet, ts.URL+k.String()+query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d", query, resp.StatusCode)
+		}
+		if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+			t.Fatalf("%s: unexpected Content-Type %q", query, ct)
+		}
+		var listing directoryListing
+		if err := json.NewDecoder(resp.Body).Decode(&listing); err != nil {
+			t.Fatal(err)
+		}
+		return listing
+	}
+
+	listing := getListing("", "application/json")
+	if listing.Cid != k.Cid().String() || listing.NextOffset != 0 || len(listing.Entries) != 3 {
+		t.Fatalf("unexpected listing %+v", listing)
+	}
+	for _, e := range listing.Entries {
+		switch e.Name {
+		case "a.txt":
+			if e.Type != "file" || e.Size != 1 {
+				t.Errorf("unexpected entry %+v", e)
+			}
+		case "b.txt":
+			if e.Type != "file" || e.Size != 2 {
+				t.Errorf("unexpected entry %+v", e)
+			}
+		case "sub":
+			if e.Type != "directory" {
+				t.Errorf("unexpected entry %+v", e)
+			}
+		default:
+			t.Errorf("unexpected entry %+v", e)
+		}
+	}
+
+	// Pages cover the whole listing in the same order
+	var names []string
+	query := "?format=json&limit=2"
+	for {
+		page := getListing(query, "")
+		if len(page.Entries) > 2 {
+			t.Fatalf("page larger than the limit: %+v", page)
+		}
+		for _, e := range page.Entries {
+			names = append(names, e.Name)
+		}
+		if page.NextOffset == 0 {
+			break
+		}
+		query = "?format=json&limit=2&offset=" + strconv.Itoa(page.NextOffset)
+	}
+	for i, e := range listing.Entries {
+		if i >= len(names) || names[i] != e.Name {
+			t.Fatalf("paged listing %v does not match %+v", names, listing.Entries)
+		}
+	}
+
+	// Files are served as usual
+	req, err := http.NewRequest(http.MethodGet, ts.URL+k.String()+"/b.txt", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "bb" {
+		t.Errorf("expected the file content, got %q", body)
+	}
+}
+
+func TestRedirectsFile(t *testing.T) {
+	ns := mockNamesys{}
+	ts, api, ctx := newTestServerAndNode(t, ns)
+
+	site := files.NewMapDirectory(map[string]files.Node{
+		"_redirects": files.NewBytesFile([]byte(`
+# moved sections
+/old/*                /new/:splat                301
+/posts/:year/:slug    /blog/:year/:slug.html     302
+/elsewhere            https://example.com/       307
+
+/app/*                /index.html                200
+/gone                 /gone.html                 410
+/*                    /404.html                  404
+`)),
+		"index.html": files.NewBytesFile([]byte("index")),
+		"404.html":   files.NewBytesFile([]byte("not found")),
+		"gone.html":  files.NewBytesFile([]byte("gone")),
+		"blog": files.NewMapDirectory(map[string]files.Node{
+			"2020": files.NewMapDirectory(map[string]files.Node{
+				"hello.html": files.NewBytesFile([]byte("hello")),
+			}),
+		}),
+	})
+	k, err := api.Unixfs().Add(ctx, site)
+	if err != nil {
+		t.Fatal(err)
+	}
+	host := "example.net"
+	ns["/ipns/"+host] = path.FromString(k.String())
+
+	client := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	for _, test := range []struct {
+		host     string
+		path     string
+		status   int
+		location string
+		text     string
+	}{
+		{host, "/old/a/b", http.StatusMovedPermanently, "/new/a/b", ""},
+		{host, "/posts/2020/hello", http.StatusFound, "/blog/2020/hello.html", ""},
+		{host, "/elsewhere", http.StatusTemporaryRedirect, "https://example.com/", ""},
+		{host, "/app/some/route", http.StatusOK, "", "index"},
+		{host, "/gone", http.StatusGone, "", "gone"},
+		{host, "/nope", http.StatusNotFound, "", "not found"},
+		// existing files are not shadowed by the rules
+		{host, "/blog/2020/hello.html", http.StatusOK, "", "hello"},
+		// rules only apply to websites
+		{"", k.String() + "/old/a", http.StatusNotFound, "", ""},
+	} {
+		req, err := http.NewRequest(http.MethodGet, ts.URL+test.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.host != "" {
+			req.Host = test.host
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if resp.StatusCode != test.status {
+			t.Errorf("%s: expected %d, got %d", test.path, test.status, resp.StatusCode)
+			continue
+		}
+		if test.location != "" && resp.Header.Get("Location") != test.location {
+			t.Errorf("%s: expected a redirect to %s, got %q", test.path, test.location, resp.Header.Get("Location"))
+		}
+		if test.text != "" && string(body) != test.text {
+			t.Errorf("%s: expected %q, got %q", test.path, test.text, body)
+		}
+	}
+}
+
+func TestParseRedirects(t *testing.T) {
+	for _, invalid := range []string{
+		"/a",
+		"/a /b 200 extra",
+		"a /b",
+		"/a/*/b /c",
+		"/a /b 418",
+		"/a b 200",
+		"/a /b nope",
+	} {
+		if _, err := parseRedirects(strings.NewReader(invalid)); err == nil {
+			t.Errorf("expected %q to be rejected", invalid)
+		}
+	}
+
+	rules, err := parseRedirects(strings.NewReader("/a/:x/* /b/:x/:splat/:y\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	params, ok := rules[0].match(splitWebsitePath("/a/1/2/3"))
+	if !ok {
+		t.Fatal("expected the rule to match")
+	}
+	if to := rules[0].target(params); to != "/b/1/2/3/:y" {
+		t.Errorf("unexpected target %q", to)
+	}
+	if rules[0].status != http.StatusMovedPermanently {
+		t.Errorf("expected a 301 by default, got %d", rules[0].status)
+	}
+}
+
+func TestDenylist(t *testing.T) {
+	n, err := newNodeWithMockNamesys(mockNamesys{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	api, err := coreapi.NewCoreAPI(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k, err := api.Unixfs().Add(n.Context(), files.NewMapDirectory(map[string]files.Node{
+		"blocked.txt": files.NewBytesFile([]byte("blocked")),
+		"fine.txt":    files.NewBytesFile([]byte("fine")),
+		"sub": files.NewMapDirectory(map[string]files.Node{
+			"a.txt": files.NewBytesFile([]byte("a")),
+		}),
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	blockedCids := make(map[string]bool)
+	for _, p := range []string{"blocked.txt", "sub", "sub/a.txt"} {
+		resolved, err := api.ResolvePath(n.Context(), ipath.Join(k, strings.Split(p, "/")...))
+		if err != nil {
+			t.Fatal(err)
+		}
+		blockedCids[resolved.Cid().String()] = true
+	}
+	sub, err := api.ResolvePath(n.Context(), ipath.Join(k, "sub"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "denylist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	entries := "/ipfs/" + k.Cid().String() + "/blocked.txt\n" +
+		"/ipfs/" + sub.Cid().String() + "\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "test.deny"), []byte(entries), 0644); err != nil {
+		t.Fatal(err)
+	}
+	deny, err := denylist.Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The gateway reads unixfs content through the denylist of the node
+	n.Denylist = deny
+	api, err = coreapi.NewCoreAPI(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := httptest.NewServer(newGatewayHandler(GatewayConfig{
+		Headers:  map[string][]string{},
+		Denylist: deny,
+	}, api))
+	t.Cleanup(ts.Close)
+
+	for _, test := range []struct {
+		path   string
+		status int
+	}{
+		{k.String() + "/blocked.txt", http.StatusGone},
+		{k.String() + "/blocked.txt?format=raw", http.StatusGone},
+		{k.String() + "/fine.txt", http.StatusOK},
+		{k.String() + "/", http.StatusOK},
+		{k.String() + "/sub", http.StatusGone},
+		// blocked through an intermediate CID
+		{k.String() + "/sub/a.txt", http.StatusGone},
+		{k.String() + "/sub/a.txt?format=car", http.StatusGone},
+		{sub.String() + "/a.txt", http.StatusGone},
+	} {
+		resp, err := http.Get(ts.URL + test.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != test.status {
+			t.Errorf("%s: expected %d, got %d", test.path, test.status, resp.StatusCode)
+		}
+	}
+
+	// Exports of the parent leave the blocked content out
+	resp, err := http.Get(ts.URL + k.String() + "?format=car")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	car, err := gocar.NewCarReader(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for {
+		blk, err := car.Next()
+		if err != nil {
+			break
+		}
+		if blockedCids[blk.Cid().String()] {
+			t.Errorf("blocked block %s in the CAR of the parent", blk.Cid())
+		}
+	}
+
+	resp, err = http.Get(ts.URL + k.String() + "?format=tar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	tr := tar.NewReader(resp.Body)
+	for {
+		hdr, err := tr.Next()
+		if err != nil {
+			break
+		}
+		if strings.HasSuffix(hdr.Name, "/blocked.txt") || strings.HasSuffix(hdr.Name, "/sub") || strings.Contains(hdr.Name, "/sub/") {
+			t.Errorf("blocked entry %s in the TAR of the parent", hdr.Name)
+		}
+	}
+
+	// and so does 'ipfs get'
+	nd, err := api.Unixfs().Get(n.Context(), k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = files.Walk(nd, func(fpath string, nd files.Node) error {
+		if f, ok := nd.(files.File); ok {
+			_, err := ioutil.ReadAll(f)
+			return err
+		}
+		return nil
+	})
+	if !errors.Is(err, denylist.ErrBlocked) {
+		t.Fatalf("expected the blocked content to be refused, got %v", err)
+	}
+}
+
+func TestWritableGatewayAuth(t *testing.T) {
+	n, err := newNodeWithMockNamesys(mockNamesys{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	api, err := coreapi.NewCoreAPI(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k, err := api.Unixfs().Add(n.Context(), files.NewMapDirectory(map[string]files.Node{
+		"uploads": files.NewMapDirectory(map[string]files.Node{
+			"a.txt": files.NewBytesFile([]byte("a")),
+		}),
+		"b.txt": files.NewBytesFile([]byte("b")),
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := httptest.NewServer(newGatewayHandler(GatewayConfig{
+		Headers:  map[string][]string{},
+		Writable: true,
+		WriteTokens: []GatewayWriteToken{
+			{Token: "admin"},
+			{Token: "poster", Methods: []string{http.MethodPost}},
+			{Token: "uploader", Methods: []string{http.MethodPut}, Paths: []string{k.String() + "/uploads"}},
+		},
+	}, api))
+	t.Cleanup(ts.Close)
+
+	for _, test := range []struct {
+		method string
+		path   string
+		token  string
+		status int
+	}{
+		{http.MethodPost, "/ipfs/", "", http.StatusUnauthorized},
+		{http.MethodPost, "/ipfs/", "nope", http.StatusUnauthorized},
+		{http.MethodPost, "/ipfs/", "poster", http.StatusCreated},
+		{http.MethodPost, "/ipfs/", "uploader", http.StatusForbidden},
+		{http.MethodPut, k.String() + "/uploads/c.txt", "poster", http.StatusForbidden},
+		{http.MethodPut, k.String() + "/uploads/c.txt", "uploader", http.StatusCreated},
+		{http.MethodPut, k.String() + "/c.txt", "uploader", http.StatusForbidden},
+		{http.MethodPut, k.String() + "/uploadsx/c.txt", "uploader", http.StatusForbidden},
+		{http.MethodDelete, k.String() + "/uploads/a.txt", "uploader", http.StatusForbidden},
+		{http.MethodDelete, k.String() + "/b.txt", "admin", http.StatusCreated},
+		// reads are not authenticated
+		{http.MethodGet, k.String() + "/b.txt", "", http.StatusOK},
+	} {
+		req, err := http.NewRequest(test.method, ts.URL+test.path, strings.NewReader("content"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.token != "" {
+			req.Header.Set("Authorization", "Bearer "+test.token)
+		}
+		resp, err := doWithoutRedirect(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != test.status {
+			t.Errorf("%s %s with %q: expected %d, got %d", test.method, test.path, test.token, test.status, resp.StatusCode)
+		}
+		if resp.StatusCode == http.StatusUnauthorized && resp.Header.Get("WWW-Authenticate") == "" {
+			t.Errorf("%s %s: expected a WWW-Authenticate header with the 401", test.method, test.path)
+		}
+	}
+}
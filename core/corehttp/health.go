@@ -0,0 +1,291 @@
+package corehttp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	core "github.com/ipfs/go-ipfs/core"
+	repo "github.com/ipfs/go-ipfs/repo"
+
+	ds "github.com/ipfs/go-datastore"
+)
+
+// HealthSelector is the configuration key of the HealthConfig of the node.
+const HealthSelector = "Health"
+
+// healthCheckTimeout bounds each check, so that a stuck subsystem fails its
+// check instead of hanging the probe.
+const healthCheckTimeout = 5 * time.Second
+
+var healthCheckKey = ds.NewKey("/local/health")
+
+// HealthConfig sets the thresholds of the health checks.
+type HealthConfig struct {
+	// MinPeers is the number of connected peers the node needs to be ready.
+	// Defaults to 1.
+	MinPeers *int `json:",omitempty"`
+
+	// MinRoutingTableSize is the number of peers the DHT routing tables need
+	// to hold for the node to be ready. Defaults to 1.
+	MinRoutingTableSize *int `json:",omitempty"`
+
+	// ReproviderStallTimeout is how long the reprovider can go without
+	// reproviding a key, while running, before it is deemed stuck. Defaults
+	// to 1h.
+	ReproviderStallTimeout string `json:",omitempty"`
+}
+
+const (
+	healthStatusOK      = "ok"
+	healthStatusFail    = "fail"
+	healthStatusSkipped = "skipped"
+)
+
+// HealthCheck is the outcome of the check of a subsystem.
+type HealthCheck struct {
+	Status  string
+	Error   string                 `json:",omitempty"`
+	Details map[string]interface{} `json:",omitempty"`
+}
+
+// HealthReport is the response of the health endpoints.
+type HealthReport struct {
+	Status string
+	Checks map[string]HealthCheck `json:",omitempty"`
+}
+
+// healthChecker runs the checks of a node.
+type healthChecker struct {
+	n            *core.IpfsNode
+	minPeers     int
+	minRTSize    int
+	stallTimeout time.Duration
+	now          func() time.Time
+}
+
+func newHealthChecker(n *core.IpfsNode) (*healthChecker, error) {
+	var cfg HealthConfig
+	if _, err := repo.ReadConfigKey(n.Repo, HealthSelector, &cfg); err != nil {
+		return nil, err
+	}
+
+	hc := &healthChecker{
+		n:            n,
+		minPeers:     1,
+		minRTSize:    1,
+		stallTimeout: time.Hour,
+		now:          time.Now,
+	}
+	if cfg.MinPeers != nil {
+		hc.minPeers = *cfg.MinPeers
+	}
+	if cfg.MinRoutingTableSize != nil {
+		hc.minRTSize = *cfg.MinRoutingTableSize
+	}
+	if cfg.ReproviderStallTimeout != "" {
+		d, err := time.ParseDuration(cfg.ReproviderStallTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("%s.ReproviderStallTimeout: %s", HealthSelector, err)
+		}
+		hc.stallTimeout = d
+	}
+	return hc, nil
+}
+
+type healthCheckFunc func(ctx context.Context) HealthCheck
+
+// readinessChecks are the checks the node must pass to serve requests.
+func (hc *healthChecker) readinessChecks() map[string]healthCheckFunc {
+	return map[string]healthCheckFunc{
+		"datastore": hc.checkDatastore,
+		"peers":     hc.checkPeers,
+		"routing":   hc.checkRoutingTable,
+	}
+}
+
+// healthChecks are all the checks of the node.
+func (hc *healthChecker) healthChecks() map[string]healthCheckFunc {
+	checks := hc.readinessChecks()
+	checks["reprovider"] = hc.checkReprovider
+	return checks
+}
+
+func (hc *healthChecker) run(ctx context.Context, checks map[string]healthCheckFunc) HealthReport {
+	report := HealthReport{
+		Status: healthStatusOK,
+		Checks: make(map[string]HealthCheck, len(checks)),
+	}
+	for name, check := range checks {
+		res := withTimeout(ctx, check)
+		if res.Status == healthStatusFail {
+			report.Status = healthStatusFail
+		}
+		report.Checks[name] = res
+	}
+	return report
+}
+
+// withTimeout runs check, failing it if it does not return in time.
+func withTimeout(ctx context.Context, check healthCheckFunc) HealthCheck {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	res := make(chan HealthCheck, 1)
+	go func() {
+		res <- check(ctx)
+	}()
+	select {
+	case r := <-res:
+		return r
+	case <-ctx.Done():
+		return HealthCheck{Status: healthStatusFail, Error: ctx.Err().Error()}
+	}
+}
+
+func (hc *healthChecker) checkDatastore(ctx context.Context) HealthCheck {
+	start := hc.now()
+	if _, err := hc.n.Repo.Datastore().Has(healthCheckKey); err != nil {
+		return HealthCheck{Status: healthStatusFail, Error: err.Error()}
+	}
+	return HealthCheck{
+		Status:  healthStatusOK,
+		Details: map[string]interface{}{"Latency": hc.now().Sub(start).String()},
+	}
+}
+
+func (hc *healthChecker) checkPeers(ctx context.Context) HealthCheck {
+	if !hc.n.IsOnline || hc.n.PeerHost == nil {
+		return HealthCheck{Status: healthStatusSkipped, Error: "node is offline"}
+	}
+	peers := len(hc.n.PeerHost.Network().Peers())
+	res := HealthCheck{
+		Status:  healthStatusOK,
+		Details: map[string]interface{}{"Peers": peers, "MinPeers": hc.minPeers},
+	}
+	if peers < hc.minPeers {
+		res.Status = healthStatusFail
+		res.Error = fmt.Sprintf("%d connected peers, need %d", peers, hc.minPeers)
+	}
+	return res
+}
+
+func (hc *healthChecker) checkRoutingTable(ctx context.Context) HealthCheck {
+	if hc.n.DHT == nil {
+		return HealthCheck{Status: healthStatusSkipped, Error: "DHT is not enabled"}
+	}
+	wan := hc.n.DHT.WAN.RoutingTable().Size()
+	lan := hc.n.DHT.LAN.RoutingTable().Size()
+	res := HealthCheck{
+		Status:  healthStatusOK,
+		Details: map[string]interface{}{"WAN": wan, "LAN": lan, "MinSize": hc.minRTSize},
+	}
+	if wan+lan < hc.minRTSize {
+		res.Status = healthStatusFail
+		res.Error = fmt.Sprintf("%d peers in the routing tables, need %d", wan+lan, hc.minRTSize)
+	}
+	return res
+}
+
+func (hc *healthChecker) checkReprovider(ctx context.Context) HealthCheck {
+	if hc.n.Reprovide == nil {
+		return HealthCheck{Status: healthStatusSkipped, Error: "reprovider is not enabled"}
+	}
+	stat := hc.n.Reprovide.Stat()
+	details := map[string]interface{}{
+		"Running": stat.Running,
+		"Keys":    stat.Keys,
+	}
+	if !stat.LastStarted.IsZero() {
+		details["LastStarted"] = stat.LastStarted
+		details["LastProgress"] = stat.LastProgress
+	}
+	if !stat.LastFinished.IsZero() {
+		details["LastFinished"] = stat.LastFinished
+	}
+
+	res := HealthCheck{Status: healthStatusOK, Details: details}
+	if stalled := hc.now().Sub(stat.LastProgress); stat.Running && stalled > hc.stallTimeout {
+		res.Status = healthStatusFail
+		res.Error = fmt.Sprintf("no key reprovided for %s", stalled.Round(time.Second))
+	}
+	return res
+}
+
+func writeHealthReport(w http.ResponseWriter, report HealthReport) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if report.Status != healthStatusOK {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		log.Debugf("writing the health report: %s", err)
+	}
+}
+
+func closing(n *core.IpfsNode) bool {
+	select {
+	case <-n.Process.Closing():
+		return true
+	default:
+		return false
+	}
+}
+
+// LivenessOption serves, at path, whether the node is running: 200 OK until
+// it starts shutting down, 503 Service Unavailable after.
+func LivenessOption(path string) ServeOption {
+	return func(n *core.IpfsNode, _ net.Listener, mux *http.ServeMux) (*http.ServeMux, error) {
+		mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			report := HealthReport{Status: healthStatusOK}
+			if closing(n) {
+				report.Status = healthStatusFail
+			}
+			writeHealthReport(w, report)
+		})
+		return mux, nil
+	}
+}
+
+// ReadinessOption serves, at path, whether the node can serve requests: its
+// datastore is reachable, it has enough peers and its DHT routing tables are
+// populated. It answers with 503 Service Unavailable when a check fails.
+func ReadinessOption(path string) ServeOption {
+	return func(n *core.IpfsNode, _ net.Listener, mux *http.ServeMux) (*http.ServeMux, error) {
+		hc, err := newHealthChecker(n)
+		if err != nil {
+			return nil, err
+		}
+		mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			if closing(n) {
+				writeHealthReport(w, HealthReport{Status: healthStatusFail})
+				return
+			}
+			writeHealthReport(w, hc.run(r.Context(), hc.readinessChecks()))
+		})
+		return mux, nil
+	}
+}
+
+// HealthOption serves, at path, the checks of ReadinessOption, and whether the
+// reprovider is stuck. It answers with 503 Service Unavailable when a check
+// fails.
+func HealthOption(path string) ServeOption {
+	return func(n *core.IpfsNode, _ net.Listener, mux *http.ServeMux) (*http.ServeMux, error) {
+		hc, err := newHealthChecker(n)
+		if err != nil {
+			return nil, err
+		}
+		mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			if closing(n) {
+				writeHealthReport(w, HealthReport{Status: healthStatusFail})
+				return
+			}
+			writeHealthReport(w, hc.run(r.Context(), hc.healthChecks()))
+		})
+		return mux, nil
+	}
+}
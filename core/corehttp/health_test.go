@@ -0,0 +1,74 @@
+package corehttp
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHealthEndpoints(t *testing.T) {
+	n, err := newNodeWithMockNamesys(mockNamesys{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	for _, opt := range []ServeOption{
+		HealthOption("/debug/health"),
+		ReadinessOption("/debug/ready"),
+		LivenessOption("/debug/live"),
+	} {
+		if _, err := opt(n, nil, mux); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	get := func(path string) (int, HealthReport) {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		var report HealthReport
+		if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+			t.Fatalf("%s: %s", path, err)
+		}
+		return rec.Code, report
+	}
+
+	status, report := get("/debug/health")
+	if status != http.StatusOK || report.Status != healthStatusOK {
+		t.Fatalf("expected a healthy node, got %d: %+v", status, report)
+	}
+	if c := report.Checks["datastore"]; c.Status != healthStatusOK {
+		t.Errorf("expected the datastore check to pass, got %+v", c)
+	}
+	// the node is offline
+	for _, name := range []string{"peers", "routing"} {
+		if c := report.Checks[name]; c.Status != healthStatusSkipped {
+			t.Errorf("expected the %s check to be skipped, got %+v", name, c)
+		}
+	}
+	if c := report.Checks["reprovider"]; c.Status != healthStatusOK || c.Details["Running"] != false {
+		t.Errorf("expected an idle reprovider, got %+v", c)
+	}
+
+	status, report = get("/debug/ready")
+	if status != http.StatusOK {
+		t.Fatalf("expected a ready node, got %d: %+v", status, report)
+	}
+	if _, ok := report.Checks["reprovider"]; ok {
+		t.Error("expected readiness not to depend on the reprovider")
+	}
+
+	if status, _ := get("/debug/live"); status != http.StatusOK {
+		t.Fatalf("expected a live node, got %d", status)
+	}
+
+	if err := n.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"/debug/health", "/debug/ready", "/debug/live"} {
+		if status, _ := get(path); status != http.StatusServiceUnavailable {
+			t.Errorf("%s: expected 503 once the node is closing, got %d", path, status)
+		}
+	}
+}
@@ -143,8 +143,42 @@ var (
 		Name:      "unixfs_get_latency_seconds",
 		Help:      "The time till the first block is received when 'getting' a file from the gateway.",
 	}, []string{"namespace"})
+
+	rateLimitRejectedMetric = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "ipfs",
+		Subsystem: "http",
+		Name:      "ratelimit_rejected_total",
+		Help:      "Number of requests answered with 429, by exceeded limit.",
+	}, []string{"reason"})
+
+	rateLimitInFlightMetric = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "ipfs",
+		Subsystem: "http",
+		Name:      "ratelimit_inflight_requests",
+		Help:      "Number of requests being served by the rate limiter.",
+	})
+
+	rateLimitClientsMetric = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "ipfs",
+		Subsystem: "http",
+		Name:      "ratelimit_clients",
+		Help:      "Number of clients tracked by the rate limiters of all the listeners.",
+	})
 )
 
+// registerRateLimitMetrics registers the metrics of RateLimitOption, which
+// may be used by several listeners.
+func registerRateLimitMetrics() error {
+	for _, c := range []prometheus.Collector{rateLimitRejectedMetric, rateLimitInFlightMetric, rateLimitClientsMetric} {
+		if err := prometheus.Register(c); err != nil {
+			if _, ok := err.(prometheus.AlreadyRegisteredError); !ok {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 type IpfsNodeCollector struct {
 	Node *core.IpfsNode
 }
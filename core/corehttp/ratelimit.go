@@ -0,0 +1,283 @@
+package corehttp
+
+import (
+	"container/list"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	core "github.com/ipfs/go-ipfs/core"
+	repo "github.com/ipfs/go-ipfs/repo"
+)
+
+// RateLimitSelector is the configuration key of the RateLimitConfig of the
+// gateway.
+const RateLimitSelector = "Gateway.RateLimit"
+
+// rateLimitSweepInterval is how often the state of idle clients is dropped.
+const rateLimitSweepInterval = time.Minute
+
+// rateLimitMaxClients caps the number of clients tracked by a rate limiter.
+// The least recently seen client without request being served is dropped to
+// make room for a new one.
+const rateLimitMaxClients = 100000
+
+// rateLimitIPv6Prefix is the length of the prefix identifying IPv6 clients, as
+// a client usually gets a whole /64.
+const rateLimitIPv6Prefix = 64
+
+// RateLimitConfig limits the requests of each client.
+type RateLimitConfig struct {
+	// RequestsPerSecond is the sustained request rate of a client. Zero
+	// disables the rate limit.
+	RequestsPerSecond float64
+
+	// Burst is the number of requests a client can make at once, after being
+	// idle. Defaults to RequestsPerSecond, and at least 1.
+	Burst int
+
+	// MaxInFlight is the number of requests of a client served at the same
+	// time. Zero disables the limit.
+	MaxInFlight int
+
+	// KeyHeader is the request header identifying clients, such as
+	// X-Forwarded-For behind a reverse proxy. Clients are identified by their
+	// IP address when it is empty or missing from a request.
+	KeyHeader string
+
+	// TrustedProxies is the number of reverse proxies in front of the
+	// gateway appending to the list in KeyHeader. The client is the value
+	// appended by the outermost one, TrustedProxies values from the right:
+	// values on its left are set by the client itself. Defaults to 1.
+	TrustedProxies int
+}
+
+func (cfg RateLimitConfig) enabled() bool {
+	return cfg.RequestsPerSecond > 0 || cfg.MaxInFlight > 0
+}
+
+// RateLimitOption answers requests over the limits of RateLimitConfig with
+// 429 Too Many Requests. It does nothing when no limit is configured.
+func RateLimitOption() ServeOption {
+	return func(n *core.IpfsNode, _ net.Listener, mux *http.ServeMux) (*http.ServeMux, error) {
+		var cfg RateLimitConfig
+		if _, err := repo.ReadConfigKey(n.Repo, RateLimitSelector, &cfg); err != nil {
+			return nil, err
+		}
+		if !cfg.enabled() {
+			return mux, nil
+		}
+		if err := registerRateLimitMetrics(); err != nil {
+			return nil, err
+		}
+
+		childMux := http.NewServeMux()
+		mux.Handle("/", newRateLimiter(cfg).handler(childMux))
+		return childMux, nil
+	}
+}
+
+// clientLimit is the state of a client: a token bucket, and the number of
+// requests being served.
+type clientLimit struct {
+	tokens   float64
+	last     time.Time
+	inFlight int
+
+	key string
+	// elem is the client in rateLimiter.seen
+	elem *list.Element
+}
+
+type rateLimiter struct {
+	cfg        RateLimitConfig
+	burst      float64
+	maxClients int
+	now        func() time.Time
+
+	lk      sync.Mutex
+	clients map[string]*clientLimit
+	// seen orders the clients from the most to the least recently seen
+	seen      *list.List
+	lastSweep time.Time
+}
+
+func newRateLimiter(cfg RateLimitConfig) *rateLimiter {
+	burst := cfg.Burst
+	if burst <= 0 {
+		burst = int(math.Ceil(cfg.RequestsPerSecond))
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	if cfg.TrustedProxies <= 0 {
+		cfg.TrustedProxies = 1
+	}
+	return &rateLimiter{
+		cfg:        cfg,
+		burst:      float64(burst),
+		maxClients: rateLimitMaxClients,
+		now:        time.Now,
+		clients:    make(map[string]*clientLimit),
+		seen:       list.New(),
+	}
+}
+
+const (
+	rateLimitReasonRate     = "rate"
+	rateLimitReasonInFlight = "inflight"
+	rateLimitReasonClients  = "clients"
+)
+
+// acquire counts a request of the client. When the client is over a limit, it
+// returns how long the client should wait and which limit it hit. Otherwise
+// release must be called once the request is served.
+func (l *rateLimiter) acquire(key string) (release func(), retryAfter time.Duration, reason string) {
+	l.lk.Lock()
+	defer l.lk.Unlock()
+
+	now := l.now()
+	if now.Sub(l.lastSweep) >= rateLimitSweepInterval {
+		l.sweep(now)
+	}
+
+	c, ok := l.clients[key]
+	if ok {
+		l.seen.MoveToFront(c.elem)
+	} else {
+		if len(l.clients) >= l.maxClients && !l.evict() {
+			return nil, time.Second, rateLimitReasonClients
+		}
+		c = &clientLimit{tokens: l.burst, last: now, key: key}
+		c.elem = l.seen.PushFront(c)
+		l.clients[key] = c
+		rateLimitClientsMetric.Inc()
+	}
+
+	if l.cfg.MaxInFlight > 0 && c.inFlight >= l.cfg.MaxInFlight {
+		return nil, time.Second, rateLimitReasonInFlight
+	}
+
+	if rps := l.cfg.RequestsPerSecond; rps > 0 {
+		c.tokens = math.Min(l.burst, c.tokens+now.Sub(c.last).Seconds()*rps)
+		c.last = now
+		if c.tokens < 1 {
+			wait := time.Duration((1 - c.tokens) / rps * float64(time.Second))
+			return nil, wait, rateLimitReasonRate
+		}
+		c.tokens--
+	}
+
+	c.inFlight++
+	rateLimitInFlightMetric.Inc()
+	return func() {
+		l.lk.Lock()
+		c.inFlight--
+		l.lk.Unlock()
+		rateLimitInFlightMetric.Dec()
+	}, 0, ""
+}
+
+// sweep drops the clients with no request being served and, when requests
+// are rate limited, a full bucket: they would be recreated the same.
+func (l *rateLimiter) sweep(now time.Time) {
+	l.lastSweep = now
+
+	dropped := 0
+	for _, c := range l.clients {
+		if c.inFlight > 0 {
+			continue
+		}
+		if rps := l.cfg.RequestsPerSecond; rps > 0 && c.tokens+now.Sub(c.last).Seconds()*rps < l.burst {
+			continue
+		}
+		l.drop(c)
+		dropped++
+	}
+	// The gauge is shared by the limiters of all the listeners
+	rateLimitClientsMetric.Sub(float64(dropped))
+}
+
+// evict drops the least recently seen client with no request being served,
+// and returns false if there is none.
+func (l *rateLimiter) evict() bool {
+	for e := l.seen.Back(); e != nil; e = e.Prev() {
+		if c := e.Value.(*clientLimit); c.inFlight == 0 {
+			l.drop(c)
+			rateLimitClientsMetric.Dec()
+			return true
+		}
+	}
+	return false
+}
+
+func (l *rateLimiter) drop(c *clientLimit) {
+	delete(l.clients, c.key)
+	l.seen.Remove(c.elem)
+}
+
+// clientKey identifies the client of a request. Proxies append to the list in
+// KeyHeader, possibly in another header line: the client is the value
+// appended by the outermost trusted proxy, or the first value when there are
+// fewer. IPv6 clients are identified by their /64 prefix.
+func (l *rateLimiter) clientKey(r *http.Request) string {
+	return ipClientKey(l.headerClientKey(r))
+}
+
+func (l *rateLimiter) headerClientKey(r *http.Request) string {
+	if l.cfg.KeyHeader != "" {
+		var values []string
+		for _, line := range r.Header.Values(l.cfg.KeyHeader) {
+			for _, v := range strings.Split(line, ",") {
+				if v = strings.TrimSpace(v); v != "" {
+					values = append(values, v)
+				}
+			}
+		}
+		if len(values) > 0 {
+			i := len(values) - l.cfg.TrustedProxies
+			if i < 0 {
+				i = 0
+			}
+			return values[i]
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// ipClientKey returns the /64 prefix of an IPv6 address, and any other key
+// unchanged.
+func ipClientKey(key string) string {
+	ip := net.ParseIP(key)
+	if ip == nil || ip.To4() != nil {
+		return key
+	}
+	mask := net.CIDRMask(rateLimitIPv6Prefix, 8*net.IPv6len)
+	return (&net.IPNet{IP: ip.Mask(mask), Mask: mask}).String()
+}
+
+func (l *rateLimiter) handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		release, retryAfter, reason := l.acquire(l.clientKey(r))
+		if release == nil {
+			rateLimitRejectedMetric.WithLabelValues(reason).Inc()
+			seconds := int(math.Ceil(retryAfter.Seconds()))
+			if seconds < 1 {
+				seconds = 1
+			}
+			w.Header().Set("Retry-After", strconv.Itoa(seconds))
+			http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+			return
+		}
+		defer release()
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,205 @@
+package corehttp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRateLimiterRate(t *testing.T) {
+	now := time.Unix(1000, 0)
+	l := newRateLimiter(RateLimitConfig{RequestsPerSecond: 2, Burst: 3})
+	l.now = func() time.Time { return now }
+
+	// The burst is served at once
+	for i := 0; i < 3; i++ {
+		release, _, _ := l.acquire("a")
+		if release == nil {
+			t.Fatalf("request %d of the burst rejected", i)
+		}
+		release()
+	}
+	release, retryAfter, reason := l.acquire("a")
+	if release != nil || reason != rateLimitReasonRate {
+		t.Fatal("expected the request over the burst to be rejected")
+	}
+	if retryAfter != 500*time.Millisecond {
+		t.Errorf("expected to retry after 500ms, got %s", retryAfter)
+	}
+
+	// Other clients have their own bucket
+	if release, _, _ := l.acquire("b"); release == nil {
+		t.Fatal("expected another client to be served")
+	}
+
+	// Tokens come back at the configured rate
+	now = now.Add(500 * time.Millisecond)
+	if release, _, _ := l.acquire("a"); release == nil {
+		t.Fatal("expected a request after the refill to be served")
+	}
+	if release, _, _ := l.acquire("a"); release != nil {
+		t.Fatal("expected a single token to be refilled")
+	}
+
+	// Idle clients are forgotten
+	now = now.Add(rateLimitSweepInterval)
+	l.acquire("c")
+	if _, ok := l.clients["a"]; ok {
+		t.Error("expected the idle client to be dropped")
+	}
+}
+
+func TestRateLimiterInFlight(t *testing.T) {
+	l := newRateLimiter(RateLimitConfig{MaxInFlight: 2})
+
+	r1, _, _ := l.acquire("a")
+	r2, _, _ := l.acquire("a")
+	if r1 == nil || r2 == nil {
+		t.Fatal("expected the requests under the limit to be served")
+	}
+	if release, _, reason := l.acquire("a"); release != nil || reason != rateLimitReasonInFlight {
+		t.Fatal("expected the request over the limit to be rejected")
+	}
+	r1()
+	if release, _, _ := l.acquire("a"); release == nil {
+		t.Fatal("expected a request to be served once another completed")
+	}
+}
+
+func TestRateLimitHandler(t *testing.T) {
+	if err := registerRateLimitMetrics(); err != nil {
+		t.Fatal(err)
+	}
+	l := newRateLimiter(RateLimitConfig{RequestsPerSecond: 0.1, KeyHeader: "X-Forwarded-For"})
+	h := l.handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	get := func(forwardedFor string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/ipfs/", nil)
+		if forwardedFor != "" {
+			req.Header.Set("X-Forwarded-For", forwardedFor)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := get("10.0.0.1, 192.168.0.1"); w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	// Clients can't escape the limit by setting the header themselves
+	w := get("10.0.0.2, 192.168.0.1")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429, got %d", w.Code)
+	}
+	if ra := w.Header().Get("Retry-After"); ra != "10" {
+		t.Errorf("expected to retry after 10s, got %q", ra)
+	}
+
+	// Requests without the header are identified by their address
+	if w := get(""); w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+}
+
+func TestRateLimiterClientKey(t *testing.T) {
+	for _, test := range []struct {
+		proxies int
+		header  []string
+		key     string
+	}{
+		{0, nil, "192.0.2.1"},
+		{0, []string{"10.0.0.1"}, "10.0.0.1"},
+		{0, []string{"10.0.0.1, 10.0.0.2"}, "10.0.0.2"},
+		{0, []string{"10.0.0.1", "10.0.0.2"}, "10.0.0.2"},
+		{2, []string{"10.0.0.1, 10.0.0.2, 10.0.0.3"}, "10.0.0.2"},
+		{2, []string{"10.0.0.1, 10.0.0.2", "10.0.0.3"}, "10.0.0.2"},
+		{3, []string{"10.0.0.2"}, "10.0.0.2"},
+		// IPv6 clients are identified by their /64
+		{0, []string{"2001:db8:1:2:3:4:5:6"}, "2001:db8:1:2::/64"},
+		{0, []string{"2001:db8:1:2::1"}, "2001:db8:1:2::/64"},
+		{0, []string{"::ffff:10.0.0.1"}, "::ffff:10.0.0.1"},
+		{0, []string{"client-id"}, "client-id"},
+	} {
+		l := newRateLimiter(RateLimitConfig{RequestsPerSecond: 1, KeyHeader: "X-Forwarded-For", TrustedProxies: test.proxies})
+		req := httptest.NewRequest(http.MethodGet, "/ipfs/", nil)
+		for _, v := range test.header {
+			req.Header.Add("X-Forwarded-For", v)
+		}
+		if key := l.clientKey(req); key != test.key {
+			t.Errorf("%d proxies, header %q: expected %s, got %s", test.proxies, test.header, test.key, key)
+		}
+	}
+}
+
+func TestRateLimiterMaxClients(t *testing.T) {
+	now := time.Unix(1000, 0)
+	l := newRateLimiter(RateLimitConfig{RequestsPerSecond: 1, MaxInFlight: 1})
+	l.now = func() time.Time { return now }
+	l.maxClients = 2
+
+	releaseA, _, _ := l.acquire("a")
+	if releaseA == nil {
+		t.Fatal("expected client a to be served")
+	}
+	release, _, _ := l.acquire("b")
+	if release == nil {
+		t.Fatal("expected client b to be served")
+	}
+	release()
+
+	// The least recently seen idle client makes room for a new one
+	release, _, _ = l.acquire("c")
+	if release == nil {
+		t.Fatal("expected a new client to be served while the limiter is full")
+	}
+	release()
+	if _, ok := l.clients["b"]; ok || len(l.clients) != 2 || l.seen.Len() != 2 {
+		t.Fatalf("expected client b to be dropped, clients %v", l.clients)
+	}
+	if release, _, _ := l.acquire("c"); release != nil {
+		t.Fatal("expected a known client to keep its limit")
+	}
+
+	// Clients with requests being served are kept
+	now = now.Add(time.Second)
+	if release, _, _ := l.acquire("d"); release == nil {
+		t.Fatal("expected a new client to be served")
+	}
+	if _, ok := l.clients["a"]; !ok {
+		t.Fatal("expected a client with a request being served to be kept")
+	}
+	if _, ok := l.clients["c"]; ok {
+		t.Fatal("expected idle client c to be dropped")
+	}
+	if release, _, reason := l.acquire("e"); release != nil || reason != rateLimitReasonClients {
+		t.Fatal("expected a new client to be rejected while every client is busy")
+	}
+	releaseA()
+}
+
+func TestRateLimitClientsMetric(t *testing.T) {
+	before := testutil.ToFloat64(rateLimitClientsMetric)
+
+	// Limiters of several listeners add up
+	now := time.Unix(1000, 0)
+	var limiters []*rateLimiter
+	for i := 0; i < 2; i++ {
+		l := newRateLimiter(RateLimitConfig{RequestsPerSecond: 1})
+		l.now = func() time.Time { return now }
+		l.acquire("a")
+		l.acquire("b")
+		limiters = append(limiters, l)
+	}
+	if got := testutil.ToFloat64(rateLimitClientsMetric) - before; got != 4 {
+		t.Fatalf("expected 4 clients, got %v", got)
+	}
+
+	now = now.Add(rateLimitSweepInterval)
+	limiters[0].acquire("c")
+	if got := testutil.ToFloat64(rateLimitClientsMetric) - before; got != 3 {
+		t.Fatalf("expected 3 clients after a sweep, got %v", got)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/ipfs/go-ipfs/core"
@@ -27,6 +28,15 @@ type GC struct {
 	StorageGC  uint64
 	SlackGB    uint64
 	Storage    uint64
+
+	// Incremental makes watermark-triggered collections use the
+	// incremental collector instead of holding the GC lock for the whole
+	// run.
+	Incremental bool
+
+	// Policy selects what is removed once StorageGC is crossed, see
+	// gc.PolicyFull and gc.PolicyLRU.
+	Policy string
 }
 
 func NewGC(n *core.IpfsNode) (*GC, error) {
@@ -52,6 +62,14 @@ func NewGC(n *core.IpfsNode) (*GC, error) {
 		cfg.Datastore.StorageGCWatermark = 90
 	}
 
+	policy, err := GCPolicy(r)
+	if err != nil {
+		return nil, err
+	}
+	if policy == gc.PolicyLRU && n.AccessTracker == nil {
+		return nil, fmt.Errorf("%s is set to %q but block accesses are not tracked, restart the daemon", gc.PolicySelector, policy)
+	}
+
 	storageMax, err := humanize.ParseBytes(cfg.Datastore.StorageMax)
 	if err != nil {
 		return nil, err
@@ -71,9 +89,25 @@ func NewGC(n *core.IpfsNode) (*GC, error) {
 		StorageMax: storageMax,
 		StorageGC:  storageGC,
 		SlackGB:    slackGB,
+		Policy:     policy,
 	}, nil
 }
 
+// GCPolicy returns the configured storage GC policy, gc.PolicyFull if none
+// is set.
+func GCPolicy(r repo.Repo) (string, error) {
+	policy := gc.PolicyFull
+	if _, err := repo.ReadConfigKey(r, gc.PolicySelector, &policy); err != nil {
+		return "", err
+	}
+	switch policy {
+	case gc.PolicyFull, gc.PolicyLRU:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown %s %q", gc.PolicySelector, policy)
+	}
+}
+
 func BestEffortRoots(filesRoot *mfs.Root) ([]cid.Cid, error) {
 	rootDag, err := filesRoot.GetDirectory().GetNode()
 	if err != nil {
@@ -93,6 +127,13 @@ func GarbageCollect(n *core.IpfsNode, ctx context.Context) error {
 	return CollectResult(ctx, rmed, nil)
 }
 
+// IncrementalGarbageCollect is like GarbageCollect but uses the incremental
+// collector, see gc.IncrementalGC.
+func IncrementalGarbageCollect(n *core.IpfsNode, ctx context.Context) error {
+	rmed := IncrementalGarbageCollectAsync(n, ctx, gc.IncrementalOptions{})
+	return CollectResult(ctx, rmed, nil)
+}
+
 // CollectResult collects the output of a garbage collection run and calls the
 // given callback for each object removed.  It also collects all errors into a
 // MultiError which is returned after the gc is completed.
@@ -159,7 +200,42 @@ func GarbageCollectAsync(n *core.IpfsNode, ctx context.Context) <-chan gc.Result
 	return gc.GC(ctx, n.Blockstore, n.Repo.Datastore(), n.Pinning, roots)
 }
 
+// IncrementalGarbageCollectAsync starts an incremental garbage collection
+// and returns its results, see gc.IncrementalGC.
+func IncrementalGarbageCollectAsync(n *core.IpfsNode, ctx context.Context, opts gc.IncrementalOptions) <-chan gc.Result {
+	roots := func() ([]cid.Cid, error) {
+		return BestEffortRoots(n.FilesRoot)
+	}
+	return gc.IncrementalGC(ctx, n.Blockstore, n.WriteBarrier, n.Repo.Datastore(), n.Pinning, roots, opts)
+}
+
+// EvictLRU removes the least recently used unpinned blocks until at least
+// size bytes were freed, see gc.Evict. The node must track block accesses.
+func EvictLRU(n *core.IpfsNode, ctx context.Context, size uint64) error {
+	if n.AccessTracker == nil {
+		return errors.New("block accesses are not tracked")
+	}
+
+	roots, err := BestEffortRoots(n.FilesRoot)
+	if err != nil {
+		return err
+	}
+	rmed := gc.Evict(ctx, n.Blockstore, n.Repo.Datastore(), n.Pinning, roots, n.AccessTracker, size)
+
+	return CollectResult(ctx, rmed, nil)
+}
+
 func PeriodicGC(ctx context.Context, node *core.IpfsNode) error {
+	return periodicGC(ctx, node, false)
+}
+
+// PeriodicIncrementalGC is like PeriodicGC but collects with the incremental
+// collector, so adds and pins are not blocked while it runs.
+func PeriodicIncrementalGC(ctx context.Context, node *core.IpfsNode) error {
+	return periodicGC(ctx, node, true)
+}
+
+func periodicGC(ctx context.Context, node *core.IpfsNode, incremental bool) error {
 	cfg, err := node.Repo.Config()
 	if err != nil {
 		return err
@@ -182,6 +258,7 @@ func PeriodicGC(ctx context.Context, node *core.IpfsNode) error {
 	if err != nil {
 		return err
 	}
+	gc.Incremental = incremental
 
 	for {
 		select {
@@ -204,21 +281,36 @@ func ConditionalGC(ctx context.Context, node *core.IpfsNode, offset uint64) erro
 	return gc.maybeGC(ctx, offset)
 }
 
-func (gc *GC) maybeGC(ctx context.Context, offset uint64) error {
-	storage, err := gc.Repo.GetStorageUsage()
+func (g *GC) maybeGC(ctx context.Context, offset uint64) error {
+	storage, err := g.Repo.GetStorageUsage()
 	if err != nil {
 		return err
 	}
 
-	if storage+offset > gc.StorageGC {
-		if storage+offset > gc.StorageMax {
+	if storage+offset > g.StorageGC {
+		if storage+offset > g.StorageMax {
 			log.Warnf("pre-GC: %s", ErrMaxStorageExceeded)
 		}
 
+		if g.Policy == gc.PolicyLRU {
+			toFree := storage + offset - g.StorageGC
+			log.Infof("Watermark exceeded. Evicting %s of least recently used blocks...", humanize.Bytes(toFree))
+
+			if err := EvictLRU(g.Node, ctx, toFree); err != nil {
+				return err
+			}
+			log.Infof("Repo eviction done. See `ipfs repo stat` to see how much space got freed.\n")
+			return nil
+		}
+
 		// Do GC here
 		log.Info("Watermark exceeded. Starting repo GC...")
 
-		if err := GarbageCollect(gc.Node, ctx); err != nil {
+		collect := GarbageCollect
+		if g.Incremental {
+			collect = IncrementalGarbageCollect
+		}
+		if err := collect(g.Node, ctx); err != nil {
 			return err
 		}
 		log.Infof("Repo GC done. See `ipfs repo stat` to see how much space got freed.\n")
@@ -24,6 +24,9 @@ type Stat struct {
 	NumObjects uint64
 	RepoPath   string
 	Version    string
+
+	GCPolicy      string
+	TrackedBlocks uint64 `json:",omitempty"` // blocks with a known access time, with the lru GC policy
 }
 
 // NoLimit represents the value for unlimited storage
@@ -51,14 +54,30 @@ func RepoStat(ctx context.Context, n *core.IpfsNode) (Stat, error) {
 		return Stat{}, err
 	}
 
+	policy, err := GCPolicy(n.Repo)
+	if err != nil {
+		return Stat{}, err
+	}
+
+	var tracked uint64
+	if n.AccessTracker != nil {
+		l, err := n.AccessTracker.Len()
+		if err != nil {
+			return Stat{}, err
+		}
+		tracked = uint64(l)
+	}
+
 	return Stat{
 		SizeStat: SizeStat{
 			RepoSize:   sizeStat.RepoSize,
 			StorageMax: sizeStat.StorageMax,
 		},
-		NumObjects: count,
-		RepoPath:   path,
-		Version:    fmt.Sprintf("fs-repo@%d", fsrepo.RepoVersion),
+		NumObjects:    count,
+		RepoPath:      path,
+		Version:       fmt.Sprintf("fs-repo@%d", fsrepo.RepoVersion),
+		GCPolicy:      policy,
+		TrackedBlocks: tracked,
 	}, nil
 }
 
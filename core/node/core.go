@@ -3,6 +3,7 @@ package node
 import (
 	"context"
 	"fmt"
+	"path/filepath"
 	"time"
 
 	"github.com/ipfs/go-bitswap"
@@ -23,7 +24,10 @@ import (
 	"github.com/libp2p/go-libp2p-core/routing"
 	"go.uber.org/fx"
 
+	"github.com/ipfs/go-ipfs/audit"
 	"github.com/ipfs/go-ipfs/core/node/helpers"
+	"github.com/ipfs/go-ipfs/denylist"
+	"github.com/ipfs/go-ipfs/pinmeta"
 	"github.com/ipfs/go-ipfs/repo"
 )
 
@@ -40,8 +44,47 @@ func BlockService(lc fx.Lifecycle, bs blockstore.Blockstore, rem exchange.Interf
 	return bsvc
 }
 
+// PinMeta creates the store for the information recorded alongside pins
+func PinMeta(repo repo.Repo) *pinmeta.Store {
+	return pinmeta.NewStore(repo.Datastore())
+}
+
+// Denylist loads the denylists of the repo. Repos not stored on disk have
+// none.
+func Denylist(repo repo.Repo) (*denylist.Denylist, error) {
+	var dir string
+	if r, ok := repo.(interface{ Path() string }); ok {
+		dir = filepath.Join(r.Path(), denylist.DirName)
+	}
+	return denylist.Load(dir)
+}
+
+// AuditLog opens the audit log of the API of the repo, when enabled. Repos not
+// stored on disk have none.
+func AuditLog(lc fx.Lifecycle, r repo.Repo) (*audit.Log, error) {
+	var cfg audit.Config
+	if _, err := repo.ReadConfigKey(r, audit.Selector, &cfg); err != nil {
+		return nil, err
+	}
+	fsr, ok := r.(interface{ Path() string })
+	if !cfg.Enabled || !ok {
+		return nil, nil
+	}
+
+	l, err := audit.Open(filepath.Join(fsr.Path(), audit.DirName), cfg)
+	if err != nil {
+		return nil, err
+	}
+	lc.Append(fx.Hook{
+		OnStop: func(context.Context) error {
+			return l.Close()
+		},
+	})
+	return l, nil
+}
+
 // Pinning creates new pinner which tells GC which blocks should be kept
-func Pinning(bstore blockstore.Blockstore, ds format.DAGService, repo repo.Repo) (pin.Pinner, error) {
+func Pinning(bstore blockstore.Blockstore, ds format.DAGService, repo repo.Repo, meta *pinmeta.Store) (pin.Pinner, error) {
 	rootDS := repo.Datastore()
 
 	syncFn := func() error {
@@ -60,7 +103,7 @@ func Pinning(bstore blockstore.Blockstore, ds format.DAGService, repo repo.Repo)
 		return nil, err
 	}
 
-	return pinning, nil
+	return pinmeta.NewPinner(pinning, meta), nil
 }
 
 var (
@@ -89,9 +132,10 @@ func Dag(bs blockservice.BlockService) format.DAGService {
 
 // OnlineExchange creates new LibP2P backed block exchange (BitSwap)
 func OnlineExchange(provide bool) interface{} {
-	return func(mctx helpers.MetricsCtx, lc fx.Lifecycle, host host.Host, rt routing.Routing, bs blockstore.GCBlockstore) exchange.Interface {
+	return func(mctx helpers.MetricsCtx, lc fx.Lifecycle, host host.Host, rt routing.Routing, bs blockstore.GCBlockstore, deny *denylist.Denylist) exchange.Interface {
 		bitswapNetwork := network.NewFromIpfsHost(host, rt)
-		exch := bitswap.New(helpers.LifecycleCtx(mctx, lc), bitswapNetwork, bs, bitswap.ProvideEnabled(provide))
+		// blocked blocks are not served to other peers
+		exch := bitswap.New(helpers.LifecycleCtx(mctx, lc), bitswapNetwork, denylist.NewBlockstore(bs, deny), bitswap.ProvideEnabled(provide))
 		lc.Append(fx.Hook{
 			OnStop: func(ctx context.Context) error {
 				return exch.Close()
@@ -14,7 +14,9 @@ import (
 	pubsub "github.com/libp2p/go-libp2p-pubsub"
 
 	"github.com/ipfs/go-ipfs/core/node/libp2p"
+	"github.com/ipfs/go-ipfs/gc"
 	"github.com/ipfs/go-ipfs/p2p"
+	"github.com/ipfs/go-ipfs/repo"
 
 	offline "github.com/ipfs/go-ipfs-exchange-offline"
 	offroute "github.com/ipfs/go-ipfs-routing/offline"
@@ -161,6 +163,11 @@ func Storage(bcfg *BuildCfg, cfg *config.Config) fx.Option {
 		cacheOpts.HasBloomFilterSize = 0
 	}
 
+	var gcPolicy string
+	if _, err := repo.ReadConfigKey(bcfg.Repo, gc.PolicySelector, &gcPolicy); err != nil {
+		return fx.Error(err)
+	}
+
 	finalBstore := fx.Provide(GcBlockstoreCtor)
 	if cfg.Experimental.FilestoreEnabled || cfg.Experimental.UrlstoreEnabled {
 		finalBstore = fx.Provide(FilestoreBlockstoreCtor)
@@ -169,7 +176,8 @@ func Storage(bcfg *BuildCfg, cfg *config.Config) fx.Option {
 	return fx.Options(
 		fx.Provide(RepoConfig),
 		fx.Provide(Datastore),
-		fx.Provide(BaseBlockstoreCtor(cacheOpts, bcfg.NilRepo, cfg.Datastore.HashOnRead)),
+		fx.Provide(gc.NewWriteBarrier),
+		fx.Provide(BaseBlockstoreCtor(cacheOpts, bcfg.NilRepo, cfg.Datastore.HashOnRead, gcPolicy == gc.PolicyLRU)),
 		finalBstore,
 	)
 }
@@ -258,6 +266,13 @@ func Online(bcfg *BuildCfg, cfg *config.Config) fx.Option {
 		recordLifetime = d
 	}
 
+	var p2pListeners []p2p.ListenerConfig
+	if cfg.Experimental.Libp2pStreamMounting {
+		if _, err := repo.ReadConfigKey(bcfg.Repo, p2p.ListenersSelector, &p2pListeners); err != nil {
+			return fx.Error(err)
+		}
+	}
+
 	/* don't provide from bitswap when the strategic provider service is active */
 	shouldBitswapProvide := !cfg.Experimental.StrategicProviding
 
@@ -271,6 +286,7 @@ func Online(bcfg *BuildCfg, cfg *config.Config) fx.Option {
 		fx.Invoke(IpnsRepublisher(repubPeriod, recordLifetime)),
 
 		fx.Provide(p2p.New),
+		P2PListeners(p2pListeners),
 
 		LibP2P(bcfg, cfg),
 		OnlineProviders(cfg.Experimental.StrategicProviding, cfg.Reprovider.Strategy, cfg.Reprovider.Interval),
@@ -292,6 +308,9 @@ var Core = fx.Options(
 	fx.Provide(BlockService),
 	fx.Provide(Dag),
 	fx.Provide(resolver.NewBasicResolver),
+	fx.Provide(PinMeta),
+	fx.Provide(Denylist),
+	fx.Provide(AuditLog),
 	fx.Provide(Pinning),
 	fx.Provide(Files),
 )
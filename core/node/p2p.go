@@ -0,0 +1,27 @@
+package node
+
+import (
+	"context"
+
+	"github.com/ipfs/go-ipfs/core/node/helpers"
+	"github.com/ipfs/go-ipfs/p2p"
+	"go.uber.org/fx"
+)
+
+// P2PListeners restores the p2p listeners declared in the config once the
+// node starts. Listeners that fail to restore are logged and skipped.
+func P2PListeners(listeners []p2p.ListenerConfig) fx.Option {
+	return fx.Invoke(func(mctx helpers.MetricsCtx, lc fx.Lifecycle, p *p2p.P2P) {
+		ctx := helpers.LifecycleCtx(mctx, lc)
+		lc.Append(fx.Hook{
+			OnStart: func(context.Context) error {
+				for _, l := range listeners {
+					if _, err := p.Restore(ctx, l); err != nil {
+						logger.Errorf("failed to restore p2p listener %s to %s: %s", l.Protocol, l.TargetAddress, err)
+					}
+				}
+				return nil
+			},
+		})
+	})
+}
@@ -3,8 +3,10 @@ package node
 import (
 	"context"
 	"fmt"
+	"sync"
 	"time"
 
+	cid "github.com/ipfs/go-cid"
 	"github.com/ipfs/go-ipfs-pinner"
 	"github.com/ipfs/go-ipfs-provider"
 	q "github.com/ipfs/go-ipfs-provider/queue"
@@ -33,8 +35,91 @@ func SimpleProvider(mctx helpers.MetricsCtx, lc fx.Lifecycle, queue *q.Queue, rt
 
 // SimpleReprovider creates new reprovider
 func SimpleReprovider(reproviderInterval time.Duration) interface{} {
-	return func(mctx helpers.MetricsCtx, lc fx.Lifecycle, rt routing.Routing, keyProvider simple.KeyChanFunc) (provider.Reprovider, error) {
-		return simple.NewReprovider(helpers.LifecycleCtx(mctx, lc), reproviderInterval, rt, keyProvider), nil
+	return func(mctx helpers.MetricsCtx, lc fx.Lifecycle, rt routing.Routing, keyProvider simple.KeyChanFunc, tracker *ReprovideTracker) (provider.Reprovider, error) {
+		return simple.NewReprovider(helpers.LifecycleCtx(mctx, lc), reproviderInterval, rt, tracker.track(keyProvider)), nil
+	}
+}
+
+// ReprovideTracker records the progress of the reprovider, to tell when it is
+// stuck.
+type ReprovideTracker struct {
+	now func() time.Time
+
+	lk   sync.Mutex
+	stat ReprovideStat
+}
+
+// ReprovideStat is the progress of the reprovider.
+type ReprovideStat struct {
+	// Running is true while keys are being reprovided.
+	Running bool
+	// LastStarted is when the last run started.
+	LastStarted time.Time
+	// LastProgress is when the last key was handed to the reprovider.
+	LastProgress time.Time
+	// LastFinished is when the last complete run finished.
+	LastFinished time.Time
+	// Keys is the number of keys handed to the reprovider by the current
+	// run, or the last one.
+	Keys int
+}
+
+// NewReprovideTracker creates a ReprovideTracker.
+func NewReprovideTracker() *ReprovideTracker {
+	return &ReprovideTracker{now: time.Now}
+}
+
+// Stat returns the progress of the reprovider.
+func (t *ReprovideTracker) Stat() ReprovideStat {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+	return t.stat
+}
+
+// track returns a KeyChanFunc recording the progress of the reprovider as it
+// reads the keys of keyProvider.
+func (t *ReprovideTracker) track(keyProvider simple.KeyChanFunc) simple.KeyChanFunc {
+	return func(ctx context.Context) (<-chan cid.Cid, error) {
+		keys, err := keyProvider(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		t.lk.Lock()
+		now := t.now()
+		t.stat.Running = true
+		t.stat.LastStarted = now
+		t.stat.LastProgress = now
+		t.stat.Keys = 0
+		t.lk.Unlock()
+
+		out := make(chan cid.Cid)
+		go func() {
+			defer close(out)
+			complete := false
+			defer func() {
+				t.lk.Lock()
+				t.stat.Running = false
+				if complete {
+					t.stat.LastFinished = t.now()
+				}
+				t.lk.Unlock()
+			}()
+
+			for c := range keys {
+				select {
+				case out <- c:
+				case <-ctx.Done():
+					return
+				}
+				t.lk.Lock()
+				t.stat.LastProgress = t.now()
+				t.stat.Keys++
+				t.lk.Unlock()
+			}
+			complete = ctx.Err() == nil
+		}()
+		return out, nil
 	}
 }
 
@@ -114,6 +199,7 @@ func SimpleProviders(reprovideStrategy string, reprovideInterval string) fx.Opti
 	return fx.Options(
 		fx.Provide(ProviderQueue),
 		fx.Provide(SimpleProvider),
+		fx.Provide(NewReprovideTracker),
 		keyProvider,
 		fx.Provide(SimpleReprovider(reproviderInterval)),
 	)
@@ -0,0 +1,194 @@
+package core
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	config "github.com/ipfs/go-ipfs-config"
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+// ConfigReload is the outcome of ReloadConfig.
+type ConfigReload struct {
+	// Applied lists the keys changed since the last reload that were applied
+	// to the running node.
+	Applied []string
+	// NeedRestart lists the keys changed since the node started that take
+	// effect on the next start only.
+	NeedRestart []string
+}
+
+// configReloader holds the config the node was started with and the hooks
+// applying config changes to running subsystems.
+type configReloader struct {
+	lk      sync.Mutex
+	started map[string]interface{}
+	applied map[string]interface{}
+	hooks   []reloadHook
+}
+
+type reloadHook struct {
+	prefixes []string
+	apply    func(cfg *config.Config) error
+}
+
+// reloadableRepo is a repo whose config file can change while it is open.
+type reloadableRepo interface {
+	RawConfig() (map[string]interface{}, error)
+	ReloadConfig() (*config.Config, error)
+}
+
+// OnConfigReload registers apply to be called with the new config when a
+// reload changes a key under one of prefixes, such as "Gateway.HTTPHeaders".
+func (n *IpfsNode) OnConfigReload(apply func(cfg *config.Config) error, prefixes ...string) {
+	n.reloader.lk.Lock()
+	defer n.reloader.lk.Unlock()
+	n.reloader.hooks = append(n.reloader.hooks, reloadHook{prefixes: prefixes, apply: apply})
+}
+
+// initConfigReload records the config the node starts with, and registers
+// the hooks of the subsystems of the node.
+func (n *IpfsNode) initConfigReload() error {
+	rr, ok := n.Repo.(reloadableRepo)
+	if !ok {
+		return nil
+	}
+	raw, err := rr.RawConfig()
+	if err != nil {
+		return err
+	}
+	n.reloader.started = raw
+	n.reloader.applied = raw
+
+	// Read from the repo when used.
+	n.OnConfigReload(nil, "Bootstrap", "Pinning.RemoteServices")
+
+	if n.Peering != nil {
+		cfg, err := n.Repo.Config()
+		if err != nil {
+			return err
+		}
+		peers := cfg.Peering.Peers
+		n.OnConfigReload(func(cfg *config.Config) error {
+			peers = updatePeering(n, peers, cfg.Peering.Peers)
+			return nil
+		}, "Peering.Peers")
+	}
+	return nil
+}
+
+// updatePeering adds the new peers to the peering service, and removes the
+// old peers that are gone. It returns the new peers.
+func updatePeering(n *IpfsNode, before, after []peer.AddrInfo) []peer.AddrInfo {
+	kept := make(map[peer.ID]bool, len(after))
+	for _, ai := range after {
+		kept[ai.ID] = true
+		n.Peering.AddPeer(ai)
+	}
+	for _, ai := range before {
+		if !kept[ai.ID] {
+			n.Peering.RemovePeer(ai.ID)
+		}
+	}
+	return after
+}
+
+// ReloadConfig reads the config file again and applies the keys that changed
+// to the running subsystems that support it. The other keys take effect on
+// the next start.
+func (n *IpfsNode) ReloadConfig() (*ConfigReload, error) {
+	rr, ok := n.Repo.(reloadableRepo)
+	if !ok || n.reloader.started == nil {
+		return nil, errors.New("the repo does not support reloading its config")
+	}
+
+	n.reloader.lk.Lock()
+	defer n.reloader.lk.Unlock()
+
+	raw, err := rr.RawConfig()
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := rr.ReloadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	res := &ConfigReload{}
+	triggered := make([]bool, len(n.reloader.hooks))
+	for _, key := range changedKeys(n.reloader.applied, raw, "") {
+		matched := false
+		for i, h := range n.reloader.hooks {
+			if underAny(key, h.prefixes) {
+				matched = true
+				triggered[i] = true
+			}
+		}
+		if matched {
+			res.Applied = append(res.Applied, key)
+		}
+	}
+
+	for i, h := range n.reloader.hooks {
+		if !triggered[i] || h.apply == nil {
+			continue
+		}
+		if err := h.apply(cfg); err != nil {
+			return nil, err
+		}
+	}
+	n.reloader.applied = raw
+
+	for _, key := range changedKeys(n.reloader.started, raw, "") {
+		reloadable := false
+		for _, h := range n.reloader.hooks {
+			if underAny(key, h.prefixes) {
+				reloadable = true
+				break
+			}
+		}
+		if !reloadable {
+			res.NeedRestart = append(res.NeedRestart, key)
+		}
+	}
+	return res, nil
+}
+
+func underAny(key string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if key == p || strings.HasPrefix(key, p+".") || strings.HasPrefix(p, key+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// changedKeys returns the sorted paths of the values that differ between two
+// configs. Objects are compared key by key, other values as a whole.
+func changedKeys(before, after map[string]interface{}, prefix string) []string {
+	seen := make(map[string]bool, len(before)+len(after))
+	var keys []string
+	for _, m := range []map[string]interface{}{before, after} {
+		for k := range m {
+			if seen[k] {
+				continue
+			}
+			seen[k] = true
+
+			b, a := before[k], after[k]
+			bm, bIsMap := b.(map[string]interface{})
+			am, aIsMap := a.(map[string]interface{})
+			switch {
+			case (bIsMap || b == nil) && (aIsMap || a == nil) && (bIsMap || aIsMap):
+				keys = append(keys, changedKeys(bm, am, prefix+k+".")...)
+			case !reflect.DeepEqual(b, a):
+				keys = append(keys, prefix+k)
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
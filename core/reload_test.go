@@ -0,0 +1,122 @@
+package core
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/ipfs/go-ipfs/repo"
+
+	datastore "github.com/ipfs/go-datastore"
+	syncds "github.com/ipfs/go-datastore/sync"
+	config "github.com/ipfs/go-ipfs-config"
+)
+
+// reloadableMock is a repo whose config file can be edited.
+type reloadableMock struct {
+	repo.Mock
+	raw map[string]interface{}
+}
+
+func (m *reloadableMock) RawConfig() (map[string]interface{}, error) {
+	return m.raw, nil
+}
+
+func (m *reloadableMock) ReloadConfig() (*config.Config, error) {
+	cfg, err := config.FromMap(m.raw)
+	if err != nil {
+		return nil, err
+	}
+	m.C = *cfg
+	return cfg, nil
+}
+
+func TestReloadConfig(t *testing.T) {
+	r := &reloadableMock{
+		Mock: repo.Mock{
+			C: config.Config{Identity: testIdentity},
+			D: syncds.MutexWrap(datastore.NewMapDatastore()),
+		},
+	}
+	raw, err := config.ToMap(&r.C)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.raw = raw
+
+	n, err := NewNode(context.Background(), &BuildCfg{Repo: r})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer n.Close()
+
+	var headers map[string][]string
+	n.OnConfigReload(func(cfg *config.Config) error {
+		headers = cfg.Gateway.HTTPHeaders
+		return nil
+	}, "Gateway.HTTPHeaders")
+
+	edit := func(f func(cfg *config.Config)) {
+		cfg, err := config.FromMap(r.raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f(cfg)
+		if r.raw, err = config.ToMap(cfg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	edit(func(cfg *config.Config) {
+		cfg.Gateway.HTTPHeaders = map[string][]string{"X-Test": {"1"}}
+		cfg.Swarm.ConnMgr.HighWater = 1000
+	})
+	res, err := n.ReloadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(res.Applied, []string{"Gateway.HTTPHeaders.X-Test"}) {
+		t.Errorf("unexpected applied keys: %v", res.Applied)
+	}
+	if !reflect.DeepEqual(res.NeedRestart, []string{"Swarm.ConnMgr.HighWater"}) {
+		t.Errorf("unexpected keys needing a restart: %v", res.NeedRestart)
+	}
+	if headers["X-Test"] == nil {
+		t.Error("expected the hook to get the new headers")
+	}
+	if cfg, _ := n.Repo.Config(); cfg.Swarm.ConnMgr.HighWater != 1000 {
+		t.Error("expected the repo config to be reloaded")
+	}
+
+	// Applied keys are not reported again, keys needing a restart are until
+	// the daemon restarts.
+	headers = nil
+	res, err = n.ReloadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Applied) != 0 || len(res.NeedRestart) != 1 {
+		t.Errorf("unexpected outcome of a second reload: %+v", res)
+	}
+	if headers != nil {
+		t.Error("expected the hook not to run without changes")
+	}
+}
+
+func TestChangedKeys(t *testing.T) {
+	before := map[string]interface{}{
+		"A": map[string]interface{}{"B": "1", "C": []interface{}{"x"}},
+		"D": "same",
+		"E": "gone",
+	}
+	after := map[string]interface{}{
+		"A": map[string]interface{}{"B": "2", "C": []interface{}{"x", "y"}},
+		"D": "same",
+		"F": map[string]interface{}{"G": true},
+	}
+	keys := changedKeys(before, after, "")
+	expected := []string{"A.B", "A.C", "E", "F.G"}
+	if !reflect.DeepEqual(keys, expected) {
+		t.Errorf("expected %v, got %v", expected, keys)
+	}
+}
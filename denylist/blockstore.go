@@ -0,0 +1,40 @@
+package denylist
+
+import (
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+)
+
+// filteredBlockstore hides the blocked blocks of a blockstore.
+type filteredBlockstore struct {
+	blockstore.Blockstore
+	d *Denylist
+}
+
+// NewBlockstore returns a blockstore behaving as if the blocks d blocks were
+// missing from bs, for bitswap to not serve them.
+func NewBlockstore(bs blockstore.Blockstore, d *Denylist) blockstore.Blockstore {
+	return &filteredBlockstore{Blockstore: bs, d: d}
+}
+
+func (bs *filteredBlockstore) Has(c cid.Cid) (bool, error) {
+	if bs.d.BlocksCid(c) {
+		return false, nil
+	}
+	return bs.Blockstore.Has(c)
+}
+
+func (bs *filteredBlockstore) Get(c cid.Cid) (blocks.Block, error) {
+	if bs.d.BlocksCid(c) {
+		return nil, blockstore.ErrNotFound
+	}
+	return bs.Blockstore.Get(c)
+}
+
+func (bs *filteredBlockstore) GetSize(c cid.Cid) (int, error) {
+	if bs.d.BlocksCid(c) {
+		return -1, blockstore.ErrNotFound
+	}
+	return bs.Blockstore.GetSize(c)
+}
@@ -0,0 +1,153 @@
+package denylist
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	cid "github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+	path "github.com/ipfs/go-path"
+	"github.com/ipfs/go-path/resolver"
+	uio "github.com/ipfs/go-unixfs/io"
+)
+
+// filteredNodeGetter refuses to get the nodes a denylist blocks. The nodes
+// under the blocked subpaths of a node are blocked once that node was got, so
+// that walks from the top of a DAG, like exports and archives, skip them too.
+// Double-hashed subpaths can't be found that way, and are only enforced by
+// CheckPath.
+type filteredNodeGetter struct {
+	ng ipld.NodeGetter
+	d  *Denylist
+
+	lk      sync.Mutex
+	blocked map[string]struct{}
+}
+
+// NewNodeGetter returns a NodeGetter failing with ErrBlocked for the nodes d
+// blocks. It is meant for a single request: it remembers the subpaths it
+// found blocked.
+func NewNodeGetter(ng ipld.NodeGetter, d *Denylist) ipld.NodeGetter {
+	if d == nil {
+		return ng
+	}
+	return newFilteredNodeGetter(ng, d)
+}
+
+func newFilteredNodeGetter(ng ipld.NodeGetter, d *Denylist) *filteredNodeGetter {
+	return &filteredNodeGetter{ng: ng, d: d, blocked: make(map[string]struct{})}
+}
+
+// filteredDAGService is a DAGService reading through a filteredNodeGetter.
+type filteredDAGService struct {
+	ipld.DAGService
+	f *filteredNodeGetter
+}
+
+// NewDAGService returns a DAGService failing with ErrBlocked for the nodes d
+// blocks, like NewNodeGetter.
+func NewDAGService(ds ipld.DAGService, d *Denylist) ipld.DAGService {
+	if d == nil {
+		return ds
+	}
+	return &filteredDAGService{DAGService: ds, f: newFilteredNodeGetter(ds, d)}
+}
+
+func (ds *filteredDAGService) Get(ctx context.Context, c cid.Cid) (ipld.Node, error) {
+	return ds.f.Get(ctx, c)
+}
+
+func (ds *filteredDAGService) GetMany(ctx context.Context, cids []cid.Cid) <-chan *ipld.NodeOption {
+	return ds.f.GetMany(ctx, cids)
+}
+
+func (f *filteredNodeGetter) blocks(c cid.Cid) bool {
+	if f.d.BlocksCid(c) {
+		return true
+	}
+	f.lk.Lock()
+	defer f.lk.Unlock()
+	_, ok := f.blocked[string(c.Hash())]
+	return ok
+}
+
+func (f *filteredNodeGetter) Get(ctx context.Context, c cid.Cid) (ipld.Node, error) {
+	if f.d.Len() == 0 {
+		return f.ng.Get(ctx, c)
+	}
+	if f.blocks(c) {
+		return nil, fmt.Errorf("%s: %w", c, ErrBlocked)
+	}
+	nd, err := f.ng.Get(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	if err := f.blockSubpaths(ctx, c); err != nil {
+		return nil, err
+	}
+	return nd, nil
+}
+
+func (f *filteredNodeGetter) GetMany(ctx context.Context, cids []cid.Cid) <-chan *ipld.NodeOption {
+	if f.d.Len() == 0 {
+		return f.ng.GetMany(ctx, cids)
+	}
+
+	out := make(chan *ipld.NodeOption, len(cids))
+	allowed := make([]cid.Cid, 0, len(cids))
+	for _, c := range cids {
+		if f.blocks(c) {
+			out <- &ipld.NodeOption{Err: fmt.Errorf("%s: %w", c, ErrBlocked)}
+		} else {
+			allowed = append(allowed, c)
+		}
+	}
+
+	go func() {
+		defer close(out)
+		if len(allowed) == 0 {
+			return
+		}
+		for opt := range f.ng.GetMany(ctx, allowed) {
+			if opt.Err == nil {
+				if err := f.blockSubpaths(ctx, opt.Node.Cid()); err != nil {
+					opt = &ipld.NodeOption{Err: err}
+				}
+			}
+			select {
+			case out <- opt:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// blockSubpaths resolves the blocked subpaths under c, and blocks the nodes
+// they point at. Subpaths missing from c are ignored.
+func (f *filteredNodeGetter) blockSubpaths(ctx context.Context, c cid.Cid) error {
+	subpaths := f.d.subpaths(c)
+	if len(subpaths) == 0 {
+		return nil
+	}
+
+	r := &resolver.Resolver{
+		DAG:         f.ng,
+		ResolveOnce: uio.ResolveUnixfsOnce,
+	}
+	for _, sub := range subpaths {
+		target, _, err := r.ResolveToLastNode(ctx, path.FromString("/ipfs/"+c.String()+"/"+sub))
+		if _, ok := err.(resolver.ErrNoLink); ok {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		f.lk.Lock()
+		f.blocked[string(target.Hash())] = struct{}{}
+		f.lk.Unlock()
+	}
+	return nil
+}
@@ -0,0 +1,302 @@
+// Package denylist implements the lists of content a node refuses to serve.
+//
+// Denylists are text files, with one entry per line. Blank lines and lines
+// starting with # are ignored. An entry is one of:
+//
+//	/ipfs/<cid>             the CID, and every path under it
+//	/ipfs/<cid>/<subpath>   the subpath of the CID, and every path under it
+//	//<multihash>           a double-hashed entry
+//
+// Double-hashed entries do not reveal the content they block. See DoubleHash
+// for how they are computed.
+//
+// CheckPath enforces the entries on requested paths, and NewNodeGetter and
+// NewDAGService on the nodes read under them.
+package denylist
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	cid "github.com/ipfs/go-cid"
+	logging "github.com/ipfs/go-log"
+	path "github.com/ipfs/interface-go-ipfs-core/path"
+	mbase "github.com/multiformats/go-multibase"
+	mh "github.com/multiformats/go-multihash"
+)
+
+var log = logging.Logger("denylist")
+
+// DirName is the directory of the repo holding the denylists.
+const DirName = "denylists"
+
+// FileExtension is the extension of denylist files. Other files are ignored.
+const FileExtension = ".deny"
+
+// ErrBlocked is returned, wrapped, for content on a denylist.
+var ErrBlocked = errors.New("content is blocked by a denylist")
+
+// Resolver resolves paths, like the CoreAPI.
+type Resolver interface {
+	ResolvePath(ctx context.Context, p path.Path) (path.Resolved, error)
+}
+
+// entries are the entries of the denylists, indexed by multihash so that
+// both CID versions match.
+type entries struct {
+	cids   map[string]struct{}
+	paths  map[string][]string
+	hashes map[string]struct{}
+	count  int
+}
+
+// Denylist is the set of entries of the denylist files of a directory. The
+// methods of a nil Denylist block nothing.
+type Denylist struct {
+	dir string
+
+	lk      sync.RWMutex
+	entries *entries
+}
+
+// Load reads the denylist files of dir. A missing directory, or an empty dir,
+// gives an empty list.
+func Load(dir string) (*Denylist, error) {
+	d := &Denylist{dir: dir}
+	if _, err := d.Reload(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// Reload reads the denylist files again and returns the number of entries.
+// The list is left unchanged when a file is invalid.
+func (d *Denylist) Reload() (int, error) {
+	e := &entries{
+		cids:   make(map[string]struct{}),
+		paths:  make(map[string][]string),
+		hashes: make(map[string]struct{}),
+	}
+
+	if d.dir != "" {
+		names, err := listFiles(d.dir)
+		if err != nil {
+			return 0, err
+		}
+		for _, name := range names {
+			if err := e.readFile(name); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	d.lk.Lock()
+	d.entries = e
+	d.lk.Unlock()
+
+	log.Infof("loaded %d denylist entries from %s", e.count, d.dir)
+	return e.count, nil
+}
+
+// Len returns the number of entries.
+func (d *Denylist) Len() int {
+	if d == nil {
+		return 0
+	}
+	return d.current().count
+}
+
+func (d *Denylist) current() *entries {
+	d.lk.RLock()
+	defer d.lk.RUnlock()
+	return d.entries
+}
+
+// BlocksCid returns true if the content of c is blocked.
+func (d *Denylist) BlocksCid(c cid.Cid) bool {
+	if d == nil {
+		return false
+	}
+	e := d.current()
+	if e.count == 0 {
+		return false
+	}
+	if _, ok := e.cids[string(c.Hash())]; ok {
+		return true
+	}
+	return e.blocksHash(c, "")
+}
+
+// BlocksPath returns true if the path made of root and the given segments, or
+// any of its parents, is blocked.
+func (d *Denylist) BlocksPath(root cid.Cid, segments []string) bool {
+	if d == nil {
+		return false
+	}
+	if d.BlocksCid(root) {
+		return true
+	}
+
+	e := d.current()
+	subpaths := e.paths[string(root.Hash())]
+	for i := 1; i <= len(segments); i++ {
+		sub := strings.Join(segments[:i], "/")
+		for _, p := range subpaths {
+			if p == sub {
+				return true
+			}
+		}
+		if e.blocksHash(root, sub) {
+			return true
+		}
+	}
+	return false
+}
+
+// subpaths returns the blocked subpaths under c, double-hashed entries
+// excluded.
+func (d *Denylist) subpaths(c cid.Cid) []string {
+	if d == nil {
+		return nil
+	}
+	return d.current().paths[string(c.Hash())]
+}
+
+// CheckPath returns an error wrapping ErrBlocked if p goes through blocked
+// content: if the root of p, or the content of any of its subpaths, is
+// blocked, or has the rest of p blocked under it.
+func (d *Denylist) CheckPath(ctx context.Context, r Resolver, p path.Path) error {
+	if d.Len() == 0 {
+		return nil
+	}
+
+	var segments []string
+	for _, s := range strings.Split(p.String(), "/") {
+		if s != "" {
+			segments = append(segments, s)
+		}
+	}
+	if len(segments) < 2 {
+		return nil
+	}
+
+	// Every prefix is resolved from the root again, paths are short.
+	for i := 2; i <= len(segments); i++ {
+		resolved, err := r.ResolvePath(ctx, path.New("/"+strings.Join(segments[:i], "/")))
+		if err != nil {
+			return err
+		}
+		if d.BlocksPath(resolved.Cid(), segments[i:]) {
+			return fmt.Errorf("%s: %w", p, ErrBlocked)
+		}
+	}
+	return nil
+}
+
+func (e *entries) blocksHash(c cid.Cid, subpath string) bool {
+	if len(e.hashes) == 0 {
+		return false
+	}
+	h, err := DoubleHash(c, subpath)
+	if err != nil {
+		return false
+	}
+	_, ok := e.hashes[string(h)]
+	return ok
+}
+
+// DoubleHash returns the multihash of a double-hashed entry blocking subpath
+// under c, or c itself when subpath is empty: the sha2-256 hash of the CIDv1
+// of c in base32, followed by "/" and subpath.
+func DoubleHash(c cid.Cid, subpath string) (mh.Multihash, error) {
+	v1, err := cid.NewCidV1(c.Type(), c.Hash()).StringOfBase(mbase.Base32)
+	if err != nil {
+		return nil, err
+	}
+	return mh.Sum([]byte(v1+"/"+strings.Trim(subpath, "/")), mh.SHA2_256, -1)
+}
+
+func listFiles(dir string) ([]string, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, fi := range infos {
+		if fi.IsDir() || filepath.Ext(fi.Name()) != FileExtension {
+			continue
+		}
+		names = append(names, filepath.Join(dir, fi.Name()))
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (e *entries) readFile(name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := e.read(f); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
+
+func (e *entries) read(r io.Reader) error {
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := e.add(line); err != nil {
+			return fmt.Errorf("line %d: %w", n, err)
+		}
+	}
+	return s.Err()
+}
+
+func (e *entries) add(entry string) error {
+	if strings.HasPrefix(entry, "//") {
+		h, err := mh.FromB58String(entry[2:])
+		if err != nil {
+			return fmt.Errorf("invalid double-hashed entry %q: %w", entry, err)
+		}
+		e.hashes[string(h)] = struct{}{}
+		e.count++
+		return nil
+	}
+
+	if !strings.HasPrefix(entry, "/ipfs/") {
+		return fmt.Errorf("invalid entry %q, expected /ipfs/<cid>[/<subpath>] or //<multihash>", entry)
+	}
+	parts := strings.SplitN(strings.TrimPrefix(entry, "/ipfs/"), "/", 2)
+	c, err := cid.Decode(parts[0])
+	if err != nil {
+		return fmt.Errorf("invalid CID in entry %q: %w", entry, err)
+	}
+
+	k := string(c.Hash())
+	if len(parts) == 2 && strings.Trim(parts[1], "/") != "" {
+		e.paths[k] = append(e.paths[k], strings.Trim(parts[1], "/"))
+	} else {
+		e.cids[k] = struct{}{}
+	}
+	e.count++
+	return nil
+}
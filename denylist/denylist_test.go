@@ -0,0 +1,199 @@
+package denylist
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	cid "github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+	dag "github.com/ipfs/go-merkledag"
+	mdtest "github.com/ipfs/go-merkledag/test"
+	ft "github.com/ipfs/go-unixfs"
+	mh "github.com/multiformats/go-multihash"
+)
+
+func testCid(t *testing.T, data string) cid.Cid {
+	h, err := mh.Sum([]byte(data), mh.SHA2_256, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cid.NewCidV1(cid.DagProtobuf, h)
+}
+
+func TestBlocks(t *testing.T) {
+	blocked, sub, hashed, other := testCid(t, "blocked"), testCid(t, "sub"), testCid(t, "hashed"), testCid(t, "other")
+
+	h, err := DoubleHash(hashed, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "denylist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	list := strings.Join([]string{
+		"# takedowns",
+		"/ipfs/" + blocked.String(),
+		"/ipfs/" + sub.String() + "/a/b/",
+		"",
+		"//" + h.B58String(),
+	}, "\n")
+	if err := ioutil.WriteFile(filepath.Join(dir, "takedowns.deny"), []byte(list), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// files without the extension are ignored
+	if err := ioutil.WriteFile(filepath.Join(dir, "README"), []byte("not an entry"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Len() != 3 {
+		t.Fatalf("expected 3 entries, got %d", d.Len())
+	}
+
+	// CIDv0 and CIDv1 of the same content are both blocked
+	if !d.BlocksCid(blocked) || !d.BlocksCid(cid.NewCidV0(blocked.Hash())) {
+		t.Error("expected the CID to be blocked")
+	}
+	if d.BlocksCid(other) || d.BlocksCid(sub) || d.BlocksCid(hashed) {
+		t.Error("unexpected blocked CID")
+	}
+
+	for _, test := range []struct {
+		root    cid.Cid
+		path    string
+		blocked bool
+	}{
+		{blocked, "x/y", true},
+		{sub, "a/b", true},
+		{sub, "a/b/c", true},
+		{sub, "a", false},
+		{sub, "a/bb", false},
+		{hashed, "secret", true},
+		{hashed, "secret/file", true},
+		{hashed, "public", false},
+		{other, "a/b", false},
+	} {
+		if got := d.BlocksPath(test.root, strings.Split(test.path, "/")); got != test.blocked {
+			t.Errorf("BlocksPath(%s, %s) = %v, want %v", test.root, test.path, got, test.blocked)
+		}
+	}
+
+	// Invalid lists leave the entries unchanged
+	if err := ioutil.WriteFile(filepath.Join(dir, "bad.deny"), []byte("/ipns/example.com"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Reload(); err == nil {
+		t.Fatal("expected an invalid entry to be rejected")
+	}
+	if !d.BlocksCid(blocked) {
+		t.Error("expected the entries to be kept")
+	}
+
+	if err := os.Remove(filepath.Join(dir, "takedowns.deny")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(dir, "bad.deny")); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := d.Reload(); err != nil || n != 0 {
+		t.Fatalf("expected no entries after the reload, got %d %v", n, err)
+	}
+	if d.BlocksCid(blocked) {
+		t.Error("expected the entry to be gone after the reload")
+	}
+}
+
+func TestNilDenylist(t *testing.T) {
+	var d *Denylist
+	c := testCid(t, "a")
+	if d.Len() != 0 || d.BlocksCid(c) || d.BlocksPath(c, []string{"b"}) {
+		t.Fatal("a nil denylist must not block anything")
+	}
+}
+
+func TestNodeGetter(t *testing.T) {
+	ctx := context.Background()
+	ds := mdtest.Mock()
+
+	add := func(nd *dag.ProtoNode, links map[string]*dag.ProtoNode) *dag.ProtoNode {
+		for name, l := range links {
+			if err := nd.AddNodeLink(name, l); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := ds.Add(ctx, nd); err != nil {
+			t.Fatal(err)
+		}
+		return nd
+	}
+	secret := add(dag.NodeWithData(ft.FilePBData([]byte("secret"), 6)), nil)
+	public := add(dag.NodeWithData(ft.FilePBData([]byte("public"), 6)), nil)
+	blocked := add(dag.NodeWithData(ft.FilePBData([]byte("blocked"), 7)), nil)
+	dir := add(dag.NodeWithData(ft.FolderPBData()), map[string]*dag.ProtoNode{"secret": secret, "public": public})
+	root := add(dag.NodeWithData(ft.FolderPBData()), map[string]*dag.ProtoNode{"dir": dir, "blocked": blocked})
+
+	list, err := ioutil.TempDir("", "denylist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(list)
+	entries := "/ipfs/" + root.Cid().String() + "/dir/secret\n" +
+		"/ipfs/" + blocked.Cid().String() + "\n"
+	if err := ioutil.WriteFile(filepath.Join(list, "test.deny"), []byte(entries), 0644); err != nil {
+		t.Fatal(err)
+	}
+	d, err := Load(list)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ng := NewNodeGetter(ds, d)
+	get := func(nd ipld.Node) error {
+		_, err := ng.Get(ctx, nd.Cid())
+		return err
+	}
+
+	if err := get(blocked); !errors.Is(err, ErrBlocked) {
+		t.Fatalf("expected the blocked CID to be refused, got %v", err)
+	}
+	// Subpaths are blocked once their root was read
+	for _, nd := range []ipld.Node{root, dir, public} {
+		if err := get(nd); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := get(secret); !errors.Is(err, ErrBlocked) {
+		t.Fatalf("expected the blocked subpath to be refused, got %v", err)
+	}
+
+	got, refused := 0, 0
+	for opt := range NewDAGService(ds, d).GetMany(ctx, []cid.Cid{root.Cid(), blocked.Cid(), public.Cid()}) {
+		switch {
+		case opt.Err == nil:
+			got++
+		case errors.Is(opt.Err, ErrBlocked):
+			refused++
+		default:
+			t.Fatal(opt.Err)
+		}
+	}
+	if got != 2 || refused != 1 {
+		t.Fatalf("expected 2 nodes and 1 refused, got %d and %d", got, refused)
+	}
+
+	if NewNodeGetter(ds, nil) != ipld.NodeGetter(ds) {
+		t.Fatal("a nil denylist must not wrap the DAG")
+	}
+}
@@ -0,0 +1,214 @@
+package gc
+
+import (
+	"context"
+	"sync"
+
+	bserv "github.com/ipfs/go-blockservice"
+	cid "github.com/ipfs/go-cid"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	offline "github.com/ipfs/go-ipfs-exchange-offline"
+	pin "github.com/ipfs/go-ipfs-pinner"
+	ipld "github.com/ipfs/go-ipld-format"
+	dag "github.com/ipfs/go-merkledag"
+)
+
+// RootKind tells why a GC root is kept.
+type RootKind string
+
+const (
+	// RecursiveRoot is a recursive pin; its whole DAG is kept.
+	RecursiveRoot RootKind = "recursive"
+	// DirectRoot is a direct pin; only the block itself is kept.
+	DirectRoot RootKind = "direct"
+	// InternalRoot is a block used internally by the pinner.
+	InternalRoot RootKind = "internal"
+	// BestEffortRoot is a best-effort root such as the MFS root; the parts
+	// of its DAG present locally are kept.
+	BestEffortRoot RootKind = "best-effort"
+)
+
+// Reachability holds the totals of the blocks kept by a single GC root.
+// Blocks reachable from several roots are only counted for the first root
+// that marks them, in the order ColoredSet walks the roots: recursive pins,
+// best-effort roots, direct pins, then internal pins.
+type Reachability struct {
+	Root   cid.Cid
+	Kind   RootKind
+	Blocks uint64 // number of local blocks first marked from Root
+	Size   uint64 // cumulative size of those blocks in bytes
+}
+
+// DryRun reports what GC would remove without removing anything. It first
+// reports the reachability totals of every GC root, then every block that
+// is not in the ColoredSet, as a Result with KeyRemoved and Size set.
+//
+// DryRun does not take the GC lock, so blocks added concurrently may be
+// reported as removable.
+func DryRun(ctx context.Context, bs bstore.Blockstore, pn pin.Pinner, bestEffortRoots []cid.Cid) <-chan Result {
+	return explain(ctx, bs, pn, bestEffortRoots, cid.Undef)
+}
+
+// Explain reports why the given block would be kept by GC: one Result per
+// GC root that reaches it, with the reachability totals of that root. No
+// Root result is reported if the block would be removed.
+func Explain(ctx context.Context, bs bstore.Blockstore, pn pin.Pinner, bestEffortRoots []cid.Cid, target cid.Cid) <-chan Result {
+	return explain(ctx, bs, pn, bestEffortRoots, target)
+}
+
+func explain(ctx context.Context, bs bstore.Blockstore, pn pin.Pinner, bestEffortRoots []cid.Cid, target cid.Cid) <-chan Result {
+	ctx, cancel := context.WithCancel(ctx)
+
+	bsrv := bserv.New(bs, offline.Exchange(bs))
+	ds := dag.NewDAGService(bsrv)
+
+	output := make(chan Result, 128)
+
+	go func() {
+		defer cancel()
+		defer close(output)
+
+		emit := func(res Result) bool {
+			select {
+			case output <- res:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		a := &attribution{bs: bs, target: target}
+		if target.Defined() {
+			a.parents = map[cid.Cid][]cid.Cid{}
+		}
+
+		gcs, err := coloredSet(ctx, pn, ds, bestEffortRoots, output, a)
+		if err != nil {
+			emit(Result{Error: err})
+			return
+		}
+		if a.err != nil {
+			emit(Result{Error: a.err})
+			return
+		}
+
+		if target.Defined() {
+			if !gcs.Has(target) {
+				return
+			}
+			for _, r := range a.keeping() {
+				if !emit(Result{Root: r}) {
+					return
+				}
+			}
+			return
+		}
+
+		for _, r := range a.roots {
+			if !emit(Result{Root: r}) {
+				return
+			}
+		}
+
+		keychan, err := bs.AllKeysChan(ctx)
+		if err != nil {
+			emit(Result{Error: err})
+			return
+		}
+
+		for k := range keychan {
+			if gcs.Has(k) {
+				continue
+			}
+			size, err := bs.GetSize(k)
+			if err != nil {
+				if !emit(Result{Error: err}) {
+					return
+				}
+				continue
+			}
+			if !emit(Result{KeyRemoved: k, Size: uint64(size)}) {
+				return
+			}
+		}
+	}()
+
+	return output
+}
+
+// attribution counts the blocks marked from each GC root while ColoredSet
+// is computed. When explaining a target, it also records the links walked,
+// to find the roots the target is reachable from afterwards.
+type attribution struct {
+	bs     bstore.Blockstore
+	target cid.Cid
+
+	mu    sync.Mutex
+	roots []*Reachability
+	err   error
+	// parents maps blocks to the blocks linking to them. It is nil
+	// without target.
+	parents map[cid.Cid][]cid.Cid
+}
+
+func (a *attribution) root(c cid.Cid, kind RootKind) {
+	a.mu.Lock()
+	a.roots = append(a.roots, &Reachability{Root: c, Kind: kind})
+	a.mu.Unlock()
+}
+
+func (a *attribution) marked(c cid.Cid) {
+	size, err := a.bs.GetSize(c)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err == bstore.ErrNotFound {
+		// Missing parts of best-effort roots are not kept.
+		return
+	}
+	if err != nil {
+		if a.err == nil {
+			a.err = err
+		}
+		return
+	}
+	r := a.roots[len(a.roots)-1]
+	r.Blocks++
+	r.Size += uint64(size)
+}
+
+func (a *attribution) links(c cid.Cid, links []*ipld.Link) {
+	if a.parents == nil {
+		return
+	}
+	a.mu.Lock()
+	for _, l := range links {
+		a.parents[l.Cid] = append(a.parents[l.Cid], c)
+	}
+	a.mu.Unlock()
+}
+
+// keeping returns the roots the target is reachable from, following the
+// recorded links back from it. Direct pins only keep themselves.
+func (a *attribution) keeping() []*Reachability {
+	ancestors := cid.NewSet()
+	ancestors.Add(a.target)
+	queue := []cid.Cid{a.target}
+	for len(queue) > 0 {
+		c := queue[0]
+		queue = queue[1:]
+		for _, p := range a.parents[c] {
+			if ancestors.Visit(p) {
+				queue = append(queue, p)
+			}
+		}
+	}
+
+	var keeping []*Reachability
+	for _, r := range a.roots {
+		if r.Root.Equals(a.target) || (r.Kind != DirectRoot && ancestors.Has(r.Root)) {
+			keeping = append(keeping, r)
+		}
+	}
+	return keeping
+}
@@ -0,0 +1,194 @@
+package gc
+
+import (
+	"context"
+	"testing"
+
+	cid "github.com/ipfs/go-cid"
+	dag "github.com/ipfs/go-merkledag"
+)
+
+// addNode adds a node linking to the given children.
+func (r *testRepo) addNode(t *testing.T, data string, children ...*dag.ProtoNode) *dag.ProtoNode {
+	nd := dag.NodeWithData([]byte(data))
+	for _, c := range children {
+		if err := nd.AddNodeLink(c.Cid().String(), c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.dserv.Add(context.Background(), nd); err != nil {
+		t.Fatal(err)
+	}
+	return nd
+}
+
+func (r *testRepo) pinDirect(t *testing.T, nd *dag.ProtoNode) {
+	ctx := context.Background()
+	if err := r.pinner.Pin(ctx, nd, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.pinner.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// explainTree builds:
+//
+//	pinned (recursive) -> shared, leaf
+//	mfs (best-effort)  -> shared, mfsLeaf
+//	direct (direct)    -> leaf
+//
+// plus garbage linking to shared.
+type explainTree struct {
+	pinned, mfs, direct, shared, leaf, mfsLeaf, garbage *dag.ProtoNode
+}
+
+func newExplainTree(t *testing.T, r *testRepo) *explainTree {
+	e := &explainTree{}
+	e.shared = r.addNode(t, "shared")
+	e.leaf = r.addNode(t, "leaf")
+	e.mfsLeaf = r.addNode(t, "mfs leaf")
+	e.pinned = r.addNode(t, "pinned", e.shared, e.leaf)
+	e.mfs = r.addNode(t, "mfs", e.shared, e.mfsLeaf)
+	e.direct = r.addNode(t, "direct", e.leaf)
+	e.garbage = r.addNode(t, "garbage", e.shared)
+
+	r.pin(t, e.pinned)
+	r.pinDirect(t, e.direct)
+	return e
+}
+
+func (e *explainTree) roots() []cid.Cid {
+	return []cid.Cid{e.mfs.Cid()}
+}
+
+func TestDryRunMatchesGC(t *testing.T) {
+	r := newTestRepo(t)
+	ctx := context.Background()
+
+	e := newExplainTree(t, r)
+	garbage := r.addGarbage(t, 3)
+
+	wouldRemove := cid.NewSet()
+	var size uint64
+	for res := range DryRun(ctx, r.bs, r.pinner, e.roots()) {
+		if res.Error != nil {
+			t.Fatal(res.Error)
+		}
+		if res.Root != nil {
+			continue
+		}
+		wouldRemove.Add(res.KeyRemoved)
+		size += res.Size
+	}
+	if wouldRemove.Len() != len(garbage)+1 {
+		t.Fatalf("expected %d blocks to be removed, got %d", len(garbage)+1, wouldRemove.Len())
+	}
+	expectedSize := uint64(len(e.garbage.RawData()))
+	for _, b := range garbage {
+		expectedSize += uint64(len(b.RawData()))
+	}
+	if size != expectedSize {
+		t.Fatalf("expected %d bytes to be freed, got %d", expectedSize, size)
+	}
+
+	removed := collect(t, GC(ctx, r.bs, r.dstore, r.pinner, e.roots()))
+	if removed.Len() != wouldRemove.Len() {
+		t.Fatalf("dry run reported %d blocks, GC removed %d", wouldRemove.Len(), removed.Len())
+	}
+	err := removed.ForEach(func(c cid.Cid) error {
+		if !wouldRemove.Has(c) {
+			t.Fatalf("GC removed %s, not reported by the dry run", c)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDryRunRoots(t *testing.T) {
+	r := newTestRepo(t)
+	ctx := context.Background()
+
+	e := newExplainTree(t, r)
+
+	roots := map[RootKind]*Reachability{}
+	for res := range DryRun(ctx, r.bs, r.pinner, e.roots()) {
+		if res.Error != nil {
+			t.Fatal(res.Error)
+		}
+		if res.Root != nil {
+			roots[res.Root.Kind] = res.Root
+		}
+	}
+
+	size := func(nds ...*dag.ProtoNode) uint64 {
+		var s uint64
+		for _, nd := range nds {
+			s += uint64(len(nd.RawData()))
+		}
+		return s
+	}
+	expected := []Reachability{
+		{Root: e.pinned.Cid(), Kind: RecursiveRoot, Blocks: 3, Size: size(e.pinned, e.shared, e.leaf)},
+		// shared is counted for the recursive pin only.
+		{Root: e.mfs.Cid(), Kind: BestEffortRoot, Blocks: 2, Size: size(e.mfs, e.mfsLeaf)},
+		{Root: e.direct.Cid(), Kind: DirectRoot, Blocks: 1, Size: size(e.direct)},
+	}
+	for _, exp := range expected {
+		got, ok := roots[exp.Kind]
+		if !ok {
+			t.Fatalf("no %s root reported", exp.Kind)
+		}
+		if !got.Root.Equals(exp.Root) || got.Blocks != exp.Blocks || got.Size != exp.Size {
+			t.Fatalf("expected %s root %s with %d blocks, %d bytes, got %s with %d blocks, %d bytes",
+				exp.Kind, exp.Root, exp.Blocks, exp.Size, got.Root, got.Blocks, got.Size)
+		}
+	}
+}
+
+func TestExplain(t *testing.T) {
+	r := newTestRepo(t)
+	ctx := context.Background()
+
+	e := newExplainTree(t, r)
+
+	explain := func(target cid.Cid) []cid.Cid {
+		var roots []cid.Cid
+		for res := range Explain(ctx, r.bs, r.pinner, e.roots(), target) {
+			if res.Error != nil {
+				t.Fatal(res.Error)
+			}
+			if res.Root == nil {
+				t.Fatalf("unexpected result %v", res)
+			}
+			roots = append(roots, res.Root.Root)
+		}
+		return roots
+	}
+
+	for _, tc := range []struct {
+		name   string
+		target cid.Cid
+		roots  []cid.Cid
+	}{
+		{"shared", e.shared.Cid(), []cid.Cid{e.pinned.Cid(), e.mfs.Cid()}},
+		{"recursive root", e.pinned.Cid(), []cid.Cid{e.pinned.Cid()}},
+		{"best-effort leaf", e.mfsLeaf.Cid(), []cid.Cid{e.mfs.Cid()}},
+		// direct pins don't keep their children
+		{"child of direct pin", e.leaf.Cid(), []cid.Cid{e.pinned.Cid()}},
+		{"direct root", e.direct.Cid(), []cid.Cid{e.direct.Cid()}},
+		{"garbage", e.garbage.Cid(), nil},
+	} {
+		roots := explain(tc.target)
+		if len(roots) != len(tc.roots) {
+			t.Fatalf("%s: expected roots %s, got %s", tc.name, tc.roots, roots)
+		}
+		for i := range roots {
+			if !roots[i].Equals(tc.roots[i]) {
+				t.Fatalf("%s: expected roots %s, got %s", tc.name, tc.roots, roots)
+			}
+		}
+	}
+}
@@ -23,9 +23,17 @@ var log = logging.Logger("gc")
 
 // Result represents an incremental output from a garbage collection
 // run.  It contains either an error, or the cid of a removed object.
+// Dry runs and explanations may also report the reachability of a GC
+// root.
 type Result struct {
 	KeyRemoved cid.Cid
 	Error      error
+
+	// Size is the size in bytes of KeyRemoved. It is only set by DryRun
+	// and Evict.
+	Size uint64
+	// Root is only set by DryRun and Explain.
+	Root *Reachability
 }
 
 // GC performs a mark and sweep garbage collection of the blocks in the blockstore
@@ -132,6 +140,12 @@ func GC(ctx context.Context, bs bstore.GCBlockstore, dstor dstore.Datastore, pn
 // adds them to the given cid.Set, using the provided dag.GetLinks function
 // to walk the tree.
 func Descendants(ctx context.Context, getLinks dag.GetLinks, set *cid.Set, roots []cid.Cid) error {
+	return descendants(ctx, getLinks, set.Visit, roots)
+}
+
+// descendants is like Descendants but marks the blocks with visit, which
+// returns false for blocks already marked.
+func descendants(ctx context.Context, getLinks dag.GetLinks, visit func(cid.Cid) bool, roots []cid.Cid) error {
 	verifyGetLinks := func(ctx context.Context, c cid.Cid) ([]*ipld.Link, error) {
 		err := verifcid.ValidateCid(c)
 		if err != nil {
@@ -154,7 +168,7 @@ func Descendants(ctx context.Context, getLinks dag.GetLinks, set *cid.Set, roots
 
 	for _, c := range roots {
 		// Walk recursively walks the dag and adds the keys to the given set
-		err := dag.Walk(ctx, verifyGetLinks, c, set.Visit, dag.Concurrent())
+		err := dag.Walk(ctx, verifyGetLinks, c, visit, dag.Concurrent())
 
 		if err != nil {
 			err = verboseCidError(err)
@@ -165,13 +179,100 @@ func Descendants(ctx context.Context, getLinks dag.GetLinks, set *cid.Set, roots
 	return nil
 }
 
+// ExpiringPinner is a pin.Pinner whose pins may expire. Expired pins that
+// were not removed yet are treated as unpinned by ColoredSet.
+type ExpiringPinner interface {
+	pin.Pinner
+
+	// ExpiredKeys returns the recursive and direct pins that have expired.
+	ExpiredKeys(ctx context.Context) ([]cid.Cid, error)
+}
+
+// pinnedKeys returns the recursive and direct keys of pn, leaving out expired
+// pins when pn is an ExpiringPinner.
+func pinnedKeys(ctx context.Context, pn pin.Pinner) (rkeys, dkeys []cid.Cid, err error) {
+	rkeys, err = pn.RecursiveKeys(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	dkeys, err = pn.DirectKeys(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	epn, ok := pn.(ExpiringPinner)
+	if !ok {
+		return rkeys, dkeys, nil
+	}
+	expired, err := epn.ExpiredKeys(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(expired) == 0 {
+		return rkeys, dkeys, nil
+	}
+	skip := cid.NewSet()
+	for _, k := range expired {
+		skip.Add(k)
+	}
+	filter := func(keys []cid.Cid) []cid.Cid {
+		live := make([]cid.Cid, 0, len(keys))
+		for _, k := range keys {
+			if !skip.Has(k) {
+				live = append(live, k)
+			}
+		}
+		return live
+	}
+	return filter(rkeys), filter(dkeys), nil
+}
+
 // ColoredSet computes the set of nodes in the graph that are pinned by the
-// pins in the given pinner.
+// pins in the given pinner. Expired pins of an ExpiringPinner are left out.
 func ColoredSet(ctx context.Context, pn pin.Pinner, ng ipld.NodeGetter, bestEffortRoots []cid.Cid, output chan<- Result) (*cid.Set, error) {
+	return coloredSet(ctx, pn, ng, bestEffortRoots, output, nil)
+}
+
+// markTracer observes how coloredSet marks blocks. The roots are walked one
+// after the other, and root is called before each of them.
+type markTracer interface {
+	root(c cid.Cid, kind RootKind)
+	// marked is called once per block, when it is first marked.
+	marked(c cid.Cid)
+	// links is called with the links of every walked block. It may be
+	// called concurrently.
+	links(c cid.Cid, links []*ipld.Link)
+}
+
+// coloredSet computes the ColoredSet, reporting to t if it isn't nil.
+func coloredSet(ctx context.Context, pn pin.Pinner, ng ipld.NodeGetter, bestEffortRoots []cid.Cid, output chan<- Result, t markTracer) (*cid.Set, error) {
 	// KeySet currently implemented in memory, in the future, may be bloom filter or
 	// disk backed to conserve memory.
 	errors := false
 	gcs := cid.NewSet()
+	visit := gcs.Visit
+	if t != nil {
+		visit = func(c cid.Cid) bool {
+			if !gcs.Visit(c) {
+				return false
+			}
+			t.marked(c)
+			return true
+		}
+	}
+	walk := func(getLinks dag.GetLinks, kind RootKind, roots []cid.Cid) error {
+		if t == nil {
+			return descendants(ctx, getLinks, visit, roots)
+		}
+		for _, c := range roots {
+			t.root(c, kind)
+			if err := descendants(ctx, getLinks, visit, []cid.Cid{c}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
 	getLinks := func(ctx context.Context, cid cid.Cid) ([]*ipld.Link, error) {
 		links, err := ipld.GetLinks(ctx, ng, cid)
 		if err != nil {
@@ -182,13 +283,16 @@ func ColoredSet(ctx context.Context, pn pin.Pinner, ng ipld.NodeGetter, bestEffo
 				return nil, ctx.Err()
 			}
 		}
+		if t != nil {
+			t.links(cid, links)
+		}
 		return links, nil
 	}
-	rkeys, err := pn.RecursiveKeys(ctx)
+	rkeys, dkeys, err := pinnedKeys(ctx, pn)
 	if err != nil {
 		return nil, err
 	}
-	err = Descendants(ctx, getLinks, gcs, rkeys)
+	err = walk(getLinks, RecursiveRoot, rkeys)
 	if err != nil {
 		errors = true
 		select {
@@ -208,9 +312,12 @@ func ColoredSet(ctx context.Context, pn pin.Pinner, ng ipld.NodeGetter, bestEffo
 				return nil, ctx.Err()
 			}
 		}
+		if t != nil {
+			t.links(cid, links)
+		}
 		return links, nil
 	}
-	err = Descendants(ctx, bestEffortGetLinks, gcs, bestEffortRoots)
+	err = walk(bestEffortGetLinks, BestEffortRoot, bestEffortRoots)
 	if err != nil {
 		errors = true
 		select {
@@ -220,19 +327,18 @@ func ColoredSet(ctx context.Context, pn pin.Pinner, ng ipld.NodeGetter, bestEffo
 		}
 	}
 
-	dkeys, err := pn.DirectKeys(ctx)
-	if err != nil {
-		return nil, err
-	}
 	for _, k := range dkeys {
-		gcs.Add(k)
+		if t != nil {
+			t.root(k, DirectRoot)
+		}
+		visit(k)
 	}
 
 	ikeys, err := pn.InternalPins(ctx)
 	if err != nil {
 		return nil, err
 	}
-	err = Descendants(ctx, getLinks, gcs, ikeys)
+	err = walk(getLinks, InternalRoot, ikeys)
 	if err != nil {
 		errors = true
 		select {
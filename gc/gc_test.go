@@ -0,0 +1,53 @@
+package gc
+
+import (
+	"context"
+	"testing"
+
+	cid "github.com/ipfs/go-cid"
+	pin "github.com/ipfs/go-ipfs-pinner"
+)
+
+// expiringPinner is an ExpiringPinner with a fixed list of expired pins.
+type expiringPinner struct {
+	pin.Pinner
+	expired []cid.Cid
+}
+
+func (p *expiringPinner) ExpiredKeys(ctx context.Context) ([]cid.Cid, error) {
+	return p.expired, nil
+}
+
+func TestColoredSetExcludesExpiredPins(t *testing.T) {
+	r := newTestRepo(t)
+	ctx := context.Background()
+
+	live, liveLeaves := r.addDAG(t, "live", 2)
+	r.pin(t, live)
+	expired, expiredLeaves := r.addDAG(t, "expired", 2)
+	r.pin(t, expired)
+	direct := r.addNode(t, "expired direct")
+	r.pinDirect(t, direct)
+
+	pn := &expiringPinner{Pinner: r.pinner, expired: []cid.Cid{expired.Cid(), direct.Cid()}}
+
+	gcs, err := ColoredSet(ctx, pn, r.dserv, nil, make(chan Result, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range append(liveLeaves, live.Cid()) {
+		if !gcs.Has(c) {
+			t.Fatalf("live pinned block %s not marked", c)
+		}
+	}
+	for _, c := range append(expiredLeaves, expired.Cid(), direct.Cid()) {
+		if gcs.Has(c) {
+			t.Fatalf("block %s of an expired pin marked", c)
+		}
+	}
+
+	removed := collect(t, GC(ctx, r.bs, r.dstore, pn, nil))
+	if removed.Len() != len(expiredLeaves)+2 {
+		t.Fatalf("expected the %d blocks of expired pins removed, got %d", len(expiredLeaves)+2, removed.Len())
+	}
+}
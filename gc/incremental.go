@@ -0,0 +1,299 @@
+package gc
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	blocks "github.com/ipfs/go-block-format"
+	bserv "github.com/ipfs/go-blockservice"
+	cid "github.com/ipfs/go-cid"
+	dstore "github.com/ipfs/go-datastore"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	offline "github.com/ipfs/go-ipfs-exchange-offline"
+	pin "github.com/ipfs/go-ipfs-pinner"
+	dag "github.com/ipfs/go-merkledag"
+)
+
+// DefaultBatchSize is the number of blocks removed per GC lock acquisition
+// when no batch size is given to IncrementalGC.
+const DefaultBatchSize = 256
+
+// ErrNoWriteBarrier is returned when an incremental collection is started
+// without a WriteBarrier.
+var ErrNoWriteBarrier = errors.New("incremental garbage collection needs a write barrier")
+
+// ErrCollectionInProgress is returned when an incremental collection is
+// started while another one is still running with the same WriteBarrier.
+var ErrCollectionInProgress = errors.New("incremental garbage collection already in progress")
+
+// WriteBarrier records every block written to or read from the blockstores
+// it wraps while an incremental collection is running. Recorded blocks are
+// never removed by that collection. Reads are recorded because pinning
+// content that is already in the blockstore walks it through Get.
+//
+// Every blockstore that content can be written through must be wrapped with
+// the same WriteBarrier.
+type WriteBarrier struct {
+	lk     sync.Mutex
+	shaded *cid.Set // nil when no collection is running
+}
+
+// NewWriteBarrier creates a WriteBarrier.
+func NewWriteBarrier() *WriteBarrier {
+	return &WriteBarrier{}
+}
+
+// Blockstore wraps the given blockstore with the write barrier.
+func (wb *WriteBarrier) Blockstore(bs bstore.Blockstore) bstore.Blockstore {
+	return &barrierBS{Blockstore: bs, wb: wb}
+}
+
+// GCBlockstore wraps the given GCBlockstore with the write barrier.
+func (wb *WriteBarrier) GCBlockstore(bs bstore.GCBlockstore) bstore.GCBlockstore {
+	return &barrierBSGC{GCBlockstore: bs, wb: wb}
+}
+
+// shade records c as live if a collection is running. It must be called
+// before the block is touched so a concurrent sweep batch cannot remove it
+// in between.
+func (wb *WriteBarrier) shade(c cid.Cid) {
+	wb.lk.Lock()
+	if wb.shaded != nil {
+		wb.shaded.Add(c)
+	}
+	wb.lk.Unlock()
+}
+
+func (wb *WriteBarrier) isShaded(c cid.Cid) bool {
+	wb.lk.Lock()
+	defer wb.lk.Unlock()
+	return wb.shaded != nil && wb.shaded.Has(c)
+}
+
+func (wb *WriteBarrier) begin() error {
+	wb.lk.Lock()
+	defer wb.lk.Unlock()
+	if wb.shaded != nil {
+		return ErrCollectionInProgress
+	}
+	wb.shaded = cid.NewSet()
+	return nil
+}
+
+func (wb *WriteBarrier) end() {
+	wb.lk.Lock()
+	wb.shaded = nil
+	wb.lk.Unlock()
+}
+
+type barrierBS struct {
+	bstore.Blockstore
+	wb *WriteBarrier
+}
+
+func (bs *barrierBS) Put(b blocks.Block) error {
+	bs.wb.shade(b.Cid())
+	return bs.Blockstore.Put(b)
+}
+
+func (bs *barrierBS) PutMany(blks []blocks.Block) error {
+	for _, b := range blks {
+		bs.wb.shade(b.Cid())
+	}
+	return bs.Blockstore.PutMany(blks)
+}
+
+func (bs *barrierBS) Get(c cid.Cid) (blocks.Block, error) {
+	bs.wb.shade(c)
+	return bs.Blockstore.Get(c)
+}
+
+type barrierBSGC struct {
+	bstore.GCBlockstore
+	wb *WriteBarrier
+}
+
+func (bs *barrierBSGC) Put(b blocks.Block) error {
+	bs.wb.shade(b.Cid())
+	return bs.GCBlockstore.Put(b)
+}
+
+func (bs *barrierBSGC) PutMany(blks []blocks.Block) error {
+	for _, b := range blks {
+		bs.wb.shade(b.Cid())
+	}
+	return bs.GCBlockstore.PutMany(blks)
+}
+
+func (bs *barrierBSGC) Get(c cid.Cid) (blocks.Block, error) {
+	bs.wb.shade(c)
+	return bs.GCBlockstore.Get(c)
+}
+
+// IncrementalOptions tunes an incremental collection.
+type IncrementalOptions struct {
+	// BatchSize is the maximum number of blocks removed while holding the
+	// GC lock. Defaults to DefaultBatchSize.
+	BatchSize int
+
+	// BatchDelay is how long to wait between two batches, giving writers
+	// waiting on the GC lock a chance to make progress.
+	BatchDelay time.Duration
+}
+
+// IncrementalGC performs a mark and sweep garbage collection like GC, but
+// without holding the GC lock for the whole run.
+//
+// The GC lock is only taken briefly to enable the given WriteBarrier, so pin
+// operations in flight complete first. The best-effort roots are only listed
+// once the barrier is enabled, so a root that changes in between is either
+// listed or recorded by the barrier. The marked set is then computed in the
+// background while adds and pins carry on; any block they write or read is
+// recorded by the barrier. Finally, unmarked blocks are removed in batches
+// of at most opts.BatchSize, each batch taking the GC lock and skipping
+// blocks recorded by the barrier since the collection started. The blocks
+// walked while marking are recorded as well, so the barrier may grow as
+// large as the marked set.
+//
+// Results are reported on the returned channel exactly as GC does.
+func IncrementalGC(ctx context.Context, bs bstore.GCBlockstore, wb *WriteBarrier, dstor dstore.Datastore, pn pin.Pinner, bestEffortRoots func() ([]cid.Cid, error), opts IncrementalOptions) <-chan Result {
+	ctx, cancel := context.WithCancel(ctx)
+
+	output := make(chan Result, 128)
+
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultBatchSize
+	}
+
+	go func() {
+		defer cancel()
+		defer close(output)
+
+		emit := func(res Result) bool {
+			select {
+			case output <- res:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		if wb == nil {
+			emit(Result{Error: ErrNoWriteBarrier})
+			return
+		}
+
+		unlocker := bs.GCLock()
+		err := wb.begin()
+		unlocker.Unlock()
+		if err != nil {
+			emit(Result{Error: err})
+			return
+		}
+		defer wb.end()
+
+		roots, err := bestEffortRoots()
+		if err != nil {
+			emit(Result{Error: err})
+			return
+		}
+
+		bsrv := bserv.New(bs, offline.Exchange(bs))
+		ds := dag.NewDAGService(bsrv)
+
+		gcs, err := ColoredSet(ctx, pn, ds, roots, output)
+		if err != nil {
+			emit(Result{Error: err})
+			return
+		}
+
+		keychan, err := bs.AllKeysChan(ctx)
+		if err != nil {
+			emit(Result{Error: err})
+			return
+		}
+
+		errors := false
+		batch := make([]cid.Cid, 0, opts.BatchSize)
+
+		// sweep removes the current batch under the GC lock and reports
+		// the results once the lock is released.
+		sweep := func() bool {
+			results := make([]Result, 0, len(batch))
+
+			unlocker := bs.GCLock()
+			for _, k := range batch {
+				if wb.isShaded(k) {
+					continue
+				}
+				if err := bs.DeleteBlock(k); err != nil {
+					errors = true
+					results = append(results, Result{Error: &CannotDeleteBlockError{k, err}})
+					continue
+				}
+				results = append(results, Result{KeyRemoved: k})
+			}
+			unlocker.Unlock()
+
+			batch = batch[:0]
+			for _, res := range results {
+				if !emit(res) {
+					return false
+				}
+			}
+
+			if opts.BatchDelay > 0 {
+				select {
+				case <-time.After(opts.BatchDelay):
+				case <-ctx.Done():
+					return false
+				}
+			}
+			return true
+		}
+
+	loop:
+		for ctx.Err() == nil { // select may not notice that we're "done".
+			select {
+			case k, ok := <-keychan:
+				if !ok {
+					break loop
+				}
+				if gcs.Has(k) {
+					continue loop
+				}
+				batch = append(batch, k)
+				if len(batch) >= opts.BatchSize && !sweep() {
+					break loop
+				}
+			case <-ctx.Done():
+				break loop
+			}
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if len(batch) > 0 && !sweep() {
+			return
+		}
+
+		if errors {
+			if !emit(Result{Error: ErrCannotDeleteSomeBlocks}) {
+				return
+			}
+		}
+
+		gds, ok := dstor.(dstore.GCDatastore)
+		if !ok {
+			return
+		}
+
+		if err := gds.CollectGarbage(); err != nil {
+			emit(Result{Error: err})
+		}
+	}()
+
+	return output
+}
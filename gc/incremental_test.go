@@ -0,0 +1,326 @@
+package gc
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	blocks "github.com/ipfs/go-block-format"
+	bserv "github.com/ipfs/go-blockservice"
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	offline "github.com/ipfs/go-ipfs-exchange-offline"
+	pin "github.com/ipfs/go-ipfs-pinner"
+	"github.com/ipfs/go-ipfs-pinner/dspinner"
+	ipld "github.com/ipfs/go-ipld-format"
+	dag "github.com/ipfs/go-merkledag"
+)
+
+type testRepo struct {
+	dstore ds.Batching
+	bs     bstore.GCBlockstore
+	wb     *WriteBarrier
+	dserv  ipld.DAGService
+	pinner pin.Pinner
+}
+
+func newTestRepo(t *testing.T) *testRepo {
+	ctx := context.Background()
+
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	wb := NewWriteBarrier()
+	bs := wb.GCBlockstore(bstore.NewGCBlockstore(bstore.NewBlockstore(dstore), bstore.NewGCLocker()))
+	dserv := dag.NewDAGService(bserv.New(bs, offline.Exchange(bs)))
+
+	pinner, err := dspinner.New(ctx, dstore, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &testRepo{
+		dstore: dstore,
+		bs:     bs,
+		wb:     wb,
+		dserv:  dserv,
+		pinner: pinner,
+	}
+}
+
+// addDAG adds a node linking to n leaves, and returns it with the leaves.
+func (r *testRepo) addDAG(t *testing.T, name string, n int) (*dag.ProtoNode, []cid.Cid) {
+	ctx := context.Background()
+
+	root := dag.NodeWithData([]byte(name))
+	leaves := make([]cid.Cid, n)
+	for i := range leaves {
+		leaf := dag.NodeWithData([]byte(fmt.Sprintf("%s leaf %d", name, i)))
+		if err := r.dserv.Add(ctx, leaf); err != nil {
+			t.Fatal(err)
+		}
+		if err := root.AddNodeLink(fmt.Sprintf("%d", i), leaf); err != nil {
+			t.Fatal(err)
+		}
+		leaves[i] = leaf.Cid()
+	}
+	if err := r.dserv.Add(ctx, root); err != nil {
+		t.Fatal(err)
+	}
+	return root, leaves
+}
+
+func (r *testRepo) pin(t *testing.T, nd ipld.Node) {
+	ctx := context.Background()
+	if err := r.pinner.Pin(ctx, nd, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.pinner.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// addGarbage adds n unreferenced blocks.
+func (r *testRepo) addGarbage(t *testing.T, n int) []blocks.Block {
+	blks := make([]blocks.Block, n)
+	for i := range blks {
+		blks[i] = blocks.NewBlock([]byte(fmt.Sprintf("garbage %d", i)))
+		if err := r.bs.Put(blks[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return blks
+}
+
+func (r *testRepo) has(t *testing.T, c cid.Cid) bool {
+	has, err := r.bs.Has(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return has
+}
+
+func noRoots() ([]cid.Cid, error) {
+	return nil, nil
+}
+
+// collect returns the keys removed by a collection, failing on errors.
+func collect(t *testing.T, out <-chan Result) *cid.Set {
+	removed := cid.NewSet()
+	for res := range out {
+		if res.Error != nil {
+			t.Fatal(res.Error)
+		}
+		removed.Add(res.KeyRemoved)
+	}
+	return removed
+}
+
+func TestWriteBarrier(t *testing.T) {
+	wb := NewWriteBarrier()
+	c := blocks.NewBlock([]byte("block")).Cid()
+
+	wb.shade(c)
+	if wb.isShaded(c) {
+		t.Fatal("block shaded while no collection is running")
+	}
+
+	if err := wb.begin(); err != nil {
+		t.Fatal(err)
+	}
+	if err := wb.begin(); err != ErrCollectionInProgress {
+		t.Fatalf("expected %s, got %v", ErrCollectionInProgress, err)
+	}
+
+	wb.shade(c)
+	if !wb.isShaded(c) {
+		t.Fatal("block not shaded while a collection is running")
+	}
+
+	wb.end()
+	if wb.isShaded(c) {
+		t.Fatal("block still shaded after the collection")
+	}
+	if err := wb.begin(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIncrementalGC(t *testing.T) {
+	r := newTestRepo(t)
+	ctx := context.Background()
+
+	pinned, leaves := r.addDAG(t, "pinned", 3)
+	r.pin(t, pinned)
+	mfsRoot, _ := r.addDAG(t, "mfs", 2)
+	garbage := r.addGarbage(t, 5)
+
+	roots := func() ([]cid.Cid, error) {
+		return []cid.Cid{mfsRoot.Cid()}, nil
+	}
+	removed := collect(t, IncrementalGC(ctx, r.bs, r.wb, r.dstore, r.pinner, roots, IncrementalOptions{BatchSize: 2}))
+
+	if removed.Len() != len(garbage) {
+		t.Fatalf("expected %d blocks removed, got %d", len(garbage), removed.Len())
+	}
+	for _, b := range garbage {
+		if !removed.Has(b.Cid()) || r.has(t, b.Cid()) {
+			t.Fatalf("garbage block %s not removed", b.Cid())
+		}
+	}
+	for _, c := range append(leaves, pinned.Cid(), mfsRoot.Cid()) {
+		if !r.has(t, c) {
+			t.Fatalf("live block %s removed", c)
+		}
+	}
+}
+
+func TestIncrementalGCNoWriteBarrier(t *testing.T) {
+	r := newTestRepo(t)
+
+	for res := range IncrementalGC(context.Background(), r.bs, nil, r.dstore, r.pinner, noRoots, IncrementalOptions{}) {
+		if res.Error != ErrNoWriteBarrier {
+			t.Fatalf("expected %s, got %v", ErrNoWriteBarrier, res.Error)
+		}
+	}
+}
+
+// Blocks written while a collection sweeps are kept, even if they were
+// garbage when it started.
+func TestIncrementalGCKeepsBlocksWrittenDuringSweep(t *testing.T) {
+	r := newTestRepo(t)
+	ctx := context.Background()
+
+	garbage := r.addGarbage(t, 8)
+
+	out := IncrementalGC(ctx, r.bs, r.wb, r.dstore, r.pinner, noRoots, IncrementalOptions{
+		BatchSize:  1,
+		BatchDelay: 100 * time.Millisecond,
+	})
+
+	// The first batch was swept, the others wait for the batch delay.
+	first := <-out
+	if first.Error != nil {
+		t.Fatal(first.Error)
+	}
+
+	written := cid.NewSet()
+	for _, b := range garbage {
+		if b.Cid().Equals(first.KeyRemoved) {
+			continue
+		}
+		if err := r.bs.Put(b); err != nil {
+			t.Fatal(err)
+		}
+		written.Add(b.Cid())
+	}
+
+	removed := collect(t, out)
+	if removed.Len() != 0 {
+		t.Fatalf("%d blocks written during the sweep were removed", removed.Len())
+	}
+	for _, b := range garbage {
+		if kept := r.has(t, b.Cid()); kept != written.Has(b.Cid()) {
+			t.Fatalf("block %s: written %t, kept %t", b.Cid(), written.Has(b.Cid()), kept)
+		}
+	}
+
+	// The next collection removes them.
+	removed = collect(t, IncrementalGC(ctx, r.bs, r.wb, r.dstore, r.pinner, noRoots, IncrementalOptions{}))
+	if removed.Len() != written.Len() {
+		t.Fatalf("expected %d blocks removed, got %d", written.Len(), removed.Len())
+	}
+}
+
+// Roots are listed after the barrier is enabled, so blocks written before
+// they are listed are kept.
+func TestIncrementalGCListsRootsAfterBarrier(t *testing.T) {
+	r := newTestRepo(t)
+	ctx := context.Background()
+
+	garbage := r.addGarbage(t, 3)
+
+	roots := func() ([]cid.Cid, error) {
+		if err := r.bs.Put(garbage[0]); err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+	removed := collect(t, IncrementalGC(ctx, r.bs, r.wb, r.dstore, r.pinner, roots, IncrementalOptions{}))
+
+	if removed.Len() != len(garbage)-1 || removed.Has(garbage[0].Cid()) {
+		t.Fatalf("block written while listing roots was removed")
+	}
+}
+
+// batchBlockstore records the largest number of blocks deleted while holding
+// the GC lock.
+type batchBlockstore struct {
+	bstore.GCBlockstore
+
+	mu       sync.Mutex
+	locked   bool
+	deleted  int
+	maxBatch int
+	batches  int
+}
+
+type batchUnlocker struct {
+	bs       *batchBlockstore
+	unlocker bstore.Unlocker
+}
+
+func (u *batchUnlocker) Unlock() {
+	u.bs.mu.Lock()
+	if u.bs.deleted > 0 {
+		u.bs.batches++
+	}
+	if u.bs.deleted > u.bs.maxBatch {
+		u.bs.maxBatch = u.bs.deleted
+	}
+	u.bs.locked = false
+	u.bs.deleted = 0
+	u.bs.mu.Unlock()
+	u.unlocker.Unlock()
+}
+
+func (bs *batchBlockstore) GCLock() bstore.Unlocker {
+	unlocker := bs.GCBlockstore.GCLock()
+	bs.mu.Lock()
+	bs.locked = true
+	bs.mu.Unlock()
+	return &batchUnlocker{bs: bs, unlocker: unlocker}
+}
+
+func (bs *batchBlockstore) DeleteBlock(c cid.Cid) error {
+	bs.mu.Lock()
+	if !bs.locked {
+		bs.mu.Unlock()
+		return fmt.Errorf("%s deleted without the GC lock", c)
+	}
+	bs.deleted++
+	bs.mu.Unlock()
+	return bs.GCBlockstore.DeleteBlock(c)
+}
+
+func TestIncrementalGCBatchSize(t *testing.T) {
+	r := newTestRepo(t)
+	ctx := context.Background()
+
+	garbage := r.addGarbage(t, 10)
+
+	bs := &batchBlockstore{GCBlockstore: r.bs}
+	removed := collect(t, IncrementalGC(ctx, bs, r.wb, r.dstore, r.pinner, noRoots, IncrementalOptions{BatchSize: 3}))
+
+	if removed.Len() != len(garbage) {
+		t.Fatalf("expected %d blocks removed, got %d", len(garbage), removed.Len())
+	}
+	if bs.maxBatch > 3 {
+		t.Fatalf("removed %d blocks in one batch, expected at most 3", bs.maxBatch)
+	}
+	if bs.batches != 4 {
+		t.Fatalf("expected 4 batches, got %d", bs.batches)
+	}
+}
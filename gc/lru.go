@@ -0,0 +1,382 @@
+package gc
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	blocks "github.com/ipfs/go-block-format"
+	bserv "github.com/ipfs/go-blockservice"
+	cid "github.com/ipfs/go-cid"
+	dstore "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	offline "github.com/ipfs/go-ipfs-exchange-offline"
+	pin "github.com/ipfs/go-ipfs-pinner"
+	dag "github.com/ipfs/go-merkledag"
+)
+
+// PolicySelector is the configuration key selecting what is removed once
+// the repo grows over Datastore.StorageGCWatermark.
+const PolicySelector = "Datastore.StorageGCPolicy"
+
+const (
+	// PolicyFull removes every unpinned block. This is the default.
+	PolicyFull = "full"
+	// PolicyLRU only removes the least recently used unpinned blocks,
+	// until the repo is back under the watermark.
+	PolicyLRU = "lru"
+)
+
+// AccessTimeResolution is the granularity of the access times recorded by
+// an AccessTracker. The access time of a block is written to the datastore
+// at most once per period, so reads don't turn into as many writes.
+const AccessTimeResolution = time.Hour
+
+// accessTimeCacheSize is the number of access times an AccessTracker keeps in
+// memory. The cache is cleared once full, the access times are then read back
+// from the datastore.
+const accessTimeCacheSize = 1 << 16
+
+// accessTimePrefix is the datastore prefix of the recorded access times,
+// keyed by multihash.
+var accessTimePrefix = dstore.NewKey("/gc/atime")
+
+// AccessTracker wraps a blockstore and records when each block was last
+// written or read, so that Evict can remove the least recently used blocks
+// first. Access times are rounded down to AccessTimeResolution and stored
+// in the datastore, so they survive restarts. Blocks that were never
+// accessed since the tracker was first used are considered the least
+// recently used.
+type AccessTracker struct {
+	bstore.Blockstore
+
+	dstore dstore.Datastore
+
+	lk sync.Mutex
+	// last caches the recorded access times, multihash -> unix seconds
+	last      map[string]int64
+	maxCached int
+
+	// countLk is held for writing while counting the recorded access times,
+	// and for reading while adding or removing one.
+	countLk sync.RWMutex
+	counted bool
+	count   int64
+}
+
+// NewAccessTracker wraps the given blockstore with an AccessTracker
+// recording the access times in the given datastore.
+func NewAccessTracker(bs bstore.Blockstore, d dstore.Datastore) *AccessTracker {
+	return &AccessTracker{
+		Blockstore: bs,
+		dstore:     d,
+		last:       make(map[string]int64),
+		maxCached:  accessTimeCacheSize,
+	}
+}
+
+func (t *AccessTracker) Put(b blocks.Block) error {
+	err := t.Blockstore.Put(b)
+	if err == nil {
+		t.touch(b.Cid())
+	}
+	return err
+}
+
+func (t *AccessTracker) PutMany(blks []blocks.Block) error {
+	err := t.Blockstore.PutMany(blks)
+	if err == nil {
+		for _, b := range blks {
+			t.touch(b.Cid())
+		}
+	}
+	return err
+}
+
+func (t *AccessTracker) Get(c cid.Cid) (blocks.Block, error) {
+	b, err := t.Blockstore.Get(c)
+	if err == nil {
+		t.touch(c)
+	}
+	return b, err
+}
+
+func (t *AccessTracker) DeleteBlock(c cid.Cid) error {
+	err := t.Blockstore.DeleteBlock(c)
+	if err == nil {
+		t.forget(c)
+	}
+	return err
+}
+
+func (t *AccessTracker) forget(c cid.Cid) {
+	t.lk.Lock()
+	delete(t.last, string(c.Hash()))
+	t.lk.Unlock()
+
+	t.countLk.RLock()
+	defer t.countLk.RUnlock()
+
+	key := accessTimeKey(c)
+	has, err := t.dstore.Has(key)
+	if err == nil && has {
+		err = t.dstore.Delete(key)
+		if err == nil && t.counted {
+			atomic.AddInt64(&t.count, -1)
+		}
+	}
+	if err != nil {
+		log.Errorf("failed to forget the access time of %s: %s", c, err)
+	}
+}
+
+// Blocks are keyed by multihash so that accessing a block through another
+// CID version still counts.
+func accessTimeKey(c cid.Cid) dstore.Key {
+	return accessTimePrefix.ChildString(c.Hash().B58String())
+}
+
+// touch records an access to the block, writing it to the datastore if the
+// recorded time is older than AccessTimeResolution.
+func (t *AccessTracker) touch(c cid.Cid) {
+	t.record(c, time.Now().Truncate(AccessTimeResolution).Unix())
+}
+
+func (t *AccessTracker) record(c cid.Cid, last int64) {
+	t.lk.Lock()
+	prev, cached := t.last[string(c.Hash())]
+	t.lk.Unlock()
+	if cached && prev == last {
+		return
+	}
+
+	t.countLk.RLock()
+	defer t.countLk.RUnlock()
+
+	// Blocks missing from the cache are looked up in the datastore, reads
+	// being cheaper than writes
+	recorded := cached
+	if !cached {
+		stored, ok, err := t.stored(c)
+		if err != nil {
+			log.Errorf("failed to read the access time of %s: %s", c, err)
+			return
+		}
+		recorded = ok
+		if recorded && stored == last {
+			t.cache(c, last)
+			return
+		}
+	}
+
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(last))
+	if err := t.dstore.Put(accessTimeKey(c), buf[:]); err != nil {
+		log.Errorf("failed to record the access time of %s: %s", c, err)
+		return
+	}
+	// A block recorded concurrently is cached by the first recording
+	if raced := t.cache(c, last); !recorded && !raced && t.counted {
+		atomic.AddInt64(&t.count, 1)
+	}
+}
+
+// cache keeps the access time of the block in memory, clearing the cache
+// first when full. It returns whether the block was cached already.
+func (t *AccessTracker) cache(c cid.Cid, last int64) bool {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+	if len(t.last) >= t.maxCached {
+		t.last = make(map[string]int64)
+	}
+	_, ok := t.last[string(c.Hash())]
+	t.last[string(c.Hash())] = last
+	return ok
+}
+
+// stored reads the access time of the block from the datastore, and false if
+// there is none.
+func (t *AccessTracker) stored(c cid.Cid) (int64, bool, error) {
+	buf, err := t.dstore.Get(accessTimeKey(c))
+	if err == dstore.ErrNotFound {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	if len(buf) != 8 {
+		return 0, false, fmt.Errorf("invalid access time of %s", c)
+	}
+	return int64(binary.BigEndian.Uint64(buf)), true, nil
+}
+
+// LastAccess returns when the given block was last accessed, rounded down to
+// AccessTimeResolution, and false if it was never accessed.
+func (t *AccessTracker) LastAccess(c cid.Cid) (time.Time, bool) {
+	t.lk.Lock()
+	last, ok := t.last[string(c.Hash())]
+	t.lk.Unlock()
+	if ok {
+		return time.Unix(last, 0), true
+	}
+
+	stored, ok, err := t.stored(c)
+	if err != nil {
+		log.Errorf("failed to read the access time of %s: %s", c, err)
+		return time.Time{}, false
+	}
+	return time.Unix(stored, 0), ok
+}
+
+// Len returns the number of blocks with a recorded access time. They are
+// counted in the datastore the first time, and then kept count of.
+func (t *AccessTracker) Len() (int, error) {
+	t.countLk.RLock()
+	counted := t.counted
+	t.countLk.RUnlock()
+	if counted {
+		return int(atomic.LoadInt64(&t.count)), nil
+	}
+
+	t.countLk.Lock()
+	defer t.countLk.Unlock()
+	if t.counted {
+		return int(t.count), nil
+	}
+
+	res, err := t.dstore.Query(query.Query{
+		Prefix:   accessTimePrefix.String(),
+		KeysOnly: true,
+	})
+	if err != nil {
+		return 0, err
+	}
+	defer res.Close()
+
+	n := 0
+	for r := range res.Next() {
+		if r.Error != nil {
+			return 0, r.Error
+		}
+		n++
+	}
+	t.count = int64(n)
+	t.counted = true
+	return n, nil
+}
+
+// Evict removes unpinned blocks from the blockstore, least recently
+// accessed first according to tracker, until at least size bytes were
+// removed or no unpinned block is left. Blocks are selected with ColoredSet
+// like GC does, and the GC lock is held for the whole run. The tracker is
+// expected to sit below bs so that it forgets the removed blocks.
+//
+// Every removed block is reported as a Result with KeyRemoved and Size set.
+func Evict(ctx context.Context, bs bstore.GCBlockstore, dstor dstore.Datastore, pn pin.Pinner, bestEffortRoots []cid.Cid, tracker *AccessTracker, size uint64) <-chan Result {
+	ctx, cancel := context.WithCancel(ctx)
+
+	unlocker := bs.GCLock()
+
+	bsrv := bserv.New(bs, offline.Exchange(bs))
+	ds := dag.NewDAGService(bsrv)
+
+	output := make(chan Result, 128)
+
+	go func() {
+		defer cancel()
+		defer close(output)
+		defer unlocker.Unlock()
+
+		emit := func(res Result) bool {
+			select {
+			case output <- res:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		gcs, err := ColoredSet(ctx, pn, ds, bestEffortRoots, output)
+		if err != nil {
+			emit(Result{Error: err})
+			return
+		}
+
+		keychan, err := bs.AllKeysChan(ctx)
+		if err != nil {
+			emit(Result{Error: err})
+			return
+		}
+
+		type candidate struct {
+			key  cid.Cid
+			size uint64
+			last int64
+		}
+		var candidates []candidate
+		for k := range keychan {
+			if gcs.Has(k) {
+				continue
+			}
+			s, err := bs.GetSize(k)
+			if err != nil {
+				if !emit(Result{Error: err}) {
+					return
+				}
+				continue
+			}
+			var last int64
+			if t, ok := tracker.LastAccess(k); ok {
+				last = t.Unix()
+			}
+			candidates = append(candidates, candidate{k, uint64(s), last})
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		sort.Slice(candidates, func(i, j int) bool {
+			return candidates[i].last < candidates[j].last
+		})
+
+		errors := false
+		var freed uint64
+		for _, c := range candidates {
+			if freed >= size {
+				break
+			}
+			if err := bs.DeleteBlock(c.key); err != nil {
+				errors = true
+				if !emit(Result{Error: &CannotDeleteBlockError{c.key, err}}) {
+					return
+				}
+				continue
+			}
+			freed += c.size
+			if !emit(Result{KeyRemoved: c.key, Size: c.size}) {
+				return
+			}
+		}
+		if errors {
+			if !emit(Result{Error: ErrCannotDeleteSomeBlocks}) {
+				return
+			}
+		}
+
+		gds, ok := dstor.(dstore.GCDatastore)
+		if !ok {
+			return
+		}
+
+		if err := gds.CollectGarbage(); err != nil {
+			emit(Result{Error: err})
+		}
+	}()
+
+	return output
+}
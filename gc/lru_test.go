@@ -0,0 +1,195 @@
+package gc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	blocks "github.com/ipfs/go-block-format"
+	bserv "github.com/ipfs/go-blockservice"
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	offline "github.com/ipfs/go-ipfs-exchange-offline"
+	"github.com/ipfs/go-ipfs-pinner/dspinner"
+	dag "github.com/ipfs/go-merkledag"
+)
+
+// newTrackedTestRepo creates a testRepo whose blockstore sits on top of an
+// AccessTracker.
+func newTrackedTestRepo(t *testing.T) (*testRepo, *AccessTracker) {
+	ctx := context.Background()
+
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	tracker := NewAccessTracker(bstore.NewBlockstore(dstore), dstore)
+	bs := bstore.NewGCBlockstore(tracker, bstore.NewGCLocker())
+	dserv := dag.NewDAGService(bserv.New(bs, offline.Exchange(bs)))
+
+	pinner, err := dspinner.New(ctx, dstore, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &testRepo{
+		dstore: dstore,
+		bs:     bs,
+		wb:     NewWriteBarrier(),
+		dserv:  dserv,
+		pinner: pinner,
+	}, tracker
+}
+
+func TestAccessTracker(t *testing.T) {
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	tracker := NewAccessTracker(bstore.NewBlockstore(dstore), dstore)
+
+	written := blocks.NewBlock([]byte("written"))
+	read := blocks.NewBlock([]byte("read"))
+	untouched := blocks.NewBlock([]byte("untouched"))
+
+	// Store read and untouched below the tracker.
+	base := bstore.NewBlockstore(dstore)
+	for _, b := range []blocks.Block{read, untouched} {
+		if err := base.Put(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	before := time.Now().Truncate(AccessTimeResolution)
+	if err := tracker.Put(written); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tracker.Get(read.Cid()); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, b := range []blocks.Block{written, read} {
+		last, ok := tracker.LastAccess(b.Cid())
+		if !ok {
+			t.Fatalf("no access time recorded for %s", b.Cid())
+		}
+		if last.Before(before) || last.After(time.Now()) {
+			t.Fatalf("unexpected access time %s for %s", last, b.Cid())
+		}
+	}
+	// Access times are shared by the CID versions of a block.
+	if _, ok := tracker.LastAccess(cid.NewCidV1(cid.DagProtobuf, read.Cid().Hash())); !ok {
+		t.Fatal("no access time recorded for the CIDv1 of a read block")
+	}
+	if _, ok := tracker.LastAccess(untouched.Cid()); ok {
+		t.Fatal("access time recorded for an untouched block")
+	}
+	if n, err := tracker.Len(); err != nil || n != 2 {
+		t.Fatalf("expected 2 tracked blocks, got %d (%v)", n, err)
+	}
+
+	// Access times survive restarts.
+	restarted := NewAccessTracker(bstore.NewBlockstore(dstore), dstore)
+	for _, b := range []blocks.Block{written, read} {
+		if _, ok := restarted.LastAccess(b.Cid()); !ok {
+			t.Fatalf("access time of %s lost after restart", b.Cid())
+		}
+	}
+
+	// Removed blocks are forgotten.
+	if err := restarted.DeleteBlock(written.Cid()); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := restarted.LastAccess(written.Cid()); ok {
+		t.Fatal("access time of a removed block still recorded")
+	}
+	if n, err := restarted.Len(); err != nil || n != 1 {
+		t.Fatalf("expected 1 tracked block, got %d (%v)", n, err)
+	}
+}
+
+func TestEvict(t *testing.T) {
+	r, tracker := newTrackedTestRepo(t)
+	ctx := context.Background()
+
+	pinned, leaves := r.addDAG(t, "pinned", 2)
+	r.pin(t, pinned)
+
+	// The blocks were all accessed when added, backdate the garbage.
+	garbage := r.addGarbage(t, 4)
+	now := time.Now().Truncate(AccessTimeResolution)
+	for i, b := range garbage {
+		tracker.record(b.Cid(), now.Add(time.Duration(i-len(garbage))*AccessTimeResolution).Unix())
+	}
+	// pinned blocks are never evicted, even when older
+	tracker.record(pinned.Cid(), 0)
+
+	size := uint64(len(garbage[0].RawData()) + len(garbage[1].RawData()))
+
+	var removed []cid.Cid
+	var freed uint64
+	for res := range Evict(ctx, r.bs, r.dstore, r.pinner, nil, tracker, size) {
+		if res.Error != nil {
+			t.Fatal(res.Error)
+		}
+		removed = append(removed, res.KeyRemoved)
+		freed += res.Size
+	}
+
+	if len(removed) != 2 || !removed[0].Equals(garbage[0].Cid()) || !removed[1].Equals(garbage[1].Cid()) {
+		t.Fatalf("expected the two least recently used blocks to be removed, got %s", removed)
+	}
+	if freed != size {
+		t.Fatalf("expected %d bytes freed, got %d", size, freed)
+	}
+	for _, c := range append(leaves, pinned.Cid(), garbage[2].Cid(), garbage[3].Cid()) {
+		if !r.has(t, c) {
+			t.Fatalf("block %s removed", c)
+		}
+	}
+	if _, ok := tracker.LastAccess(garbage[0].Cid()); ok {
+		t.Fatal("access time of an evicted block still recorded")
+	}
+}
+
+func TestAccessTrackerCache(t *testing.T) {
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	tracker := NewAccessTracker(bstore.NewBlockstore(dstore), dstore)
+	tracker.maxCached = 2
+
+	var blks []blocks.Block
+	for i := 0; i < 5; i++ {
+		b := blocks.NewBlock([]byte{byte(i)})
+		if err := tracker.Put(b); err != nil {
+			t.Fatal(err)
+		}
+		blks = append(blks, b)
+	}
+	if len(tracker.last) > 2 {
+		t.Fatalf("expected at most 2 cached access times, got %d", len(tracker.last))
+	}
+	for _, b := range blks {
+		if _, ok := tracker.LastAccess(b.Cid()); !ok {
+			t.Fatalf("access time of %s lost from the cache", b.Cid())
+		}
+	}
+	if n, err := tracker.Len(); err != nil || n != 5 {
+		t.Fatalf("expected 5 tracked blocks, got %d (%v)", n, err)
+	}
+
+	// Once counted, the tracked blocks are kept count of.
+	untracked := blocks.NewBlock([]byte("untracked"))
+	if err := bstore.NewBlockstore(dstore).Put(untracked); err != nil {
+		t.Fatal(err)
+	}
+	if err := tracker.Put(blocks.NewBlock([]byte("new"))); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tracker.Get(blks[0].Cid()); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []cid.Cid{blks[1].Cid(), untracked.Cid()} {
+		if err := tracker.DeleteBlock(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n, err := tracker.Len(); err != nil || n != 5 {
+		t.Fatalf("expected 5 tracked blocks, got %d (%v)", n, err)
+	}
+}
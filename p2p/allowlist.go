@@ -0,0 +1,179 @@
+package p2p
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	peer "github.com/libp2p/go-libp2p-core/peer"
+)
+
+// Allowlist restricts the peers allowed to open streams to a remote listener.
+// An allowlist with no peers and no file allows all peers, until peers are
+// added to it.
+type Allowlist struct {
+	mu sync.Mutex
+
+	enabled bool
+	peers   map[peer.ID]struct{}
+
+	// file lists more allowed peers, one per line. It is read again when
+	// it changes.
+	file      string
+	modTime   time.Time
+	filePeers map[peer.ID]struct{}
+}
+
+// NewAllowlist creates an allowlist of the given peers, and of the peers
+// listed in file if it isn't empty.
+func NewAllowlist(peers []peer.ID, file string) (*Allowlist, error) {
+	a := &Allowlist{
+		enabled: len(peers) > 0 || file != "",
+		peers:   make(map[peer.ID]struct{}, len(peers)),
+		file:    file,
+	}
+	for _, p := range peers {
+		a.peers[p] = struct{}{}
+	}
+	if file != "" {
+		if err := a.loadFile(); err != nil {
+			return nil, err
+		}
+	}
+	return a, nil
+}
+
+// Enabled returns whether the allowlist restricts the peers at all.
+func (a *Allowlist) Enabled() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.enabled
+}
+
+// Allowed returns whether the peer may open streams.
+func (a *Allowlist) Allowed(p peer.ID) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if !a.enabled {
+		return true
+	}
+	if _, ok := a.peers[p]; ok {
+		return true
+	}
+	if a.file == "" {
+		return false
+	}
+	if err := a.loadFile(); err != nil {
+		log.Errorf("failed to read p2p allowlist: %s", err)
+	}
+	_, ok := a.filePeers[p]
+	return ok
+}
+
+// Add allows the peers, and enables the allowlist.
+func (a *Allowlist) Add(peers ...peer.ID) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.enabled = true
+	for _, p := range peers {
+		a.peers[p] = struct{}{}
+	}
+}
+
+// Remove disallows the peers. Peers listed in the allowlist file are only
+// disallowed by removing them from the file.
+func (a *Allowlist) Remove(peers ...peer.ID) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for _, p := range peers {
+		delete(a.peers, p)
+	}
+}
+
+// Peers returns the allowed peers, including those in the allowlist file,
+// sorted.
+func (a *Allowlist) Peers() []peer.ID {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.file != "" {
+		if err := a.loadFile(); err != nil {
+			log.Errorf("failed to read p2p allowlist: %s", err)
+		}
+	}
+
+	peers := make([]peer.ID, 0, len(a.peers)+len(a.filePeers))
+	for p := range a.peers {
+		peers = append(peers, p)
+	}
+	for p := range a.filePeers {
+		if _, ok := a.peers[p]; !ok {
+			peers = append(peers, p)
+		}
+	}
+	sort.Slice(peers, func(i, j int) bool {
+		return peers[i] < peers[j]
+	})
+	return peers
+}
+
+// File returns the path of the allowlist file, if any.
+func (a *Allowlist) File() string {
+	return a.file
+}
+
+// loadFile reads the allowlist file if it changed since it was last read. A
+// missing file allows no peer, and an invalid file keeps the peers of the
+// last valid one.
+func (a *Allowlist) loadFile() error {
+	fi, err := os.Stat(a.file)
+	if os.IsNotExist(err) {
+		a.modTime = time.Time{}
+		a.filePeers = nil
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	if fi.ModTime().Equal(a.modTime) && a.filePeers != nil {
+		return nil
+	}
+
+	f, err := os.Open(a.file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	peers := map[peer.ID]struct{}{}
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if i := strings.IndexByte(text, '#'); i >= 0 {
+			text = text[:i]
+		}
+		text = strings.TrimSpace(text)
+		if text == "" {
+			continue
+		}
+		p, err := peer.Decode(text)
+		if err != nil {
+			return fmt.Errorf("%s:%d: invalid peer ID %q: %s", a.file, line, text, err)
+		}
+		peers[p] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	a.modTime = fi.ModTime()
+	a.filePeers = peers
+	return nil
+}
@@ -0,0 +1,108 @@
+package p2p
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	tu "github.com/libp2p/go-libp2p-core/test"
+)
+
+func TestAllowlist(t *testing.T) {
+	a, b := tu.RandPeerIDFatal(t), tu.RandPeerIDFatal(t)
+
+	// An empty allowlist allows everyone, until a peer is added
+	allow, err := NewAllowlist(nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if allow.Enabled() || !allow.Allowed(a) || !allow.Allowed(b) {
+		t.Fatal("expected an empty allowlist to allow all peers")
+	}
+	allow.Add(a)
+	if !allow.Enabled() || !allow.Allowed(a) || allow.Allowed(b) {
+		t.Fatal("expected only the added peer to be allowed")
+	}
+
+	// Removing every peer doesn't open the allowlist again
+	allow.Remove(a)
+	if !allow.Enabled() || allow.Allowed(a) {
+		t.Fatal("expected no peer to be allowed once all are removed")
+	}
+
+	allow, err = NewAllowlist([]peer.ID{a}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !allow.Enabled() || !allow.Allowed(a) || allow.Allowed(b) {
+		t.Fatal("expected only the given peer to be allowed")
+	}
+}
+
+func TestAllowlistFile(t *testing.T) {
+	a, b, c := tu.RandPeerIDFatal(t), tu.RandPeerIDFatal(t), tu.RandPeerIDFatal(t)
+
+	dir, err := ioutil.TempDir("", "p2p-allowlist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "allow")
+
+	// write sets the content of the file, and a new modification time
+	mtime := time.Now()
+	write := func(content string) {
+		if err := ioutil.WriteFile(file, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		mtime = mtime.Add(time.Second)
+		if err := os.Chtimes(file, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := NewAllowlist(nil, file); err == nil {
+		t.Fatal("expected an error for a missing file")
+	}
+
+	write("# partners\n" + b.Pretty() + " # b\n\n")
+	allow, err := NewAllowlist([]peer.ID{a}, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !allow.Enabled() || !allow.Allowed(a) || !allow.Allowed(b) || allow.Allowed(c) {
+		t.Fatal("expected the given peer and the peer of the file to be allowed")
+	}
+	if peers := allow.Peers(); len(peers) != 2 {
+		t.Fatalf("expected 2 allowed peers, got %s", peers)
+	}
+
+	// The file is read again when it changes
+	write(c.Pretty() + "\n")
+	if allow.Allowed(b) || !allow.Allowed(c) {
+		t.Fatal("expected the changes of the file to be applied")
+	}
+
+	// An invalid file keeps the peers of the last valid one
+	write("not a peer\n")
+	if !allow.Allowed(c) {
+		t.Fatal("expected the peers of the last valid file to be kept")
+	}
+
+	// Peers of the file can't be removed at runtime
+	allow.Remove(c)
+	if !allow.Allowed(c) {
+		t.Fatal("expected the peer of the file to stay allowed")
+	}
+
+	if err := os.Remove(file); err != nil {
+		t.Fatal(err)
+	}
+	// A missing file allows no peer
+	if allow.Allowed(c) || !allow.Allowed(a) {
+		t.Fatal("expected only the given peer to be allowed once the file is removed")
+	}
+}
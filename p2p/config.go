@@ -0,0 +1,134 @@
+package p2p
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	humanize "github.com/dustin/go-humanize"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	pstore "github.com/libp2p/go-libp2p-core/peerstore"
+	"github.com/libp2p/go-libp2p-core/protocol"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// ListenersSelector is the configuration key listing the listeners restored
+// when the daemon starts.
+const ListenersSelector = "P2P.Listeners"
+
+// ListenerConfig declares a listener in the config. A forward of local
+// connections to a peer (ipfs p2p forward) has a ListenAddress and a /p2p/
+// TargetAddress. A service accepting streams from peers (ipfs p2p listen)
+// only has a TargetAddress.
+type ListenerConfig struct {
+	Protocol      string
+	ListenAddress string `json:",omitempty"`
+	TargetAddress string
+
+	// Limits of the streams. Bandwidth is in bytes per second, such as
+	// "1MB".
+	MaxStreams int    `json:",omitempty"`
+	Bandwidth  string `json:",omitempty"`
+
+	// Options of services. Restricted keeps rejecting the peers when the
+	// last of AllowPeers was removed, and there is no AllowlistFile.
+	ReportPeerID  bool     `json:",omitempty"`
+	AllowPeers    []string `json:",omitempty"`
+	AllowlistFile string   `json:",omitempty"`
+	Restricted    bool     `json:",omitempty"`
+}
+
+// IsForward returns whether the config declares a forward of local
+// connections.
+func (c *ListenerConfig) IsForward() bool {
+	return c.ListenAddress != ""
+}
+
+// Declares returns whether the config declares the listener.
+func (c *ListenerConfig) Declares(l Listener) bool {
+	switch l.(type) {
+	case *localListener, *udpListener:
+		if !c.IsForward() {
+			return false
+		}
+		laddr, err := ma.NewMultiaddr(c.ListenAddress)
+		return err == nil && laddr.Equal(l.ListenAddress())
+	case *remoteListener:
+		return !c.IsForward() && protocol.ID(c.Protocol) == l.Protocol()
+	}
+	return false
+}
+
+// SetAllowlist declares the peers allowed by a, the peers of its file
+// excepted.
+func (c *ListenerConfig) SetAllowlist(a *Allowlist) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	c.AllowPeers = make([]string, 0, len(a.peers))
+	for p := range a.peers {
+		c.AllowPeers = append(c.AllowPeers, p.Pretty())
+	}
+	sort.Strings(c.AllowPeers)
+	c.AllowlistFile = a.file
+	c.Restricted = a.enabled && len(a.peers) == 0 && a.file == ""
+}
+
+// Limits returns the limits of the streams declared by the config.
+func (c *ListenerConfig) Limits() (Limits, error) {
+	limits := Limits{MaxStreams: c.MaxStreams}
+	if c.Bandwidth != "" {
+		bw, err := humanize.ParseBytes(c.Bandwidth)
+		if err != nil {
+			return Limits{}, fmt.Errorf("invalid bandwidth %q: %s", c.Bandwidth, err)
+		}
+		limits.Bandwidth = int64(bw)
+	}
+	return limits, nil
+}
+
+// Restore creates the listener declared by the config.
+func (p2p *P2P) Restore(ctx context.Context, c ListenerConfig) (Listener, error) {
+	proto := protocol.ID(c.Protocol)
+	if proto == "" {
+		return nil, errors.New("listener has no protocol")
+	}
+	target, err := ma.NewMultiaddr(c.TargetAddress)
+	if err != nil {
+		return nil, err
+	}
+	limits, err := c.Limits()
+	if err != nil {
+		return nil, err
+	}
+
+	if c.IsForward() {
+		listen, err := ma.NewMultiaddr(c.ListenAddress)
+		if err != nil {
+			return nil, err
+		}
+		pi, err := peer.AddrInfoFromP2pAddr(target)
+		if err != nil {
+			return nil, err
+		}
+		p2p.peerstore.AddAddrs(pi.ID, pi.Addrs, pstore.TempAddrTTL)
+		return p2p.ForwardLocal(ctx, pi.ID, proto, listen, limits)
+	}
+
+	allowed := make([]peer.ID, len(c.AllowPeers))
+	for i, s := range c.AllowPeers {
+		allowed[i], err = peer.Decode(s)
+		if err != nil {
+			return nil, err
+		}
+	}
+	allow, err := NewAllowlist(allowed, c.AllowlistFile)
+	if err != nil {
+		return nil, err
+	}
+	if c.Restricted {
+		allow.Add()
+	}
+	return p2p.ForwardRemote(ctx, proto, target, c.ReportPeerID, allow, limits)
+}
@@ -0,0 +1,142 @@
+package p2p
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	tu "github.com/libp2p/go-libp2p-core/test"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+)
+
+func newTestP2P(t *testing.T, mn mocknet.Mocknet) *P2P {
+	h, err := mn.GenPeer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return New(h.ID(), h, h.Peerstore())
+}
+
+// reloadConfig returns c as read back from the config.
+func reloadConfig(t *testing.T, c ListenerConfig) ListenerConfig {
+	b, err := json.Marshal(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out ListenerConfig
+	if err := json.Unmarshal(b, &out); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestRestoreForward(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	p := newTestP2P(t, mocknet.New(ctx))
+	remote := tu.RandPeerIDFatal(t)
+
+	l, err := p.Restore(ctx, ListenerConfig{
+		Protocol:      "/x/test",
+		ListenAddress: "/ip4/127.0.0.1/tcp/0",
+		TargetAddress: "/p2p/" + remote.Pretty(),
+		MaxStreams:    2,
+		Bandwidth:     "1kB",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.ListenersLocal.Close(func(Listener) bool { return true })
+
+	if l.Protocol() != "/x/test" || l.TargetAddress().String() != "/p2p/"+remote.Pretty() {
+		t.Fatalf("unexpected forward %s to %s", l.Protocol(), l.TargetAddress())
+	}
+	if limits := l.Usage().Limits(); limits.MaxStreams != 2 || limits.Bandwidth != 1000 {
+		t.Fatalf("unexpected limits %+v", limits)
+	}
+
+	// The forward is persisted with the address it listens on
+	persisted := reloadConfig(t, ListenerConfig{
+		Protocol:      "/x/test",
+		ListenAddress: l.ListenAddress().String(),
+		TargetAddress: l.TargetAddress().String(),
+	})
+	if !persisted.Declares(l) {
+		t.Fatal("expected the persisted config to declare the forward")
+	}
+	for _, c := range []ListenerConfig{
+		{Protocol: "/x/test", ListenAddress: "/ip4/127.0.0.1/tcp/1", TargetAddress: persisted.TargetAddress},
+		{Protocol: "/x/test", TargetAddress: "/ip4/127.0.0.1/tcp/22"},
+	} {
+		if c.Declares(l) {
+			t.Errorf("unexpected config %+v declaring the forward", c)
+		}
+	}
+
+	if _, err := p.Restore(ctx, ListenerConfig{Protocol: "/x/test", ListenAddress: "/ip4/127.0.0.1/tcp/0", TargetAddress: "/ip4/127.0.0.1/tcp/22"}); err == nil {
+		t.Fatal("expected a forward to a non-peer address to be rejected")
+	}
+}
+
+func TestRestoreService(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mn := mocknet.New(ctx)
+	p := newTestP2P(t, mn)
+	a, b := tu.RandPeerIDFatal(t), tu.RandPeerIDFatal(t)
+
+	c := ListenerConfig{
+		Protocol:      "/x/test",
+		TargetAddress: "/ip4/127.0.0.1/tcp/22",
+		ReportPeerID:  true,
+		AllowPeers:    []string{a.Pretty()},
+	}
+	l, err := p.Restore(ctx, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.Declares(l) {
+		t.Fatal("expected the config to declare the service")
+	}
+	if !l.(*remoteListener).reportRemote {
+		t.Fatal("expected the service to report the peer ID")
+	}
+	allow := l.Allowlist()
+	if !allow.Allowed(a) || allow.Allowed(b) {
+		t.Fatal("expected only the peer of the config to be allowed")
+	}
+
+	// Changes of the allowlist are persisted
+	allow.Add(b)
+	c.SetAllowlist(allow)
+	c = reloadConfig(t, c)
+	if len(c.AllowPeers) != 2 || c.Restricted {
+		t.Fatalf("unexpected persisted allowlist %v, restricted %t", c.AllowPeers, c.Restricted)
+	}
+
+	// and restore a service rejecting every peer once the last is removed
+	allow.Remove(a, b)
+	c.SetAllowlist(allow)
+	c = reloadConfig(t, c)
+	if len(c.AllowPeers) != 0 || !c.Restricted {
+		t.Fatalf("unexpected persisted allowlist %v, restricted %t", c.AllowPeers, c.Restricted)
+	}
+	restored, err := newTestP2P(t, mn).Restore(ctx, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if allow := restored.Allowlist(); !allow.Enabled() || allow.Allowed(a) {
+		t.Fatal("expected the restored service to reject every peer")
+	}
+
+	// A service open to every peer stays open
+	open, err := newTestP2P(t, mn).Restore(ctx, ListenerConfig{Protocol: "/x/test", TargetAddress: "/ip4/127.0.0.1/tcp/22"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c = ListenerConfig{}
+	c.SetAllowlist(open.Allowlist())
+	if c.Restricted || len(c.AllowPeers) != 0 {
+		t.Fatal("expected an open service to be persisted open")
+	}
+}
@@ -16,6 +16,14 @@ type Listener interface {
 	ListenAddress() ma.Multiaddr
 	TargetAddress() ma.Multiaddr
 
+	// Usage returns the limits and the traffic of the streams of the
+	// listener.
+	Usage() *Usage
+
+	// Allowlist returns the peers allowed to open streams to the listener,
+	// or nil if the listener doesn't accept streams from peers.
+	Allowlist() *Allowlist
+
 	key() string
 
 	// close closes the listener. Does not affect child streams
@@ -23,15 +23,23 @@ type localListener struct {
 	peer  peer.ID
 
 	listener manet.Listener
+
+	usage *Usage
 }
 
-// ForwardLocal creates new P2P stream to a remote listener
-func (p2p *P2P) ForwardLocal(ctx context.Context, peer peer.ID, proto protocol.ID, bindAddr ma.Multiaddr) (Listener, error) {
+// ForwardLocal creates new P2P stream to a remote listener. UDP datagrams are
+// framed over the stream, the remote listener target must be a UDP address too.
+func (p2p *P2P) ForwardLocal(ctx context.Context, peer peer.ID, proto protocol.ID, bindAddr ma.Multiaddr, limits Limits) (Listener, error) {
+	if isUDP(bindAddr) {
+		return p2p.forwardLocalUDP(ctx, peer, proto, bindAddr, limits)
+	}
+
 	listener := &localListener{
 		ctx:   ctx,
 		p2p:   p2p,
 		proto: proto,
 		peer:  peer,
+		usage: newUsage(limits),
 	}
 
 	maListener, err := manet.Listen(bindAddr)
@@ -73,8 +81,16 @@ func (l *localListener) acceptConns() {
 }
 
 func (l *localListener) setupStream(local manet.Conn) {
+	// The remote peer isn't dialed for the connections over the limit
+	if !l.usage.reserve() {
+		local.Close()
+		log.Debugf("rejected connection to %s/%s: too many streams", l.peer.Pretty(), l.proto)
+		return
+	}
+
 	remote, err := l.dial(l.ctx)
 	if err != nil {
+		l.usage.release()
 		local.Close()
 		log.Warnf("failed to dial to remote %s/%s", l.peer.Pretty(), l.proto)
 		return
@@ -91,6 +107,8 @@ func (l *localListener) setupStream(local manet.Conn) {
 		Remote: remote,
 
 		Registry: l.p2p.Streams,
+
+		usage: l.usage,
 	}
 
 	l.p2p.Streams.Register(stream)
@@ -116,6 +134,14 @@ func (l *localListener) TargetAddress() ma.Multiaddr {
 	return addr
 }
 
+func (l *localListener) Usage() *Usage {
+	return l.usage
+}
+
+func (l *localListener) Allowlist() *Allowlist {
+	return nil
+}
+
 func (l *localListener) key() string {
 	return l.ListenAddress().String()
 }
@@ -0,0 +1,379 @@
+package p2p
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	tec "github.com/jbenet/go-temp-err-catcher"
+	inet "github.com/libp2p/go-libp2p-core/network"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/protocol"
+	ma "github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+)
+
+// ProxyDomain is the pseudo top-level domain of the hosts reached through a
+// proxy listener. The host <peer ID>.<name>.p2p is the '/x/<name>' service of
+// the peer.
+const ProxyDomain = "p2p"
+
+// proxyProtocol is the protocol of proxy listeners in listings, as they reach
+// any service in the '/x/' namespace.
+const proxyProtocol = protocol.ID("/x/*")
+
+// proxyHandshakeTimeout is how long a client has to send its request.
+const proxyHandshakeTimeout = 30 * time.Second
+
+// ErrProxyNotLoopback is returned when creating a proxy listener on an address
+// other hosts can connect to, without allowing them to.
+var ErrProxyNotLoopback = errors.New("proxy listen address is not a loopback address")
+
+// errProxyHost is returned for hosts outside of ProxyDomain.
+var errProxyHost = errors.New("host is not of the form <peer ID>.<protocol>." + ProxyDomain)
+
+// SOCKS5 protocol constants, see RFC 1928.
+const (
+	socks5Version = 0x05
+
+	socks5NoAuth       = 0x00
+	socks5NoAcceptable = 0xff
+
+	socks5Connect = 0x01
+
+	socks5AddrIPv4   = 0x01
+	socks5AddrDomain = 0x03
+	socks5AddrIPv6   = 0x04
+
+	socks5Succeeded          = 0x00
+	socks5HostUnreachable    = 0x04
+	socks5CommandUnsupported = 0x07
+	socks5AddrUnsupported    = 0x08
+)
+
+// proxyListener accepts SOCKS5 and HTTP CONNECT proxy connections, and
+// proxies them to the libp2p services of the hosts they request
+type proxyListener struct {
+	ctx context.Context
+
+	p2p *P2P
+
+	laddr ma.Multiaddr
+
+	listener manet.Listener
+
+	usage *Usage
+}
+
+// ForwardProxy creates a new SOCKS5 and HTTP CONNECT proxy listener. Clients
+// reach the '/x/<name>' service of a peer by connecting to the host
+// <peer ID>.<name>.p2p. As anyone connecting to the proxy reaches the
+// services of the peers through this node, it only binds to a loopback address
+// unless allowRemote is set.
+func (p2p *P2P) ForwardProxy(ctx context.Context, bindAddr ma.Multiaddr, allowRemote bool, limits Limits) (Listener, error) {
+	if !allowRemote && !manet.IsIPLoopback(bindAddr) {
+		return nil, ErrProxyNotLoopback
+	}
+
+	maListener, err := manet.Listen(bindAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	listener := &proxyListener{
+		ctx:      ctx,
+		p2p:      p2p,
+		laddr:    maListener.Multiaddr(),
+		listener: maListener,
+		usage:    newUsage(limits),
+	}
+
+	if err := p2p.ListenersLocal.Register(listener); err != nil {
+		maListener.Close()
+		return nil, err
+	}
+
+	go listener.acceptConns()
+
+	return listener, nil
+}
+
+// ParseProxyHost returns the peer and the protocol of a host of the form
+// <peer ID>.<name>.p2p. The peer ID can be encoded as a CID, to fit in a
+// case-insensitive DNS label.
+func ParseProxyHost(host string) (peer.ID, protocol.ID, error) {
+	host = strings.TrimSuffix(host, ".")
+	if !strings.HasSuffix(host, "."+ProxyDomain) {
+		return "", "", errProxyHost
+	}
+	host = strings.TrimSuffix(host, "."+ProxyDomain)
+
+	parts := strings.SplitN(host, ".", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", errProxyHost
+	}
+
+	id, err := peer.Decode(parts[0])
+	if err != nil {
+		return "", "", fmt.Errorf("invalid peer ID %q: %s", parts[0], err)
+	}
+	return id, protocol.ID("/x/" + parts[1]), nil
+}
+
+func (l *proxyListener) acceptConns() {
+	for {
+		local, err := l.listener.Accept()
+		if err != nil {
+			if tec.ErrIsTemporary(err) {
+				continue
+			}
+			return
+		}
+
+		go l.setupStream(local)
+	}
+}
+
+func (l *proxyListener) setupStream(local manet.Conn) {
+	br := bufio.NewReader(local)
+
+	_ = local.SetDeadline(time.Now().Add(proxyHandshakeTimeout))
+	first, err := br.Peek(1)
+	if err != nil {
+		local.Close()
+		return
+	}
+
+	// No peer is dialed for the connections over the limit
+	if !l.usage.reserve() {
+		local.Close()
+		log.Debugf("rejected proxy connection from %s: too many streams", local.RemoteMultiaddr())
+		return
+	}
+
+	var remote inet.Stream
+	if first[0] == socks5Version {
+		remote, err = l.handshakeSOCKS5(local, br)
+	} else {
+		remote, err = l.handshakeHTTP(local, br)
+	}
+	if err != nil {
+		l.usage.release()
+		local.Close()
+		log.Debugf("proxy request from %s failed: %s", local.RemoteMultiaddr(), err)
+		return
+	}
+	_ = local.SetDeadline(time.Time{})
+
+	peer := remote.Conn().RemotePeer()
+	peerMa, err := ma.NewMultiaddr(maPrefix + peer.Pretty())
+	if err != nil {
+		l.usage.release()
+		local.Close()
+		_ = remote.Reset()
+		return
+	}
+
+	stream := &Stream{
+		Protocol: remote.Protocol(),
+
+		OriginAddr: local.RemoteMultiaddr(),
+		TargetAddr: peerMa,
+		peer:       peer,
+
+		Local:  &bufferedConn{Conn: local, r: br},
+		Remote: remote,
+
+		Registry: l.p2p.Streams,
+
+		usage: l.usage,
+	}
+
+	l.p2p.Streams.Register(stream)
+}
+
+// dial opens a stream to the service of the host.
+func (l *proxyListener) dial(host string) (inet.Stream, error) {
+	id, proto, err := ParseProxyHost(host)
+	if err != nil {
+		return nil, err
+	}
+
+	cctx, cancel := context.WithTimeout(l.ctx, time.Second*30) //TODO: configurable?
+	defer cancel()
+
+	return l.p2p.peerHost.NewStream(cctx, id, proto)
+}
+
+// handshakeSOCKS5 answers a SOCKS5 CONNECT request without authentication,
+// and opens the requested stream.
+func (l *proxyListener) handshakeSOCKS5(local io.Writer, br *bufio.Reader) (inet.Stream, error) {
+	// Method selection: version, number of methods, methods.
+	var hdr [2]byte
+	if _, err := io.ReadFull(br, hdr[:]); err != nil {
+		return nil, err
+	}
+	methods := make([]byte, hdr[1])
+	if _, err := io.ReadFull(br, methods); err != nil {
+		return nil, err
+	}
+	method := byte(socks5NoAcceptable)
+	for _, m := range methods {
+		if m == socks5NoAuth {
+			method = socks5NoAuth
+		}
+	}
+	if _, err := local.Write([]byte{socks5Version, method}); err != nil {
+		return nil, err
+	}
+	if method == socks5NoAcceptable {
+		return nil, errors.New("socks5: no supported authentication method")
+	}
+
+	// Request: version, command, reserved, address type, address, port.
+	var req [4]byte
+	if _, err := io.ReadFull(br, req[:]); err != nil {
+		return nil, err
+	}
+	if req[0] != socks5Version {
+		return nil, fmt.Errorf("socks5: unsupported version %d", req[0])
+	}
+
+	var host string
+	switch req[3] {
+	case socks5AddrDomain:
+		size, err := br.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		name := make([]byte, size)
+		if _, err := io.ReadFull(br, name); err != nil {
+			return nil, err
+		}
+		host = string(name)
+	case socks5AddrIPv4:
+		if _, err := br.Discard(net.IPv4len); err != nil {
+			return nil, err
+		}
+	case socks5AddrIPv6:
+		if _, err := br.Discard(net.IPv6len); err != nil {
+			return nil, err
+		}
+	default:
+		_ = socks5Reply(local, socks5AddrUnsupported)
+		return nil, fmt.Errorf("socks5: unsupported address type %d", req[3])
+	}
+	var port [2]byte
+	if _, err := io.ReadFull(br, port[:]); err != nil {
+		return nil, err
+	}
+
+	if req[1] != socks5Connect {
+		_ = socks5Reply(local, socks5CommandUnsupported)
+		return nil, fmt.Errorf("socks5: unsupported command %d", req[1])
+	}
+	if host == "" {
+		// Peers are only reachable by name.
+		_ = socks5Reply(local, socks5AddrUnsupported)
+		return nil, errProxyHost
+	}
+
+	remote, err := l.dial(host)
+	if err != nil {
+		_ = socks5Reply(local, socks5HostUnreachable)
+		return nil, err
+	}
+	if err := socks5Reply(local, socks5Succeeded); err != nil {
+		_ = remote.Reset()
+		return nil, err
+	}
+	return remote, nil
+}
+
+// socks5Reply replies to a SOCKS5 request, with an unspecified bound address.
+func socks5Reply(w io.Writer, status byte) error {
+	reply := []byte{socks5Version, status, 0x00, socks5AddrIPv4, 0, 0, 0, 0, 0, 0}
+	_, err := w.Write(reply)
+	return err
+}
+
+// handshakeHTTP answers an HTTP CONNECT request, and opens the requested
+// stream.
+func (l *proxyListener) handshakeHTTP(local io.Writer, br *bufio.Reader) (inet.Stream, error) {
+	req, err := http.ReadRequest(br)
+	if err != nil {
+		return nil, err
+	}
+	if req.Method != http.MethodConnect {
+		fmt.Fprintf(local, "HTTP/1.1 %d %s\r\nAllow: CONNECT\r\nConnection: close\r\n\r\n",
+			http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+		return nil, fmt.Errorf("http: unsupported method %s", req.Method)
+	}
+
+	host := req.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	remote, err := l.dial(host)
+	if err != nil {
+		fmt.Fprintf(local, "HTTP/1.1 %d %s\r\nConnection: close\r\n\r\n%s\n",
+			http.StatusBadGateway, http.StatusText(http.StatusBadGateway), err)
+		return nil, err
+	}
+	if _, err := fmt.Fprint(local, "HTTP/1.1 200 Connection established\r\n\r\n"); err != nil {
+		_ = remote.Reset()
+		return nil, err
+	}
+	return remote, nil
+}
+
+func (l *proxyListener) close() {
+	l.listener.Close()
+}
+
+func (l *proxyListener) Protocol() protocol.ID {
+	return proxyProtocol
+}
+
+func (l *proxyListener) ListenAddress() ma.Multiaddr {
+	return l.laddr
+}
+
+// TargetAddress is the pseudo domain of the hosts reached through the proxy.
+func (l *proxyListener) TargetAddress() ma.Multiaddr {
+	addr, err := ma.NewMultiaddr("/dns/" + ProxyDomain)
+	if err != nil {
+		panic(err)
+	}
+	return addr
+}
+
+func (l *proxyListener) Usage() *Usage {
+	return l.usage
+}
+
+func (l *proxyListener) Allowlist() *Allowlist {
+	return nil
+}
+
+func (l *proxyListener) key() string {
+	return l.ListenAddress().String()
+}
+
+// bufferedConn reads the bytes buffered while reading the proxy request
+// before the rest of the connection.
+type bufferedConn struct {
+	manet.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
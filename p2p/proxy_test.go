@@ -0,0 +1,233 @@
+package p2p
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	net "github.com/libp2p/go-libp2p-core/network"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	tu "github.com/libp2p/go-libp2p-core/test"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	ma "github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+	mbase "github.com/multiformats/go-multibase"
+)
+
+func TestParseProxyHost(t *testing.T) {
+	id := tu.RandPeerIDFatal(t)
+	base36 := peer.ToCid(id).Encode(mbase.MustNewEncoder(mbase.Base36))
+
+	for _, host := range []string{
+		id.Pretty() + ".ssh.p2p",
+		id.Pretty() + ".ssh.p2p.",
+		base36 + ".ssh.p2p",
+	} {
+		p, proto, err := ParseProxyHost(host)
+		if err != nil {
+			t.Errorf("%s: %s", host, err)
+			continue
+		}
+		if p != id || proto != "/x/ssh" {
+			t.Errorf("%s: unexpected service %s of %s", host, proto, p)
+		}
+	}
+
+	// The name can have dots
+	if _, proto, err := ParseProxyHost(id.Pretty() + ".my.app.p2p"); err != nil || proto != "/x/my.app" {
+		t.Errorf("unexpected protocol %q, %v", proto, err)
+	}
+
+	for _, host := range []string{
+		"",
+		"p2p",
+		"example.com",
+		id.Pretty() + ".p2p",
+		id.Pretty() + "..p2p",
+		".ssh.p2p",
+		"notapeer.ssh.p2p",
+		id.Pretty() + ".ssh.p2p.example.com",
+	} {
+		if _, _, err := ParseProxyHost(host); err == nil {
+			t.Errorf("expected %q to be rejected", host)
+		}
+	}
+}
+
+// newTestProxy returns the address of a proxy listener, and the host name of
+// an echo service of another peer.
+func newTestProxy(ctx context.Context, t *testing.T) (ma.Multiaddr, string) {
+	mn := mocknet.New(ctx)
+	p, to := newTestP2P(t, mn), newTestP2P(t, mn)
+	if err := mn.LinkAll(); err != nil {
+		t.Fatal(err)
+	}
+	if err := mn.ConnectAllButSelf(); err != nil {
+		t.Fatal(err)
+	}
+	to.peerHost.SetStreamHandler("/x/echo", func(s net.Stream) {
+		_, _ = io.Copy(s, s)
+		_ = s.Close()
+	})
+
+	l, err := p.ForwardProxy(ctx, ma.StringCast("/ip4/127.0.0.1/tcp/0"), false, Limits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		p.ListenersLocal.Close(func(Listener) bool { return true })
+	})
+	return l.ListenAddress(), to.identity.Pretty() + ".echo.p2p"
+}
+
+// checkEcho checks that the connection reaches the echo service.
+func checkEcho(t *testing.T, conn io.Writer, r *bufio.Reader) {
+	if _, err := io.WriteString(conn, "hello\n"); err != nil {
+		t.Fatal(err)
+	}
+	line, err := r.ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if line != "hello\n" {
+		t.Fatalf("unexpected echo %q", line)
+	}
+}
+
+func TestProxySOCKS5(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	addr, host := newTestProxy(ctx, t)
+
+	// request sends a CONNECT request for the address, and returns the status
+	// of the reply
+	request := func(conn manet.Conn, r *bufio.Reader, addr []byte) byte {
+		if _, err := conn.Write([]byte{socks5Version, 1, socks5NoAuth}); err != nil {
+			t.Fatal(err)
+		}
+		method := make([]byte, 2)
+		if _, err := io.ReadFull(r, method); err != nil {
+			t.Fatal(err)
+		}
+		if method[0] != socks5Version || method[1] != socks5NoAuth {
+			t.Fatalf("unexpected method selection %x", method)
+		}
+
+		req := append([]byte{socks5Version, socks5Connect, 0x00}, addr...)
+		if _, err := conn.Write(append(req, 0, 22)); err != nil {
+			t.Fatal(err)
+		}
+		reply := make([]byte, 10)
+		if _, err := io.ReadFull(r, reply); err != nil {
+			t.Fatal(err)
+		}
+		return reply[1]
+	}
+
+	conn, err := manet.Dial(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	domain := append([]byte{socks5AddrDomain, byte(len(host))}, host...)
+	if status := request(conn, r, domain); status != socks5Succeeded {
+		t.Fatalf("unexpected status %d", status)
+	}
+	checkEcho(t, conn, r)
+
+	// Peers are only reachable by name
+	conn, err = manet.Dial(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if status := request(conn, bufio.NewReader(conn), []byte{socks5AddrIPv4, 127, 0, 0, 1}); status != socks5AddrUnsupported {
+		t.Fatalf("unexpected status %d for an IP address", status)
+	}
+
+	// and must run the service
+	conn, err = manet.Dial(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	missing := strings.Replace(host, ".echo.", ".missing.", 1)
+	domain = append([]byte{socks5AddrDomain, byte(len(missing))}, missing...)
+	if status := request(conn, bufio.NewReader(conn), domain); status != socks5HostUnreachable {
+		t.Fatalf("unexpected status %d for a missing service", status)
+	}
+}
+
+func TestProxyHTTP(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	addr, host := newTestProxy(ctx, t)
+
+	// request sends the request line, and returns the status line of the
+	// response once its headers are read
+	request := func(conn manet.Conn, r *bufio.Reader, line string) string {
+		if _, err := io.WriteString(conn, line+"\r\nHost: "+host+":80\r\n\r\n"); err != nil {
+			t.Fatal(err)
+		}
+		status, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		for {
+			header, err := r.ReadString('\n')
+			if err != nil {
+				t.Fatal(err)
+			}
+			if header == "\r\n" {
+				break
+			}
+		}
+		return strings.TrimSpace(status)
+	}
+
+	conn, err := manet.Dial(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	if status := request(conn, r, "CONNECT "+host+":80 HTTP/1.1"); status != "HTTP/1.1 200 Connection established" {
+		t.Fatalf("unexpected status %q", status)
+	}
+	checkEcho(t, conn, r)
+
+	missing := strings.Replace(host, ".echo.", ".missing.", 1)
+	for line, expected := range map[string]string{
+		"GET http://" + host + "/ HTTP/1.1":   "HTTP/1.1 405 Method Not Allowed",
+		"CONNECT example.com:443 HTTP/1.1":    "HTTP/1.1 502 Bad Gateway",
+		"CONNECT " + missing + ":80 HTTP/1.1": "HTTP/1.1 502 Bad Gateway",
+	} {
+		conn, err := manet.Dial(addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status := request(conn, bufio.NewReader(conn), line); status != expected {
+			t.Errorf("%s: unexpected status %q", line, status)
+		}
+		conn.Close()
+	}
+}
+
+func TestProxyLoopback(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	p := newTestP2P(t, mocknet.New(ctx))
+
+	all := ma.StringCast("/ip4/0.0.0.0/tcp/0")
+	if _, err := p.ForwardProxy(ctx, all, false, Limits{}); err != ErrProxyNotLoopback {
+		t.Fatalf("expected ErrProxyNotLoopback, got %v", err)
+	}
+	l, err := p.ForwardProxy(ctx, all, true, Limits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.ListenersLocal.Close(func(ll Listener) bool { return ll == l })
+}
@@ -2,6 +2,7 @@ package p2p
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
 	net "github.com/libp2p/go-libp2p-core/network"
@@ -25,10 +26,24 @@ type remoteListener struct {
 	// reportRemote if set to true makes the handler send '<base58 remote peerid>\n'
 	// to target before any data is forwarded
 	reportRemote bool
+
+	// allow restricts the peers that can open streams to the listener
+	allow *Allowlist
+
+	usage *Usage
 }
 
 // ForwardRemote creates new p2p listener
-func (p2p *P2P) ForwardRemote(ctx context.Context, proto protocol.ID, addr ma.Multiaddr, reportRemote bool) (Listener, error) {
+func (p2p *P2P) ForwardRemote(ctx context.Context, proto protocol.ID, addr ma.Multiaddr, reportRemote bool, allow *Allowlist, limits Limits) (Listener, error) {
+	// The peer ID would be sent as a datagram of its own, that the target
+	// can't tell from the datagrams of the peer
+	if reportRemote && isUDP(addr) {
+		return nil, errors.New("the peer ID can't be reported to a UDP target")
+	}
+	if allow == nil {
+		allow, _ = NewAllowlist(nil, "")
+	}
+
 	listener := &remoteListener{
 		p2p: p2p,
 
@@ -36,6 +51,8 @@ func (p2p *P2P) ForwardRemote(ctx context.Context, proto protocol.ID, addr ma.Mu
 		addr:  addr,
 
 		reportRemote: reportRemote,
+		allow:        allow,
+		usage:        newUsage(limits),
 	}
 
 	if err := p2p.ListenersP2P.Register(listener); err != nil {
@@ -46,25 +63,46 @@ func (p2p *P2P) ForwardRemote(ctx context.Context, proto protocol.ID, addr ma.Mu
 }
 
 func (l *remoteListener) handleStream(remote net.Stream) {
-	local, err := manet.Dial(l.addr)
+	peer := remote.Conn().RemotePeer()
+
+	if !l.allow.Allowed(peer) {
+		log.Debugf("rejected stream from %s to %s: peer not allowed", peer.Pretty(), l.proto)
+		_ = remote.Reset()
+		return
+	}
+
+	// The target isn't dialed for the streams over the limit
+	if !l.usage.reserve() {
+		log.Debugf("rejected stream from %s to %s: too many streams", peer.Pretty(), l.proto)
+		_ = remote.Reset()
+		return
+	}
+
+	peerMa, err := ma.NewMultiaddr(maPrefix + peer.Pretty())
 	if err != nil {
+		l.usage.release()
 		_ = remote.Reset()
 		return
 	}
 
-	peer := remote.Conn().RemotePeer()
+	local, err := manet.Dial(l.addr)
+	if err != nil {
+		l.usage.release()
+		_ = remote.Reset()
+		return
+	}
 
 	if l.reportRemote {
 		if _, err := fmt.Fprintf(local, "%s\n", peer.Pretty()); err != nil {
+			l.usage.release()
+			_ = local.Close()
 			_ = remote.Reset()
 			return
 		}
 	}
 
-	peerMa, err := ma.NewMultiaddr(maPrefix + peer.Pretty())
-	if err != nil {
-		_ = remote.Reset()
-		return
+	if isUDP(l.addr) {
+		local = newUDPConn(local)
 	}
 
 	stream := &Stream{
@@ -78,6 +116,8 @@ func (l *remoteListener) handleStream(remote net.Stream) {
 		Remote: remote,
 
 		Registry: l.p2p.Streams,
+
+		usage: l.usage,
 	}
 
 	l.p2p.Streams.Register(stream)
@@ -99,6 +139,14 @@ func (l *remoteListener) TargetAddress() ma.Multiaddr {
 	return l.addr
 }
 
+func (l *remoteListener) Usage() *Usage {
+	return l.usage
+}
+
+func (l *remoteListener) Allowlist() *Allowlist {
+	return l.allow
+}
+
 func (l *remoteListener) close() {}
 
 func (l *remoteListener) key() string {
@@ -18,6 +18,9 @@ const cmgrTag = "stream-fwd"
 type Stream struct {
 	id uint64
 
+	// Traffic counts the bytes carried by the stream
+	Traffic
+
 	Protocol protocol.ID
 
 	OriginAddr ma.Multiaddr
@@ -28,6 +31,9 @@ type Stream struct {
 	Remote net.Stream
 
 	Registry *StreamRegistry
+
+	// usage of the listener of the stream, may be nil
+	usage *Usage
 }
 
 // close stream endpoints and deregister it
@@ -41,8 +47,17 @@ func (s *Stream) reset() {
 }
 
 func (s *Stream) startStreaming() {
+	in := &meteredReader{r: s.Remote, counters: []*int64{&s.in}}
+	out := &meteredReader{r: s.Local, counters: []*int64{&s.out}}
+	if s.usage != nil {
+		in.counters = append(in.counters, &s.usage.in)
+		in.limit = s.usage.inLimit
+		out.counters = append(out.counters, &s.usage.out)
+		out.limit = s.usage.outLimit
+	}
+
 	go func() {
-		_, err := io.Copy(s.Local, s.Remote)
+		_, err := io.Copy(s.Local, in)
 		if err != nil {
 			s.reset()
 		} else {
@@ -51,7 +66,7 @@ func (s *Stream) startStreaming() {
 	}()
 
 	go func() {
-		_, err := io.Copy(s.Remote, s.Local)
+		_, err := io.Copy(s.Remote, out)
 		if err != nil {
 			s.reset()
 		} else {
@@ -71,7 +86,8 @@ type StreamRegistry struct {
 	ifconnmgr.ConnManager
 }
 
-// Register registers a stream to the registry
+// Register registers a stream to the registry. A stream with a usage must
+// hold a slot reserved in it, freed when the stream is deregistered.
 func (r *StreamRegistry) Register(streamInfo *Stream) {
 	r.Lock()
 	defer r.Unlock()
@@ -102,6 +118,10 @@ func (r *StreamRegistry) Deregister(streamID uint64) {
 		r.ConnManager.UntagPeer(p, cmgrTag)
 	}
 
+	if s.usage != nil {
+		s.usage.release()
+	}
+
 	delete(r.Streams, streamID)
 }
 
@@ -0,0 +1,404 @@
+package p2p
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	tec "github.com/jbenet/go-temp-err-catcher"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/protocol"
+	ma "github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+)
+
+// UDPIdleTimeout is how long a UDP flow is kept open without any datagram in
+// either direction. A flow is the datagrams exchanged with one source address,
+// and is forwarded over its own libp2p stream.
+const UDPIdleTimeout = time.Minute
+
+// udpFlowQueue is the number of datagrams queued per flow while its stream is
+// being opened. Datagrams are dropped when the queue is full.
+const udpFlowQueue = 64
+
+// maxDatagramSize is the size of the largest datagram. The frames of the
+// datagrams are prefixed with their size as a 16-bit big-endian integer.
+const maxDatagramSize = 1<<16 - 1
+
+// isUDP returns whether the address is a UDP address
+func isUDP(addr ma.Multiaddr) bool {
+	_, err := addr.ValueForProtocol(ma.P_UDP)
+	return err == nil
+}
+
+// framer converts datagrams to and from the frames sent over libp2p streams.
+type framer struct {
+	// rbuf is the rest of the frame being read
+	rbuf []byte
+	// wbuf is the start of the frame being written
+	wbuf []byte
+}
+
+// read reads the frames of the datagrams returned by next.
+func (f *framer) read(p []byte, next func() ([]byte, error)) (int, error) {
+	if len(f.rbuf) == 0 {
+		d, err := next()
+		if err != nil {
+			return 0, err
+		}
+		frame := make([]byte, 2+len(d))
+		binary.BigEndian.PutUint16(frame, uint16(len(d)))
+		copy(frame[2:], d)
+		f.rbuf = frame
+	}
+	n := copy(p, f.rbuf)
+	f.rbuf = f.rbuf[n:]
+	return n, nil
+}
+
+// write writes frames, and calls emit with the datagram of each complete
+// frame.
+func (f *framer) write(p []byte, emit func([]byte) error) (int, error) {
+	f.wbuf = append(f.wbuf, p...)
+	frames := f.wbuf
+	for len(frames) >= 2 {
+		size := int(binary.BigEndian.Uint16(frames))
+		if len(frames) < 2+size {
+			break
+		}
+		if err := emit(frames[2 : 2+size]); err != nil {
+			return 0, err
+		}
+		frames = frames[2+size:]
+	}
+	f.wbuf = append(f.wbuf[:0], frames...)
+	return len(p), nil
+}
+
+// activity records when a flow last carried a datagram.
+type activity struct {
+	last int64
+}
+
+func (a *activity) touch() {
+	atomic.StoreInt64(&a.last, time.Now().UnixNano())
+}
+
+// idleFor returns for how long the flow carried no datagram.
+func (a *activity) idleFor() time.Duration {
+	return time.Since(time.Unix(0, atomic.LoadInt64(&a.last)))
+}
+
+// udpConn frames the datagrams exchanged with a connected UDP socket. Reads
+// return io.EOF once the flow is idle.
+type udpConn struct {
+	activity
+	framer
+	manet.Conn
+
+	buf []byte
+}
+
+func newUDPConn(conn manet.Conn) *udpConn {
+	c := &udpConn{
+		Conn: conn,
+		buf:  make([]byte, maxDatagramSize),
+	}
+	c.touch()
+	return c
+}
+
+func (c *udpConn) Read(p []byte) (int, error) {
+	return c.framer.read(p, func() ([]byte, error) {
+		for {
+			if err := c.Conn.SetReadDeadline(time.Now().Add(UDPIdleTimeout - c.idleFor())); err != nil {
+				return nil, err
+			}
+			n, err := c.Conn.Read(c.buf)
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				if c.idleFor() < UDPIdleTimeout {
+					continue
+				}
+				return nil, io.EOF
+			}
+			if err != nil {
+				return nil, err
+			}
+			c.touch()
+			return c.buf[:n], nil
+		}
+	})
+}
+
+func (c *udpConn) Write(p []byte) (int, error) {
+	return c.framer.write(p, func(d []byte) error {
+		c.touch()
+		_, err := c.Conn.Write(d)
+		return err
+	})
+}
+
+// udpListener listens for UDP datagrams and forwards each flow over a new
+// libp2p stream to a remote listener
+type udpListener struct {
+	ctx context.Context
+
+	p2p *P2P
+
+	proto protocol.ID
+	laddr ma.Multiaddr
+	peer  peer.ID
+
+	conn net.PacketConn
+
+	usage *Usage
+
+	mu    sync.Mutex
+	flows map[string]*udpFlow
+}
+
+// forwardLocalUDP creates a new UDP listener forwarding datagrams to a remote
+// listener
+func (p2p *P2P) forwardLocalUDP(ctx context.Context, peer peer.ID, proto protocol.ID, bindAddr ma.Multiaddr, limits Limits) (Listener, error) {
+	conn, err := manet.ListenPacket(bindAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	laddr, err := manet.FromNetAddr(conn.LocalAddr())
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	listener := &udpListener{
+		ctx:   ctx,
+		p2p:   p2p,
+		proto: proto,
+		laddr: laddr,
+		peer:  peer,
+		conn:  conn,
+		usage: newUsage(limits),
+		flows: map[string]*udpFlow{},
+	}
+
+	if err := p2p.ListenersLocal.Register(listener); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	go listener.serve()
+
+	return listener, nil
+}
+
+func (l *udpListener) serve() {
+	buf := make([]byte, maxDatagramSize)
+	for {
+		n, addr, err := l.conn.ReadFrom(buf)
+		if err != nil {
+			if tec.ErrIsTemporary(err) {
+				continue
+			}
+			return
+		}
+
+		if f := l.flow(addr); f != nil {
+			f.deliver(buf[:n])
+		} else {
+			log.Debugf("dropped datagram from %s: too many streams", addr)
+		}
+	}
+}
+
+// flow returns the flow of the source address, opening a stream for it if
+// it's new. It returns nil when the listener has reached its maximum number
+// of streams.
+func (l *udpListener) flow(addr net.Addr) *udpFlow {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	key := addr.String()
+	if f, ok := l.flows[key]; ok {
+		return f
+	}
+
+	// Datagrams over the limit don't start a flow, that would dial the
+	// remote peer
+	if !l.usage.reserve() {
+		return nil
+	}
+
+	f := &udpFlow{
+		l:      l,
+		addr:   addr,
+		in:     make(chan []byte, udpFlowQueue),
+		closed: make(chan struct{}),
+	}
+	f.touch()
+	l.flows[key] = f
+
+	go l.setupStream(f)
+	return f
+}
+
+func (l *udpListener) setupStream(f *udpFlow) {
+	cctx, cancel := context.WithTimeout(l.ctx, time.Second*30) //TODO: configurable?
+	defer cancel()
+
+	remote, err := l.p2p.peerHost.NewStream(cctx, l.peer, l.proto)
+	if err != nil {
+		l.usage.release()
+		f.Close()
+		log.Warnf("failed to dial to remote %s/%s", l.peer.Pretty(), l.proto)
+		return
+	}
+
+	stream := &Stream{
+		Protocol: l.proto,
+
+		OriginAddr: f.RemoteMultiaddr(),
+		TargetAddr: l.TargetAddress(),
+		peer:       l.peer,
+
+		Local:  f,
+		Remote: remote,
+
+		Registry: l.p2p.Streams,
+
+		usage: l.usage,
+	}
+
+	l.p2p.Streams.Register(stream)
+}
+
+func (l *udpListener) close() {
+	l.conn.Close()
+}
+
+func (l *udpListener) Protocol() protocol.ID {
+	return l.proto
+}
+
+func (l *udpListener) ListenAddress() ma.Multiaddr {
+	return l.laddr
+}
+
+func (l *udpListener) TargetAddress() ma.Multiaddr {
+	addr, err := ma.NewMultiaddr(maPrefix + l.peer.Pretty())
+	if err != nil {
+		panic(err)
+	}
+	return addr
+}
+
+func (l *udpListener) Usage() *Usage {
+	return l.usage
+}
+
+func (l *udpListener) Allowlist() *Allowlist {
+	return nil
+}
+
+func (l *udpListener) key() string {
+	return l.ListenAddress().String()
+}
+
+// udpFlow is the manet.Conn of the datagrams received by a udpListener from
+// one source address. Reads return io.EOF once the flow is idle.
+type udpFlow struct {
+	activity
+	framer
+
+	l    *udpListener
+	addr net.Addr
+
+	in        chan []byte
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// deliver queues a datagram received from the source address.
+func (f *udpFlow) deliver(d []byte) {
+	d = append([]byte(nil), d...)
+	select {
+	case f.in <- d:
+		f.touch()
+	default:
+		log.Debugf("dropped datagram from %s: queue full", f.addr)
+	}
+}
+
+func (f *udpFlow) Read(p []byte) (int, error) {
+	return f.framer.read(p, func() ([]byte, error) {
+		timer := time.NewTimer(UDPIdleTimeout - f.idleFor())
+		defer timer.Stop()
+		for {
+			select {
+			case d := <-f.in:
+				return d, nil
+			case <-f.closed:
+				return nil, io.EOF
+			case <-timer.C:
+				idle := f.idleFor()
+				if idle < UDPIdleTimeout {
+					timer.Reset(UDPIdleTimeout - idle)
+					continue
+				}
+				return nil, io.EOF
+			}
+		}
+	})
+}
+
+func (f *udpFlow) Write(p []byte) (int, error) {
+	return f.framer.write(p, func(d []byte) error {
+		f.touch()
+		_, err := f.l.conn.WriteTo(d, f.addr)
+		return err
+	})
+}
+
+// Close removes the flow from the listener. The next datagram from the source
+// address starts a new flow.
+func (f *udpFlow) Close() error {
+	f.closeOnce.Do(func() {
+		close(f.closed)
+
+		f.l.mu.Lock()
+		if f.l.flows[f.addr.String()] == f {
+			delete(f.l.flows, f.addr.String())
+		}
+		f.l.mu.Unlock()
+	})
+	return nil
+}
+
+func (f *udpFlow) LocalAddr() net.Addr {
+	return f.l.conn.LocalAddr()
+}
+
+func (f *udpFlow) RemoteAddr() net.Addr {
+	return f.addr
+}
+
+func (f *udpFlow) LocalMultiaddr() ma.Multiaddr {
+	return f.l.laddr
+}
+
+func (f *udpFlow) RemoteMultiaddr() ma.Multiaddr {
+	addr, err := manet.FromNetAddr(f.addr)
+	if err != nil {
+		return nil
+	}
+	return addr
+}
+
+// Deadlines are not supported, flows end when idle.
+func (f *udpFlow) SetDeadline(t time.Time) error      { return nil }
+func (f *udpFlow) SetReadDeadline(t time.Time) error  { return nil }
+func (f *udpFlow) SetWriteDeadline(t time.Time) error { return nil }
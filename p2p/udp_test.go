@@ -0,0 +1,157 @@
+package p2p
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	ma "github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+)
+
+func TestFramer(t *testing.T) {
+	datagrams := [][]byte{[]byte("hello"), {}, bytes.Repeat([]byte{1}, 300)}
+
+	// Frames are read through buffers smaller than a frame
+	var r framer
+	next := 0
+	var frames []byte
+	buf := make([]byte, 3)
+	for {
+		n, err := r.read(buf, func() ([]byte, error) {
+			if next == len(datagrams) {
+				return nil, io.EOF
+			}
+			next++
+			return datagrams[next-1], nil
+		})
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		frames = append(frames, buf[:n]...)
+	}
+	if len(frames) != 3*2+5+300 || !bytes.Equal(frames[:7], []byte("\x00\x05hello")) {
+		t.Fatalf("unexpected frames %x", frames)
+	}
+
+	// and written split at any byte, or several at once
+	for _, split := range []int{1, 2, 4, 7, 8, len(frames)} {
+		var w framer
+		var got [][]byte
+		emit := func(d []byte) error {
+			got = append(got, append([]byte(nil), d...))
+			return nil
+		}
+		for rest := frames; len(rest) > 0; {
+			n := split
+			if n > len(rest) {
+				n = len(rest)
+			}
+			if written, err := w.write(rest[:n], emit); err != nil || written != n {
+				t.Fatalf("write returned %d, %v", written, err)
+			}
+			rest = rest[n:]
+		}
+		if len(got) != len(datagrams) {
+			t.Fatalf("split %d: expected %d datagrams, got %d", split, len(datagrams), len(got))
+		}
+		for i := range got {
+			if !bytes.Equal(got[i], datagrams[i]) {
+				t.Fatalf("split %d: unexpected datagram %d %x", split, i, got[i])
+			}
+		}
+	}
+}
+
+func TestUDPFlowIdle(t *testing.T) {
+	f := &udpFlow{
+		in:     make(chan []byte, udpFlowQueue),
+		closed: make(chan struct{}),
+	}
+	f.touch()
+
+	// A queued datagram is read, and keeps the flow open
+	f.deliver([]byte("ping"))
+	buf := make([]byte, 16)
+	n, err := f.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf[:n]) != "\x00\x04ping" {
+		t.Fatalf("unexpected frame %q", buf[:n])
+	}
+
+	// The flow ends once idle for UDPIdleTimeout
+	f.last = time.Now().Add(-UDPIdleTimeout).UnixNano()
+	if _, err := f.Read(buf); err != io.EOF {
+		t.Fatalf("expected io.EOF from an idle flow, got %v", err)
+	}
+}
+
+func TestUDPConnIdle(t *testing.T) {
+	target, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer target.Close()
+	taddr, err := manet.FromNetAddr(target.LocalAddr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := manet.Dial(taddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	c := newUDPConn(conn)
+
+	// Frames written to the conn are sent as datagrams, and the replies
+	// read as frames
+	if _, err := c.Write([]byte("\x00\x04ping")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 16)
+	n, from, err := target.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf[:n]) != "ping" {
+		t.Fatalf("unexpected datagram %q", buf[:n])
+	}
+	if _, err := target.WriteTo([]byte("pong"), from); err != nil {
+		t.Fatal(err)
+	}
+	if n, err = c.Read(buf); err != nil {
+		t.Fatal(err)
+	}
+	if string(buf[:n]) != "\x00\x04pong" {
+		t.Fatalf("unexpected frame %q", buf[:n])
+	}
+
+	// The conn ends once idle for UDPIdleTimeout
+	c.last = time.Now().Add(-UDPIdleTimeout).UnixNano()
+	if _, err := c.Read(buf); err != io.EOF {
+		t.Fatalf("expected io.EOF from an idle conn, got %v", err)
+	}
+}
+
+func TestUDPReportPeerID(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	p := newTestP2P(t, mocknet.New(ctx))
+
+	target := ma.StringCast("/ip4/127.0.0.1/udp/53")
+	if _, err := p.ForwardRemote(ctx, "/x/dns", target, true, nil, Limits{}); err == nil {
+		t.Fatal("expected reporting the peer ID to a UDP target to be rejected")
+	}
+	if _, err := p.ForwardRemote(ctx, "/x/dns", target, false, nil, Limits{}); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,154 @@
+package p2p
+
+import (
+	"io"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Limits restricts the streams of a listener.
+type Limits struct {
+	// MaxStreams is the maximum number of concurrent streams. Zero means no
+	// limit.
+	MaxStreams int
+
+	// Bandwidth is the maximum number of bytes per second in each direction,
+	// shared by the streams. Zero means no limit.
+	Bandwidth int64
+}
+
+// Traffic counts the bytes carried by streams. Bytes in are received from the
+// remote peer, bytes out are sent to it.
+type Traffic struct {
+	in  int64
+	out int64
+}
+
+// BytesIn returns the number of bytes received from the remote peer.
+func (t *Traffic) BytesIn() int64 {
+	return atomic.LoadInt64(&t.in)
+}
+
+// BytesOut returns the number of bytes sent to the remote peer.
+func (t *Traffic) BytesOut() int64 {
+	return atomic.LoadInt64(&t.out)
+}
+
+// Usage holds the limits of the streams of a listener, and counts their
+// traffic.
+type Usage struct {
+	Traffic
+
+	// streams counts the open streams, and the ones being opened
+	streams int64
+
+	limits Limits
+	// inLimit and outLimit are nil without bandwidth limit
+	inLimit  *rateLimiter
+	outLimit *rateLimiter
+}
+
+func newUsage(limits Limits) *Usage {
+	return &Usage{
+		limits:   limits,
+		inLimit:  newRateLimiter(limits.Bandwidth),
+		outLimit: newRateLimiter(limits.Bandwidth),
+	}
+}
+
+// Streams returns the number of open streams, including the ones being
+// opened.
+func (u *Usage) Streams() int {
+	return int(atomic.LoadInt64(&u.streams))
+}
+
+// reserve takes a slot for a new stream before dialing either side, and
+// returns false when the listener has reached its maximum number of streams.
+// The slot is freed when the stream is deregistered, or with release if the
+// stream couldn't be opened.
+func (u *Usage) reserve() bool {
+	for {
+		n := atomic.LoadInt64(&u.streams)
+		if u.limits.MaxStreams > 0 && n >= int64(u.limits.MaxStreams) {
+			return false
+		}
+		if atomic.CompareAndSwapInt64(&u.streams, n, n+1) {
+			return true
+		}
+	}
+}
+
+// release frees a slot taken with reserve.
+func (u *Usage) release() {
+	atomic.AddInt64(&u.streams, -1)
+}
+
+// Limits returns the limits of the streams.
+func (u *Usage) Limits() Limits {
+	return u.limits
+}
+
+// rateLimiter spreads the bytes carried by streams over time to stay under a
+// rate, allowing bursts of up to a second of traffic.
+type rateLimiter struct {
+	mu sync.Mutex
+
+	// rate is in bytes per second
+	rate float64
+	// avail is negative when the bytes taken went over the rate
+	avail float64
+	last  time.Time
+}
+
+func newRateLimiter(rate int64) *rateLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	return &rateLimiter{
+		rate:  float64(rate),
+		avail: float64(rate),
+		last:  time.Now(),
+	}
+}
+
+// take takes n bytes, and returns how long to wait before using them.
+func (l *rateLimiter) take(n int) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.avail = math.Min(l.rate, l.avail+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+
+	l.avail -= float64(n)
+	if l.avail >= 0 {
+		return 0
+	}
+	return time.Duration(-l.avail / l.rate * float64(time.Second))
+}
+
+// meteredReader counts the bytes read in the counters, and slows down to
+// stay under the rate of limit if not nil.
+type meteredReader struct {
+	r        io.Reader
+	counters []*int64
+	limit    *rateLimiter
+}
+
+func (m *meteredReader) Read(p []byte) (int, error) {
+	if m.limit != nil && float64(len(p)) > m.limit.rate {
+		// Don't read more than a second worth of bytes at once.
+		p = p[:int(m.limit.rate)]
+	}
+
+	n, err := m.r.Read(p)
+	for _, c := range m.counters {
+		atomic.AddInt64(c, int64(n))
+	}
+	if m.limit != nil && n > 0 {
+		time.Sleep(m.limit.take(n))
+	}
+	return n, err
+}
@@ -0,0 +1,158 @@
+package p2p
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	net "github.com/libp2p/go-libp2p-core/network"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	ma "github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+)
+
+func TestRateLimiter(t *testing.T) {
+	if newRateLimiter(0) != nil {
+		t.Fatal("expected no rate limiter without bandwidth limit")
+	}
+
+	l := newRateLimiter(1000)
+
+	// A second of traffic is taken at once
+	if wait := l.take(1000); wait != 0 {
+		t.Fatalf("expected no wait for a burst of a second, got %s", wait)
+	}
+	// then the bytes over the rate are spread over time
+	if wait := l.take(500); wait <= 400*time.Millisecond || wait > 500*time.Millisecond {
+		t.Fatalf("expected a wait of about 500ms, got %s", wait)
+	}
+
+	// Idle time makes bytes available again, up to a second of traffic
+	l.last = l.last.Add(-10 * time.Second)
+	if wait := l.take(1000); wait != 0 {
+		t.Fatalf("expected no wait after idling, got %s", wait)
+	}
+	if wait := l.take(100); wait <= 50*time.Millisecond || wait > 100*time.Millisecond {
+		t.Fatalf("expected a wait of about 100ms, got %s", wait)
+	}
+}
+
+func TestMeteredReader(t *testing.T) {
+	var count int64
+	m := &meteredReader{
+		r:        bytes.NewReader(make([]byte, 300)),
+		counters: []*int64{&count},
+		limit:    newRateLimiter(100),
+	}
+
+	// Reads are cut to a second of traffic
+	n, err := m.Read(make([]byte, 300))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 100 || count != 100 {
+		t.Fatalf("expected a read of 100 bytes, got %d, counted %d", n, count)
+	}
+}
+
+func TestUsageReserve(t *testing.T) {
+	u := newUsage(Limits{MaxStreams: 2})
+	if !u.reserve() || !u.reserve() {
+		t.Fatal("expected 2 slots to be reserved")
+	}
+	if u.reserve() {
+		t.Fatal("expected no slot over the limit")
+	}
+	u.release()
+	if !u.reserve() || u.Streams() != 2 {
+		t.Fatalf("expected a released slot to be reserved again, %d streams", u.Streams())
+	}
+
+	unlimited := newUsage(Limits{})
+	for i := 0; i < 100; i++ {
+		if !unlimited.reserve() {
+			t.Fatal("expected no limit without MaxStreams")
+		}
+	}
+}
+
+func TestMaxStreams(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mn := mocknet.New(ctx)
+	p, from := newTestP2P(t, mn), newTestP2P(t, mn)
+	if err := mn.LinkAll(); err != nil {
+		t.Fatal(err)
+	}
+	if err := mn.ConnectAllButSelf(); err != nil {
+		t.Fatal(err)
+	}
+
+	target, err := manet.Listen(ma.StringCast("/ip4/127.0.0.1/tcp/0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer target.Close()
+	accepted := make(chan manet.Conn, 2)
+	go func() {
+		for {
+			conn, err := target.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- conn
+		}
+	}()
+
+	l, err := p.ForwardRemote(ctx, "/x/test", target.Multiaddr(), false, nil, Limits{MaxStreams: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	open := func() net.Stream {
+		s, err := from.peerHost.NewStream(ctx, p.identity, "/x/test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.Write([]byte("hello")); err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	first := open()
+	defer first.Close()
+	var conn manet.Conn
+	select {
+	case conn = <-accepted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("target not dialed")
+	}
+
+	// A stream over the limit is reset without dialing the target
+	second := open()
+	_ = second.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := second.Read(make([]byte, 1)); err == nil || err == io.EOF {
+		t.Fatalf("expected the stream over the limit to be reset, got %v", err)
+	}
+	select {
+	case <-accepted:
+		t.Fatal("target dialed for a stream over the limit")
+	case <-time.After(100 * time.Millisecond):
+	}
+	if n := l.Usage().Streams(); n != 1 {
+		t.Fatalf("expected 1 stream, got %d", n)
+	}
+
+	// Closing a stream frees its slot
+	conn.Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for l.Usage().Streams() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected no stream once closed, got %d", l.Usage().Streams())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
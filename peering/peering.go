@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"math/rand"
+	"sort"
 	"sync"
 	"time"
 
@@ -50,6 +51,8 @@ type peerHandler struct {
 	mu             sync.Mutex
 	addrs          []multiaddr.Multiaddr
 	reconnectTimer *time.Timer
+	// nextRetry is when the reconnectTimer fires.
+	nextRetry time.Time
 
 	nextDelay time.Duration
 }
@@ -112,7 +115,9 @@ func (ph *peerHandler) reconnect() {
 		if ph.reconnectTimer != nil {
 			// Only counts if the reconnectTimer still exists. If not, a
 			// connection _was_ somehow established.
-			ph.reconnectTimer.Reset(ph.nextBackoff())
+			delay := ph.nextBackoff()
+			ph.reconnectTimer.Reset(delay)
+			ph.nextRetry = time.Now().Add(delay)
 		}
 		// Otherwise, someone else has stopped us so we can assume that
 		// we're either connected or someone else will start us.
@@ -144,10 +149,54 @@ func (ph *peerHandler) startIfDisconnected() {
 	if ph.reconnectTimer == nil && ph.host.Network().Connectedness(ph.peer) != network.Connected {
 		logger.Debugw("disconnected from peer", "peer", ph.peer)
 		// Always start with a short timeout so we can stagger things a bit.
-		ph.reconnectTimer = time.AfterFunc(ph.nextBackoff(), ph.reconnect)
+		delay := ph.nextBackoff()
+		ph.reconnectTimer = time.AfterFunc(delay, ph.reconnect)
+		ph.nextRetry = time.Now().Add(delay)
 	}
 }
 
+// PeerState is the state of the connection to a peer of the peering service.
+type PeerState string
+
+const (
+	// PeerConnected means the peer is connected.
+	PeerConnected PeerState = "connected"
+	// PeerBackoff means the peer is disconnected, and a reconnection is
+	// scheduled.
+	PeerBackoff PeerState = "backoff"
+	// PeerDisconnected means the peer is disconnected, and no reconnection
+	// is scheduled: the service is not running.
+	PeerDisconnected PeerState = "disconnected"
+)
+
+// PeerInfo describes a peer of the peering service.
+type PeerInfo struct {
+	peer.AddrInfo
+	State PeerState
+	// NextRetry is when the service tries to reconnect to the peer, in the
+	// backoff state.
+	NextRetry time.Time
+}
+
+// info returns the state of the peer.
+func (ph *peerHandler) info() PeerInfo {
+	ph.mu.Lock()
+	defer ph.mu.Unlock()
+
+	info := PeerInfo{
+		AddrInfo: peer.AddrInfo{ID: ph.peer, Addrs: append([]multiaddr.Multiaddr(nil), ph.addrs...)},
+		State:    PeerDisconnected,
+	}
+	switch {
+	case ph.host.Network().Connectedness(ph.peer) == network.Connected:
+		info.State = PeerConnected
+	case ph.reconnectTimer != nil:
+		info.State = PeerBackoff
+		info.NextRetry = ph.nextRetry
+	}
+	return info
+}
+
 // PeeringService maintains connections to specified peers, reconnecting on
 // disconnect with a back-off.
 type PeeringService struct {
@@ -258,6 +307,21 @@ func (ps *PeeringService) RemovePeer(id peer.ID) {
 	}
 }
 
+// ListPeers returns the peers of the peering service, sorted by ID.
+func (ps *PeeringService) ListPeers() []PeerInfo {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+
+	peers := make([]PeerInfo, 0, len(ps.peers))
+	for _, handler := range ps.peers {
+		peers = append(peers, handler.info())
+	}
+	sort.Slice(peers, func(i, j int) bool {
+		return peers[i].ID < peers[j].ID
+	})
+	return peers
+}
+
 type netNotifee PeeringService
 
 func (nn *netNotifee) Connected(_ network.Network, c network.Conn) {
@@ -163,3 +163,50 @@ func TestNextBackoff(t *testing.T) {
 		}
 	}
 }
+
+func TestListPeers(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	h1 := newNode(ctx, t)
+	ps1 := NewPeeringService(h1)
+
+	h2 := newNode(ctx, t)
+	// h3 is not reachable
+	h3 := newNode(ctx, t)
+	h3addrs := h3.Addrs()
+	require.NoError(t, h3.Close())
+
+	ps1.AddPeer(peer.AddrInfo{ID: h2.ID(), Addrs: h2.Addrs()})
+	ps1.AddPeer(peer.AddrInfo{ID: h3.ID(), Addrs: h3addrs})
+
+	peers := ps1.ListPeers()
+	require.Len(t, peers, 2)
+	for _, p := range peers {
+		require.Equal(t, PeerDisconnected, p.State, "peers are disconnected until the service starts")
+	}
+
+	require.NoError(t, ps1.Start())
+	defer ps1.Stop()
+
+	state := func(id peer.ID) PeerInfo {
+		for _, p := range ps1.ListPeers() {
+			if p.ID == id {
+				return p
+			}
+		}
+		t.Fatalf("peer %s not listed", id)
+		return PeerInfo{}
+	}
+
+	require.Eventually(t, func() bool {
+		return state(h2.ID()).State == PeerConnected
+	}, 30*time.Second, 10*time.Millisecond)
+
+	p3 := state(h3.ID())
+	require.Equal(t, PeerBackoff, p3.State)
+	require.False(t, p3.NextRetry.IsZero(), "expected the next retry of a peer backing off")
+
+	ps1.RemovePeer(h3.ID())
+	require.Len(t, ps1.ListPeers(), 1)
+}
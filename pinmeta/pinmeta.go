@@ -0,0 +1,318 @@
+// Package pinmeta records information about local pins that the pinner
+// itself does not keep, such as their name or when they expire.
+package pinmeta
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"sync"
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	namespace "github.com/ipfs/go-datastore/namespace"
+	dsq "github.com/ipfs/go-datastore/query"
+	pin "github.com/ipfs/go-ipfs-pinner"
+	logging "github.com/ipfs/go-log"
+)
+
+var log = logging.Logger("pinmeta")
+
+// Prefix is the datastore prefix pin information is stored under.
+var Prefix = ds.NewKey("/local/pinmeta")
+
+var (
+	pinsKey  = ds.NewKey("/pins")
+	namesKey = ds.NewKey("/names")
+)
+
+// Info is the information recorded alongside a pin.
+type Info struct {
+	// Name is a name given to the pin. Names do not need to be unique.
+	Name string `json:",omitempty"`
+	// Meta holds arbitrary key-value pairs describing the pin.
+	Meta map[string]string `json:",omitempty"`
+	// Expires is when the pin expires. The zero time means never.
+	Expires time.Time `json:",omitempty"`
+}
+
+// IsZero returns true when no information is set.
+func (i Info) IsZero() bool {
+	return i.Name == "" && len(i.Meta) == 0 && i.Expires.IsZero()
+}
+
+// Expired returns true if the pin has an expiry that is not after now.
+func (i Info) Expired(now time.Time) bool {
+	return !i.Expires.IsZero() && !i.Expires.After(now)
+}
+
+// Matches returns true if the pin is named name, unless name is empty, and
+// has every key-value pair of meta.
+func (i Info) Matches(name string, meta map[string]string) bool {
+	if name != "" && i.Name != name {
+		return false
+	}
+	for k, v := range meta {
+		if mv, ok := i.Meta[k]; !ok || mv != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Store keeps pin information in a datastore, keyed by pinned CID.
+type Store struct {
+	lk sync.Mutex // serializes updates of the name index
+	ds ds.Datastore
+}
+
+// NewStore creates a Store keeping pin information under Prefix in the given
+// datastore. The information of each pin is stored under /pins, and pins are
+// indexed by name under /names.
+func NewStore(d ds.Datastore) *Store {
+	return &Store{ds: namespace.Wrap(d, Prefix)}
+}
+
+func pinKey(c cid.Cid) ds.Key {
+	return pinsKey.ChildString(c.String())
+}
+
+// Names may contain any character, including "/".
+func nameKey(name string, c cid.Cid) ds.Key {
+	return namesKey.ChildString(base64.RawURLEncoding.EncodeToString([]byte(name))).ChildString(c.String())
+}
+
+// Get returns the information recorded for the given pin, and false if there
+// is none.
+func (s *Store) Get(c cid.Cid) (Info, bool, error) {
+	var info Info
+	b, err := s.ds.Get(pinKey(c))
+	if err == ds.ErrNotFound {
+		return info, false, nil
+	}
+	if err != nil {
+		return info, false, err
+	}
+	if err := json.Unmarshal(b, &info); err != nil {
+		return info, false, err
+	}
+	return info, true, nil
+}
+
+// Put records info for the given pin, replacing any previous information.
+// Putting a zero Info removes the record.
+func (s *Store) Put(c cid.Cid, info Info) error {
+	if info.IsZero() {
+		return s.Delete(c)
+	}
+	b, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	prev, ok, err := s.Get(c)
+	if err != nil {
+		return err
+	}
+	if ok && prev.Name != "" && prev.Name != info.Name {
+		if err := s.ds.Delete(nameKey(prev.Name, c)); err != nil && err != ds.ErrNotFound {
+			return err
+		}
+	}
+	if info.Name != "" {
+		if err := s.ds.Put(nameKey(info.Name, c), nil); err != nil {
+			return err
+		}
+	}
+	return s.ds.Put(pinKey(c), b)
+}
+
+// Delete removes the information recorded for the given pin, if any.
+func (s *Store) Delete(c cid.Cid) error {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	prev, ok, err := s.Get(c)
+	if err != nil || !ok {
+		return err
+	}
+	if prev.Name != "" {
+		if err := s.ds.Delete(nameKey(prev.Name, c)); err != nil && err != ds.ErrNotFound {
+			return err
+		}
+	}
+	err = s.ds.Delete(pinKey(c))
+	if err == ds.ErrNotFound {
+		return nil
+	}
+	return err
+}
+
+// All returns the information of every pin with a record.
+func (s *Store) All() (map[cid.Cid]Info, error) {
+	res, err := s.ds.Query(dsq.Query{Prefix: pinsKey.String()})
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+
+	all := make(map[cid.Cid]Info)
+	for r := range res.Next() {
+		if r.Error != nil {
+			return nil, r.Error
+		}
+		c, err := cid.Decode(ds.RawKey(r.Key).BaseNamespace())
+		if err != nil {
+			log.Errorf("skipping invalid pin info key %q: %s", r.Key, err)
+			continue
+		}
+		var info Info
+		if err := json.Unmarshal(r.Value, &info); err != nil {
+			log.Errorf("skipping invalid pin info for %s: %s", c, err)
+			continue
+		}
+		all[c] = info
+	}
+	return all, nil
+}
+
+// Named returns the pins with the given name.
+func (s *Store) Named(name string) ([]cid.Cid, error) {
+	prefix := namesKey.ChildString(base64.RawURLEncoding.EncodeToString([]byte(name)))
+	res, err := s.ds.Query(dsq.Query{Prefix: prefix.String(), KeysOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+
+	var named []cid.Cid
+	for r := range res.Next() {
+		if r.Error != nil {
+			return nil, r.Error
+		}
+		k := ds.RawKey(r.Key)
+		if !k.Parent().Equal(prefix) {
+			continue // another name starting with the same characters
+		}
+		c, err := cid.Decode(k.BaseNamespace())
+		if err != nil {
+			log.Errorf("skipping invalid pin name key %q: %s", r.Key, err)
+			continue
+		}
+		named = append(named, c)
+	}
+	return named, nil
+}
+
+// Expired returns the pins whose expiry is not after now.
+func (s *Store) Expired(now time.Time) ([]cid.Cid, error) {
+	all, err := s.All()
+	if err != nil {
+		return nil, err
+	}
+	var expired []cid.Cid
+	for c, info := range all {
+		if info.Expired(now) {
+			expired = append(expired, c)
+		}
+	}
+	return expired, nil
+}
+
+// Pinner wraps a pin.Pinner so that pin information follows the pins it is
+// recorded for: it is removed along with the pin and moved by Update.
+type Pinner struct {
+	pin.Pinner
+	store *Store
+}
+
+// NewPinner wraps the given pinner, keeping the information in store in sync
+// with it.
+func NewPinner(pn pin.Pinner, store *Store) *Pinner {
+	return &Pinner{Pinner: pn, store: store}
+}
+
+// Store returns the store holding the pin information.
+func (p *Pinner) Store() *Store {
+	return p.store
+}
+
+func (p *Pinner) Unpin(ctx context.Context, c cid.Cid, recursive bool) error {
+	if err := p.Pinner.Unpin(ctx, c, recursive); err != nil {
+		return err
+	}
+	return p.store.Delete(c)
+}
+
+func (p *Pinner) RemovePinWithMode(c cid.Cid, mode pin.Mode) {
+	p.Pinner.RemovePinWithMode(c, mode)
+	if err := p.store.Delete(c); err != nil {
+		log.Errorf("removing pin info for %s: %s", c, err)
+	}
+}
+
+func (p *Pinner) Update(ctx context.Context, from, to cid.Cid, unpin bool) error {
+	if err := p.Pinner.Update(ctx, from, to, unpin); err != nil {
+		return err
+	}
+	if !unpin {
+		return nil
+	}
+	info, ok, err := p.store.Get(from)
+	if err != nil || !ok {
+		return err
+	}
+	if err := p.store.Put(to, info); err != nil {
+		return err
+	}
+	return p.store.Delete(from)
+}
+
+// ExpiredKeys returns the pins that have expired but were not removed yet.
+// It implements gc.ExpiringPinner.
+func (p *Pinner) ExpiredKeys(ctx context.Context) ([]cid.Cid, error) {
+	return p.store.Expired(time.Now())
+}
+
+// RemoveExpired unpins every expired pin and returns the removed pins. The
+// caller must hold the pin lock.
+func (p *Pinner) RemoveExpired(ctx context.Context) ([]cid.Cid, error) {
+	expired, err := p.ExpiredKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	removed := make([]cid.Cid, 0, len(expired))
+	for _, c := range expired {
+		if err := p.unpinAny(ctx, c); err != nil {
+			return removed, err
+		}
+		if err := p.store.Delete(c); err != nil {
+			return removed, err
+		}
+		removed = append(removed, c)
+	}
+
+	if len(removed) == 0 {
+		return removed, nil
+	}
+	return removed, p.Pinner.Flush(ctx)
+}
+
+// unpinAny removes the recursive or direct pin of c, if any.
+func (p *Pinner) unpinAny(ctx context.Context, c cid.Cid) error {
+	for _, mode := range []pin.Mode{pin.Recursive, pin.Direct} {
+		_, pinned, err := p.Pinner.IsPinnedWithType(ctx, c, mode)
+		if err != nil {
+			return err
+		}
+		if pinned {
+			return p.Pinner.Unpin(ctx, c, mode == pin.Recursive)
+		}
+	}
+	return nil
+}
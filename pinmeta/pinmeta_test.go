@@ -0,0 +1,169 @@
+package pinmeta
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	bserv "github.com/ipfs/go-blockservice"
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	offline "github.com/ipfs/go-ipfs-exchange-offline"
+	"github.com/ipfs/go-ipfs-pinner/dspinner"
+	dag "github.com/ipfs/go-merkledag"
+	mh "github.com/multiformats/go-multihash"
+)
+
+func testCid(t *testing.T, data string) cid.Cid {
+	h, err := mh.Sum([]byte(data), mh.SHA2_256, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cid.NewCidV1(cid.Raw, h)
+}
+
+func TestNamed(t *testing.T) {
+	s := NewStore(dssync.MutexWrap(ds.NewMapDatastore()))
+
+	a, b := testCid(t, "a"), testCid(t, "b")
+	if err := s.Put(a, Info{Name: "build/1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put(b, Info{Name: "build/1", Meta: map[string]string{"branch": "main"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	named, err := s.Named("build/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(named) != 2 {
+		t.Fatalf("expected 2 named pins, got %d", len(named))
+	}
+
+	// Renaming and deleting update the index.
+	if err := s.Put(a, Info{Name: "build/2"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete(b); err != nil {
+		t.Fatal(err)
+	}
+	named, err = s.Named("build/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(named) != 0 {
+		t.Fatalf("expected no pins named build/1, got %v", named)
+	}
+	named, err = s.Named("build/2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(named) != 1 || !named[0].Equals(a) {
+		t.Fatalf("expected %s to be named build/2, got %v", a, named)
+	}
+}
+
+func TestInfoMatches(t *testing.T) {
+	info := Info{Name: "nightly", Meta: map[string]string{"branch": "main", "os": "linux"}}
+
+	for _, tc := range []struct {
+		name  string
+		meta  map[string]string
+		match bool
+	}{
+		{"", nil, true},
+		{"nightly", nil, true},
+		{"weekly", nil, false},
+		{"", map[string]string{"branch": "main"}, true},
+		{"nightly", map[string]string{"branch": "main", "os": "linux"}, true},
+		{"", map[string]string{"branch": "dev"}, false},
+		{"", map[string]string{"arch": "amd64"}, false},
+	} {
+		if got := info.Matches(tc.name, tc.meta); got != tc.match {
+			t.Errorf("Matches(%q, %v) = %v, want %v", tc.name, tc.meta, got, tc.match)
+		}
+	}
+}
+
+func TestRemoveExpired(t *testing.T) {
+	ctx := context.Background()
+
+	d := dssync.MutexWrap(ds.NewMapDatastore())
+	bs := blockstore.NewBlockstore(d)
+	dserv := dag.NewDAGService(bserv.New(bs, offline.Exchange(bs)))
+	dspin, err := dspinner.New(ctx, d, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewStore(d)
+	pinner := NewPinner(dspin, s)
+
+	now := time.Now()
+	pins := map[string]struct {
+		recursive bool
+		info      Info
+		expired   bool
+	}{
+		"expired recursive": {true, Info{Expires: now.Add(-time.Minute)}, true},
+		"expired direct":    {false, Info{Name: "direct", Expires: now.Add(-time.Minute)}, true},
+		"expiring":          {true, Info{Expires: now.Add(time.Hour)}, false},
+		"permanent":         {true, Info{Name: "permanent"}, false},
+	}
+	cids := map[string]cid.Cid{}
+	for name, p := range pins {
+		nd := dag.NodeWithData([]byte(name))
+		if err := dserv.Add(ctx, nd); err != nil {
+			t.Fatal(err)
+		}
+		if err := pinner.Pin(ctx, nd, p.recursive); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Put(nd.Cid(), p.info); err != nil {
+			t.Fatal(err)
+		}
+		cids[name] = nd.Cid()
+	}
+	if err := pinner.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	expired, err := pinner.ExpiredKeys(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(expired) != 2 {
+		t.Fatalf("expected 2 expired pins, got %d", len(expired))
+	}
+
+	removed, err := pinner.RemoveExpired(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 2 {
+		t.Fatalf("expected 2 removed pins, got %d", len(removed))
+	}
+
+	for name, p := range pins {
+		_, pinned, err := pinner.IsPinned(ctx, cids[name])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pinned == p.expired {
+			t.Errorf("%s: pinned %v after removing expired pins", name, pinned)
+		}
+		_, ok, err := s.Get(cids[name])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok == p.expired {
+			t.Errorf("%s: info recorded %v after removing expired pins", name, ok)
+		}
+	}
+
+	if removed, err := pinner.RemoveExpired(ctx); err != nil || len(removed) != 0 {
+		t.Fatalf("expected nothing left to remove, got %v %v", removed, err)
+	}
+}
@@ -0,0 +1,35 @@
+package repo
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/ipfs/go-ipfs/repo/common"
+)
+
+// ReadConfigKey decodes the value stored under key in the configuration of
+// r into out. It is meant for settings that config.Config has no field for,
+// which are only kept in the configuration file. It returns false if the key
+// is not set, leaving out untouched.
+func ReadConfigKey(r Repo, key string, out interface{}) (bool, error) {
+	v, err := r.GetConfigKey(key)
+	if err != nil {
+		var nf *common.KeyNotFoundError
+		if errors.As(err, &nf) {
+			return false, nil
+		}
+		return false, err
+	}
+	if v == nil {
+		return false, nil
+	}
+
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return false, err
+	}
+	if err := json.Unmarshal(buf, out); err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -558,6 +558,13 @@ func (r *FSRepo) setConfigUnsynced(updated *config.Config) error {
 	if err != nil {
 		return err
 	}
+	// Nested keys config.Config has no field for are dropped by the round
+	// trip through the struct, keep them too.
+	if orig, err := config.FromMap(mapconf); err == nil {
+		if known, err := config.ToMap(orig); err == nil {
+			mergeUnknownKeys(m, mapconf, known)
+		}
+	}
 	for k, v := range m {
 		mapconf[k] = v
 	}
@@ -570,6 +577,26 @@ func (r *FSRepo) setConfigUnsynced(updated *config.Config) error {
 	return nil
 }
 
+// mergeUnknownKeys copies into dst the keys of src that are missing from
+// known, at any depth.
+func mergeUnknownKeys(dst, src, known map[string]interface{}) {
+	for k, v := range src {
+		kv, ok := known[k]
+		if !ok {
+			if _, set := dst[k]; !set {
+				dst[k] = v
+			}
+			continue
+		}
+		srcm, ok1 := v.(map[string]interface{})
+		knownm, ok2 := kv.(map[string]interface{})
+		dstm, ok3 := dst[k].(map[string]interface{})
+		if ok1 && ok2 && ok3 {
+			mergeUnknownKeys(dstm, srcm, knownm)
+		}
+	}
+}
+
 // SetConfig updates the FSRepo's config. The user must not modify the config
 // object after calling this method.
 func (r *FSRepo) SetConfig(updated *config.Config) error {
@@ -581,6 +608,42 @@ func (r *FSRepo) SetConfig(updated *config.Config) error {
 	return r.setConfigUnsynced(updated)
 }
 
+// ReloadConfig reads the config file again, to pick up changes made to it
+// while the repo is open, and returns the new config.
+func (r *FSRepo) ReloadConfig() (*config.Config, error) {
+	packageLock.Lock()
+	defer packageLock.Unlock()
+
+	if r.closed {
+		return nil, errors.New("repo is closed")
+	}
+	if err := r.openConfig(); err != nil {
+		return nil, err
+	}
+	return r.config, nil
+}
+
+// RawConfig returns the content of the config file as a map, including the
+// keys config.Config has no field for.
+func (r *FSRepo) RawConfig() (map[string]interface{}, error) {
+	packageLock.Lock()
+	defer packageLock.Unlock()
+
+	if r.closed {
+		return nil, errors.New("repo is closed")
+	}
+
+	filename, err := config.Filename(r.path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg map[string]interface{}
+	if err := serialize.ReadConfigFile(filename, &cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
 // GetConfigKey retrieves only the value of a particular key.
 func (r *FSRepo) GetConfigKey(key string) (interface{}, error) {
 	packageLock.Lock()
@@ -116,3 +116,59 @@ func TestOpenMoreThanOnceInSameProcess(t *testing.T) {
 	assert.Nil(r1.Close(), t)
 	assert.Nil(r2.Close(), t)
 }
+
+func TestSetConfigKeepsUnknownKeys(t *testing.T) {
+	t.Parallel()
+	path := testRepoPath("", t)
+	assert.Nil(Init(path, &config.Config{Datastore: config.DefaultDatastoreConfig()}), t)
+
+	r, err := Open(path)
+	assert.Nil(err, t)
+	defer r.Close()
+
+	assert.Nil(r.SetConfigKey("Datastore.UnknownKey", "value"), t, "setting an unknown nested key should succeed")
+
+	cfg, err := r.Config()
+	assert.Nil(err, t)
+	newCfg, err := cfg.Clone()
+	assert.Nil(err, t)
+	newCfg.Datastore.StorageMax = "20GB"
+	assert.Nil(r.SetConfig(newCfg), t, "SetConfig should succeed")
+
+	v, err := r.GetConfigKey("Datastore.UnknownKey")
+	assert.Nil(err, t, "unknown nested key should survive SetConfig")
+	assert.True(v == "value", t, "unknown nested key should keep its value")
+
+	v, err = r.GetConfigKey("Datastore.StorageMax")
+	assert.Nil(err, t)
+	assert.True(v == "20GB", t, "known key should be updated")
+}
+
+func TestReloadConfig(t *testing.T) {
+	t.Parallel()
+	path := testRepoPath("", t)
+	assert.Nil(Init(path, &config.Config{Datastore: config.DefaultDatastoreConfig()}), t)
+
+	r, err := Open(path)
+	assert.Nil(err, t)
+	defer r.Close()
+
+	// edit the file behind the back of the open repo
+	other := &FSRepo{path: path}
+	assert.Nil(other.openConfig(), t)
+	other.config.Datastore.StorageMax = "20GB"
+	assert.Nil(other.setConfigUnsynced(other.config), t)
+
+	cfg, err := r.Config()
+	assert.Nil(err, t)
+	assert.True(cfg.Datastore.StorageMax != "20GB", t, "the open repo should not see the change yet")
+
+	cfg, err = r.(*FSRepo).ReloadConfig()
+	assert.Nil(err, t)
+	assert.True(cfg.Datastore.StorageMax == "20GB", t, "the reloaded config should have the change")
+
+	raw, err := r.(*FSRepo).RawConfig()
+	assert.Nil(err, t)
+	ds, ok := raw["Datastore"].(map[string]interface{})
+	assert.True(ok && ds["StorageMax"] == "20GB", t, "the raw config should have the change")
+}